@@ -2,7 +2,10 @@ package main
 
 import (
 	authHandler "bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/auth/handler"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/auth/keys"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/auth/lockout"
 	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/auth/middleware"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/auth/oidc"
 	authRepository "bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/auth/repository"
 	authService "bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/auth/service"
 	sessionsHandler "bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/cinemasession/handler"
@@ -23,17 +26,38 @@ import (
 	pdf "bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/ticket/pdf"
 	ticketRepository "bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/ticket/repository"
 	ticketService "bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/ticket/service"
-	minioStorage "bitbucket.org/Ernst_Dzeravianka/cinemago-app/pkg/minio"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/pkg/mailer"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/pkg/payment"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/pkg/storage"
+
+	paymentHandler "bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/payment/handler"
+	paymentRepository "bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/payment/repository"
+	paymentService "bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/payment/service"
+
+	roleHandler "bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/role/handler"
+	roleRepository "bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/role/repository"
+	roleService "bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/role/service"
 
 	userHandler "bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/user/handler"
 	userRepository "bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/user/repository"
 	userService "bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/user/service"
 
 	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/config"
+	"context"
 	"database/sql"
+	"fmt"
 	"github.com/gorilla/mux"
 	"log"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	holdReaperInterval   = time.Minute
+	refundWorkerInterval = time.Minute
+	emailWorkerInterval  = time.Minute
 )
 
 func main() {
@@ -49,45 +73,226 @@ func main() {
 	}
 	defer db.Close()
 
-	minioClient, err := minio.New(configs.MinIOEndpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(configs.MinIOUser, configs.MinIOPasswd, ""),
-		Secure: false,
-	})
+	router := mux.NewRouter()
 
-	if err != nil {
-		log.Fatalf("failed to create MinIO client: %v", err)
+	signingKeys := keys.NewHMAC("default", []byte(configs.JWTSecret))
+	if configs.JWTKeysDir != "" {
+		signingKeys, err = keys.LoadDir(configs.JWTKeysDir, configs.JWTSigningKey)
+		if err != nil {
+			log.Fatalf("failed to load JWT signing keys: %v", err)
+		}
 	}
 
-	router := mux.NewRouter()
+	var mailSender mailer.Mailer
+	switch configs.Mailer {
+	case "smtp":
+		mailSender = mailer.NewSMTP(configs.SMTPHost, configs.SMTPPort, configs.SMTPUser, configs.SMTPPasswd,
+			configs.MailFrom)
+	case "memory":
+		mailSender = mailer.NewMemory()
+	default:
+		mailSender, err = mailer.NewFile(configs.MailDir, configs.MailFrom)
+		if err != nil {
+			log.Fatalf("failed to create file mailer: %v", err)
+		}
+	}
 
 	authRepo := authRepository.New(db)
-	authServ := authService.New(configs.JWTSecret, configs.TokenExp, authRepo)
-	authHandler.New(router, authServ)
+
+	var attemptsStore lockout.Store = authRepo
+	if configs.LockoutStore == "memory" {
+		attemptsStore = lockout.NewMemoryStore()
+	}
+
+	accountLimiter := lockout.New(attemptsStore, lockout.Policy{
+		MaxFailures: configs.MaxFailures,
+		BaseDelay:   time.Duration(configs.LockoutTime) * time.Minute,
+		MaxDelay:    24 * time.Hour,
+		Window:      24 * time.Hour,
+	})
+	clientLimiter := lockout.New(attemptsStore, lockout.Policy{
+		MaxFailures: configs.IPMaxFailures,
+		BaseDelay:   time.Second,
+		MaxDelay:    time.Hour,
+		Window:      time.Hour,
+	})
+
+	authServ := authService.New(signingKeys, time.Duration(configs.TokenExp)*time.Minute,
+		time.Duration(configs.RefreshExp)*time.Hour, authRepo, accountLimiter, clientLimiter,
+		mailSender, configs.PublicURL)
+
+	if configs.OIDCIssuer != "" {
+		provider, err := oidc.New(context.Background(), configs.OIDCIssuer, configs.OIDCClientID,
+			configs.OIDCSecret, configs.OIDCRedirect, strings.Fields(configs.OIDCScopes), configs.OIDCGroups)
+		if err != nil {
+			log.Fatalf("failed to configure OpenID Connect: %v", err)
+		}
+		authServ = authServ.WithOIDC(provider, groupRoles(configs.OIDCRoles))
+	}
 
 	authMW := authmw.New(authServ)
+	authHandler.New(authServ).SetRoutes(router, authMW)
+
+	var paymentProvider payment.Provider
+	switch configs.Payments {
+	case "fake":
+		if configs.Env != config.Development {
+			log.Fatalf("the fake payment provider is only available with APP_ENV=%s", config.Development)
+		}
+		fakeProvider := payment.NewFake()
+		router.Handle("/dev/payment-tokens", fakeProvider).Methods(http.MethodPost)
+		paymentProvider = fakeProvider
+	case "":
+		log.Fatal("PAYMENT_PROVIDER is not set")
+	default:
+		log.Fatalf("unknown payment provider %q", configs.Payments)
+	}
+
+	var ticketsStorage storage.Storage
+	switch configs.Storage {
+	case "minio":
+		ticketsStorage, err = newMinIOStorage(configs)
+		if err != nil {
+			log.Fatalf("failed to create MinIO storage: %v", err)
+		}
+	case "fs":
+		fsStorage, err := storage.NewFS(configs.StorageDir, configs.PublicURL+"/files",
+			[]byte(configs.StorageSecret))
+		if err != nil {
+			log.Fatalf("failed to create file storage: %v", err)
+		}
+		router.PathPrefix("/files/").Handler(http.StripPrefix("/files", fsStorage))
+		ticketsStorage = fsStorage
+	default:
+		log.Fatalf("unknown storage backend %q", configs.Storage)
+	}
+
+	moviesRepo := moviesRepository.New(db)
 
 	userRepo := userRepository.New(db)
-	userServ := userService.New(userRepo)
+	userServ := userService.New(userRepo, mailSender, configs.PublicURL, moviesRepo, paymentProvider,
+		ticketsStorage)
 	userHandler.New(router, userServ).SetRoutes(router, authMW)
 
+	paymentRepo := paymentRepository.New(db)
+	paymentServ := paymentService.New(paymentRepo, paymentProvider)
+	paymentHandler.New(paymentServ).SetRoutes(router, authMW)
+
+	roleRepo := roleRepository.New(db)
+	roleServ := roleService.New(roleRepo)
+	roleHandler.New(roleServ).SetRoutes(router, authMW)
+
 	sessionsRepo := sessionsRepository.New(db, configs.TimeZone)
-	sessionsServ := sessionsService.New(sessionsRepo)
+	sessionsServ := sessionsService.New(sessionsRepo).WithHoldTTL(time.Duration(configs.HoldTTL) * time.Minute)
+	go sessionsServ.RunHoldReaper(context.Background(), holdReaperInterval)
 	sessionsHandler.New(sessionsServ).SetRoutes(router, authMW)
 
 	hallsRepo := hallsRepository.New(db)
 	hallsServ := hallsService.New(hallsRepo)
 	hallsHandler.New(hallsServ).SetRoutes(router, authMW)
 
-	moviesRepo := moviesRepository.New(db)
 	moviesServ := moviesService.New(moviesRepo)
 	moviesHandler.New(moviesServ).SetRoutes(router, authMW)
 
-	ticketGen := pdf.Generator{}
-	ticketsStorage := minioStorage.New(minioClient, configs.BucketName)
+	ticketGen, err := newTicketGenerator(configs.TicketTmpl)
+	if err != nil {
+		log.Fatalf("failed to load ticket template: %v", err)
+	}
+
+	hallGens, err := newHallTicketGenerators(configs.HallTmpls)
+	if err != nil {
+		log.Fatalf("failed to load hall ticket templates: %v", err)
+	}
 
 	ticketRepo := ticketRepository.New(db)
-	ticketServ := ticketService.New(ticketRepo, ticketGen, ticketsStorage)
+	ticketServ := ticketService.New(ticketRepo, ticketGen, ticketsStorage, mailSender, paymentProvider).
+		WithCancellationCutoff(time.Duration(configs.CancelCutoff) * time.Minute).
+		WithTicketURLTTL(time.Duration(configs.TicketURLTTL) * time.Minute).
+		WithSigningKey([]byte(configs.TicketSecret)).
+		WithAdmissionWindow(time.Duration(configs.AdmissionTime) * time.Minute).
+		WithGuestLimiter(lockout.New(attemptsStore, lockout.Policy{
+			MaxFailures: configs.GuestMaxBuys,
+			BaseDelay:   10 * time.Minute,
+			MaxDelay:    time.Hour,
+			Window:      time.Hour,
+		}))
+	for hallId, gen := range hallGens {
+		ticketServ = ticketServ.WithHallGenerator(hallId, gen)
+	}
+	go ticketServ.RunRefundWorker(context.Background(), refundWorkerInterval)
+	go ticketServ.RunEmailWorker(context.Background(), emailWorkerInterval)
 	ticketHandler.New(ticketServ).SetRoutes(router, authMW)
 
 	log.Fatal(http.ListenAndServe(":"+configs.Port, router))
 }
+
+// groupRoles parses a "group=role,group=role" mapping of identity provider groups to roles.
+func groupRoles(mapping string) map[string]string {
+	roles := make(map[string]string)
+	for _, pair := range strings.Split(mapping, ",") {
+		group, role, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok && group != "" && role != "" {
+			roles[group] = role
+		}
+	}
+	return roles
+}
+
+// newMinIOStorage connects to MinIO. Download URLs are signed for the public
+// URL of MinIO, which may differ from the endpoint the service talks to.
+func newMinIOStorage(configs config.Config) (storage.MinIO, error) {
+	client, err := minio.New(configs.MinIOEndpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(configs.MinIOUser, configs.MinIOPasswd, ""),
+		Secure: false,
+		Region: configs.MinIORegion,
+	})
+	if err != nil {
+		return storage.MinIO{}, err
+	}
+
+	publicURL, err := url.Parse(configs.MinIOPublic)
+	if err != nil || publicURL.Host == "" {
+		return storage.MinIO{}, fmt.Errorf("invalid MinIO public URL %q", configs.MinIOPublic)
+	}
+
+	publicClient, err := minio.New(publicURL.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(configs.MinIOUser, configs.MinIOPasswd, ""),
+		Secure: publicURL.Scheme == "https",
+		Region: configs.MinIORegion,
+	})
+	if err != nil {
+		return storage.MinIO{}, err
+	}
+
+	return storage.NewMinIO(client, configs.BucketName).WithPublicClient(publicClient), nil
+}
+
+func newTicketGenerator(templateDir string) (pdf.Generator, error) {
+	tmpl, err := pdf.DefaultTemplate()
+	if templateDir != "" {
+		tmpl, err = pdf.LoadTemplate(templateDir)
+	}
+	if err != nil {
+		return pdf.Generator{}, err
+	}
+	return pdf.New(tmpl)
+}
+
+func newHallTicketGenerators(dir string) (map[int]pdf.Generator, error) {
+	if dir == "" {
+		return nil, nil
+	}
+
+	templates, err := pdf.LoadHallTemplates(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	gens := make(map[int]pdf.Generator, len(templates))
+	for hallId, tmpl := range templates {
+		if gens[hallId], err = pdf.New(tmpl); err != nil {
+			return nil, fmt.Errorf("hall %d: %w", hallId, err)
+		}
+	}
+	return gens, nil
+}
@@ -1,17 +1,42 @@
 CREATE TABLE roles (
     role_id SERIAL PRIMARY KEY,
-    role_name VARCHAR(50) NOT NULL
+    role_name VARCHAR(50) NOT NULL UNIQUE
+);
+
+CREATE TABLE permissions (
+    permission_id SERIAL PRIMARY KEY,
+    permission_name VARCHAR(50) NOT NULL UNIQUE
+);
+
+CREATE TABLE role_permissions (
+    role_id INTEGER NOT NULL,
+    permission_id INTEGER NOT NULL,
+    PRIMARY KEY (role_id, permission_id),
+    CONSTRAINT role_permissions_role_id_fkey FOREIGN KEY (role_id)
+        REFERENCES roles (role_id) ON DELETE CASCADE,
+    CONSTRAINT role_permissions_permission_id_fkey FOREIGN KEY (permission_id)
+        REFERENCES permissions (permission_id) ON DELETE CASCADE
 );
 
 CREATE TABLE users (
     user_id SERIAL PRIMARY KEY,
     username VARCHAR(50) NOT NULL,
     hashed_password VARCHAR(64) NOT NULL,
-    email VARCHAR(50),
-    credit_card_info VARCHAR(50),
+    email VARCHAR(50) UNIQUE,
+    email_verified BOOLEAN NOT NULL DEFAULT false,
+    display_name VARCHAR(50),
+    disabled_at TIMESTAMP,
+    erased_at TIMESTAMP
+);
+
+CREATE TABLE user_roles (
+    user_id INTEGER NOT NULL,
     role_id INTEGER NOT NULL,
-    CONSTRAINT users_role_id_fkey FOREIGN KEY (role_id)
-        REFERENCES roles (role_id) ON DELETE RESTRICT
+    PRIMARY KEY (user_id, role_id),
+    CONSTRAINT user_roles_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES users (user_id) ON DELETE CASCADE,
+    CONSTRAINT user_roles_role_id_fkey FOREIGN KEY (role_id)
+        REFERENCES roles (role_id) ON DELETE CASCADE
 );
 
 CREATE TABLE movies (
@@ -25,7 +50,8 @@ CREATE TABLE movies (
 CREATE TABLE halls (
     hall_id SERIAL PRIMARY KEY,
     hall_name VARCHAR(50) NOT NULL,
-    capacity INTEGER NOT NULL
+    capacity INTEGER NOT NULL,
+    seats_per_row INTEGER NOT NULL DEFAULT 0
 );
 
 CREATE TABLE cinema_sessions (
@@ -35,6 +61,7 @@ CREATE TABLE cinema_sessions (
     start_time timestamptz NOT NULL,
     end_time timestamptz NOT NULL,
     price DECIMAL(5,2) NOT NULL,
+    cancelled_at timestamptz,
     CONSTRAINT cinema_sessions_movie_id_fkey FOREIGN KEY (movie_id)
         REFERENCES movies (movie_id) ON DELETE CASCADE,
     CONSTRAINT cinema_sessions_hall_id_fkey FOREIGN KEY (hall_id)
@@ -46,15 +73,209 @@ CREATE TABLE tickets (
     session_id INTEGER NOT NULL,
     user_id INTEGER NOT NULL,
     seat_number INTEGER NOT NULL,
+    order_id INTEGER,
+    price DECIMAL(5,2),
+    status VARCHAR(20) NOT NULL DEFAULT 'active',
+    cancelled_at timestamptz,
+    pdf_key VARCHAR(100),
+    admitted_at timestamptz,
+    CONSTRAINT tickets_status_check CHECK (status IN ('active', 'cancelled')),
     CONSTRAINT tickets_session_id_fkey FOREIGN KEY (session_id)
         REFERENCES cinema_sessions (session_id) ON DELETE CASCADE,
     CONSTRAINT tickets_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES users (user_id) ON DELETE RESTRICT
+);
+
+CREATE UNIQUE INDEX tickets_session_id_seat_number_idx ON tickets (session_id, seat_number)
+    WHERE status <> 'cancelled';
+
+CREATE TABLE refresh_tokens (
+    token_id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at timestamptz NOT NULL,
+    revoked_at timestamptz,
+    mfa BOOLEAN NOT NULL DEFAULT false,
+    CONSTRAINT refresh_tokens_user_id_fkey FOREIGN KEY (user_id)
         REFERENCES users (user_id) ON DELETE CASCADE
 );
 
+CREATE TABLE revoked_tokens (
+    jti VARCHAR(32) PRIMARY KEY,
+    expires_at timestamptz NOT NULL
+);
+
+CREATE TABLE login_attempts (
+    attempt_key VARCHAR(100) PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failure timestamptz NOT NULL,
+    locked_until timestamptz
+);
+
+CREATE TABLE user_tokens (
+    token_id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    purpose VARCHAR(30) NOT NULL,
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz,
+    CONSTRAINT user_tokens_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES users (user_id) ON DELETE CASCADE
+);
+
+CREATE TABLE user_totp (
+    user_id INTEGER PRIMARY KEY,
+    secret VARCHAR(64) NOT NULL,
+    confirmed_at timestamptz,
+    last_used_step BIGINT,
+    CONSTRAINT user_totp_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES users (user_id) ON DELETE CASCADE
+);
+
+CREATE TABLE recovery_codes (
+    code_id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at timestamptz,
+    CONSTRAINT recovery_codes_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES users (user_id) ON DELETE CASCADE
+);
+
+CREATE TABLE api_keys (
+    key_id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(16) NOT NULL UNIQUE,
+    key_hash VARCHAR(64) NOT NULL,
+    user_id INTEGER NOT NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    created_at timestamptz NOT NULL DEFAULT now(),
+    expires_at timestamptz,
+    last_used_at timestamptz,
+    revoked_at timestamptz,
+    CONSTRAINT api_keys_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES users (user_id) ON DELETE CASCADE
+);
+
+CREATE TABLE user_identities (
+    issuer VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    user_id INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (issuer, subject),
+    CONSTRAINT user_identities_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES users (user_id) ON DELETE CASCADE
+);
+
+CREATE TABLE payment_methods (
+    method_id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    provider_token VARCHAR(255) NOT NULL UNIQUE,
+    brand VARCHAR(20) NOT NULL,
+    last4 CHAR(4) NOT NULL,
+    exp_month SMALLINT NOT NULL CHECK (exp_month BETWEEN 1 AND 12),
+    exp_year SMALLINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    CONSTRAINT payment_methods_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES users (user_id) ON DELETE CASCADE
+);
+
+CREATE TABLE guest_checkouts (
+    user_id INTEGER PRIMARY KEY,
+    email VARCHAR(50) NOT NULL,
+    lookup_code_hash VARCHAR(64) NOT NULL UNIQUE,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    CONSTRAINT guest_checkouts_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES users (user_id) ON DELETE CASCADE
+);
+
+CREATE TABLE seat_holds (
+    session_id INTEGER NOT NULL,
+    seat_number INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    expires_at timestamptz NOT NULL,
+    PRIMARY KEY (session_id, seat_number),
+    CONSTRAINT seat_holds_session_id_fkey FOREIGN KEY (session_id)
+        REFERENCES cinema_sessions (session_id) ON DELETE CASCADE,
+    CONSTRAINT seat_holds_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES users (user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX seat_holds_expires_at_idx ON seat_holds (expires_at);
+
+CREATE TABLE orders (
+    order_id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    session_id INTEGER NOT NULL,
+    total_price DECIMAL(7,2) NOT NULL DEFAULT 0,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    CONSTRAINT orders_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES users (user_id) ON DELETE RESTRICT,
+    CONSTRAINT orders_session_id_fkey FOREIGN KEY (session_id)
+        REFERENCES cinema_sessions (session_id) ON DELETE CASCADE
+);
+
+ALTER TABLE tickets ADD CONSTRAINT tickets_order_id_fkey FOREIGN KEY (order_id)
+    REFERENCES orders (order_id) ON DELETE SET NULL;
+
+CREATE TABLE refunds (
+    refund_id SERIAL PRIMARY KEY,
+    ticket_id INTEGER,
+    user_id INTEGER NOT NULL,
+    amount DECIMAL(5,2) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    reason VARCHAR(50) NOT NULL,
+    provider_ref VARCHAR(255),
+    failure VARCHAR(255),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at timestamptz NOT NULL DEFAULT now(),
+    created_at timestamptz NOT NULL DEFAULT now(),
+    updated_at timestamptz NOT NULL DEFAULT now(),
+    CONSTRAINT refunds_status_check CHECK (status IN ('pending', 'succeeded', 'failed')),
+    CONSTRAINT refunds_ticket_id_fkey FOREIGN KEY (ticket_id)
+        REFERENCES tickets (ticket_id) ON DELETE SET NULL,
+    CONSTRAINT refunds_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES users (user_id) ON DELETE RESTRICT
+);
+
+CREATE INDEX refunds_status_idx ON refunds (status, next_attempt_at);
+
+CREATE TABLE ticket_emails (
+    email_id SERIAL PRIMARY KEY,
+    pdf_key VARCHAR(100) NOT NULL,
+    recipient VARCHAR(50) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at timestamptz NOT NULL DEFAULT now(),
+    failure VARCHAR(255),
+    created_at timestamptz NOT NULL DEFAULT now(),
+    sent_at timestamptz,
+    CONSTRAINT ticket_emails_status_check CHECK (status IN ('pending', 'sent', 'failed'))
+);
+
+CREATE INDEX ticket_emails_status_idx ON ticket_emails (status, next_attempt_at);
+
+CREATE INDEX tickets_pdf_key_idx ON tickets (pdf_key);
+
 -- Data setup scripts
 INSERT INTO roles (role_name) VALUES ('admin');
 INSERT INTO roles (role_name) VALUES ('user');
 
-INSERT INTO users (username, hashed_password, email, credit_card_info, role_id)
-VALUES ('admin', '5e884898da28047151d0e56f8dc6292773603d0d6aabbdd62a11ef721d1542d8', 'admin@example.com', '1234567890123456', 1);
+INSERT INTO permissions (permission_name)
+VALUES ('halls:write'),
+       ('movies:write'),
+       ('sessions:write'),
+       ('tickets:read'),
+       ('tickets:validate'),
+       ('tickets:refund'),
+       ('users:write'),
+       ('roles:write'),
+       ('apikeys:write');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.role_id, p.permission_id
+FROM roles r, permissions p
+WHERE r.role_name = 'admin';
+
+INSERT INTO users (username, hashed_password, email, email_verified)
+VALUES ('admin', '5e884898da28047151d0e56f8dc6292773603d0d6aabbdd62a11ef721d1542d8', 'admin@example.com', true);
+INSERT INTO user_roles (user_id, role_id) VALUES (1, 1);
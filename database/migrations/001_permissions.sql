@@ -0,0 +1,66 @@
+-- Replaces the single users.role_id with roles granted through user_roles and
+-- permissions granted to roles through role_permissions. The role of every
+-- existing user is carried over before the column is dropped. Apply it before
+-- the other migrations, some of them add permissions.
+BEGIN;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'roles_role_name_key') THEN
+        ALTER TABLE roles ADD CONSTRAINT roles_role_name_key UNIQUE (role_name);
+    END IF;
+END $$;
+
+CREATE TABLE IF NOT EXISTS permissions (
+    permission_id SERIAL PRIMARY KEY,
+    permission_name VARCHAR(50) NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id INTEGER NOT NULL,
+    permission_id INTEGER NOT NULL,
+    PRIMARY KEY (role_id, permission_id),
+    CONSTRAINT role_permissions_role_id_fkey FOREIGN KEY (role_id)
+        REFERENCES roles (role_id) ON DELETE CASCADE,
+    CONSTRAINT role_permissions_permission_id_fkey FOREIGN KEY (permission_id)
+        REFERENCES permissions (permission_id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id INTEGER NOT NULL,
+    role_id INTEGER NOT NULL,
+    PRIMARY KEY (user_id, role_id),
+    CONSTRAINT user_roles_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES users (user_id) ON DELETE CASCADE,
+    CONSTRAINT user_roles_role_id_fkey FOREIGN KEY (role_id)
+        REFERENCES roles (role_id) ON DELETE CASCADE
+);
+
+INSERT INTO permissions (permission_name)
+VALUES ('halls:write'),
+       ('movies:write'),
+       ('sessions:write'),
+       ('users:write'),
+       ('roles:write'),
+       ('apikeys:write'),
+       ('tickets:refund')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.role_id, p.permission_id
+FROM roles r, permissions p
+WHERE r.role_name = 'admin'
+ON CONFLICT DO NOTHING;
+
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_name = 'users' AND column_name = 'role_id') THEN
+        INSERT INTO user_roles (user_id, role_id)
+        SELECT user_id, role_id FROM users
+        ON CONFLICT DO NOTHING;
+        ALTER TABLE users DROP COLUMN role_id;
+    END IF;
+END $$;
+
+COMMIT;
@@ -0,0 +1,30 @@
+-- Removes the plaintext card numbers stored in users.credit_card_info.
+-- Cards have to be added again through /users/me/payment-methods, only
+-- provider tokens are kept from now on.
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS payment_methods (
+    method_id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    provider_token VARCHAR(255) NOT NULL UNIQUE,
+    brand VARCHAR(20) NOT NULL,
+    last4 CHAR(4) NOT NULL,
+    exp_month SMALLINT NOT NULL CHECK (exp_month BETWEEN 1 AND 12),
+    exp_year SMALLINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    CONSTRAINT payment_methods_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES users (user_id) ON DELETE CASCADE
+);
+
+-- Dropping a column does not rewrite the table, so the values are overwritten
+-- first. Run VACUUM FULL users after the migration to remove old row versions.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_name = 'users' AND column_name = 'credit_card_info') THEN
+        UPDATE users SET credit_card_info = NULL WHERE credit_card_info IS NOT NULL;
+        ALTER TABLE users DROP COLUMN credit_card_info;
+    END IF;
+END $$;
+
+COMMIT;
@@ -0,0 +1,11 @@
+-- Accounts are no longer deleted on erasure requests, the users row is
+-- anonymized instead so sold tickets stay in place for accounting.
+BEGIN;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS erased_at TIMESTAMP;
+
+ALTER TABLE tickets DROP CONSTRAINT IF EXISTS tickets_user_id_fkey;
+ALTER TABLE tickets ADD CONSTRAINT tickets_user_id_fkey FOREIGN KEY (user_id)
+    REFERENCES users (user_id) ON DELETE RESTRICT;
+
+COMMIT;
@@ -0,0 +1,6 @@
+-- Guarantees that a seat of a session can be sold only once.
+-- Index creation fails if the same seat was already sold twice, such tickets
+-- can be listed with:
+--   SELECT session_id, seat_number, array_agg(ticket_id) FROM tickets
+--   GROUP BY session_id, seat_number HAVING count(*) > 1;
+CREATE UNIQUE INDEX IF NOT EXISTS tickets_session_id_seat_number_idx ON tickets (session_id, seat_number);
@@ -0,0 +1,28 @@
+-- Adds orders for buying several seats at once and stores the price paid for
+-- every ticket. Existing tickets get the current price of their session.
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS orders (
+    order_id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    session_id INTEGER NOT NULL,
+    total_price DECIMAL(7,2) NOT NULL DEFAULT 0,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    CONSTRAINT orders_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES users (user_id) ON DELETE RESTRICT,
+    CONSTRAINT orders_session_id_fkey FOREIGN KEY (session_id)
+        REFERENCES cinema_sessions (session_id) ON DELETE CASCADE
+);
+
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS order_id INTEGER;
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS price DECIMAL(5,2);
+
+ALTER TABLE tickets DROP CONSTRAINT IF EXISTS tickets_order_id_fkey;
+ALTER TABLE tickets ADD CONSTRAINT tickets_order_id_fkey FOREIGN KEY (order_id)
+    REFERENCES orders (order_id) ON DELETE SET NULL;
+
+UPDATE tickets t SET price = s.price
+FROM cinema_sessions s
+WHERE s.session_id = t.session_id AND t.price IS NULL;
+
+COMMIT;
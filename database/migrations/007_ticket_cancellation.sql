@@ -0,0 +1,36 @@
+-- Lets customers cancel tickets and keeps cancelled sessions around so their
+-- tickets can be refunded. Cancelled tickets free their seat for resale.
+BEGIN;
+
+ALTER TABLE cinema_sessions ADD COLUMN IF NOT EXISTS cancelled_at timestamptz;
+
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'active';
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS cancelled_at timestamptz;
+ALTER TABLE tickets DROP CONSTRAINT IF EXISTS tickets_status_check;
+ALTER TABLE tickets ADD CONSTRAINT tickets_status_check CHECK (status IN ('active', 'cancelled'));
+
+DROP INDEX IF EXISTS tickets_session_id_seat_number_idx;
+CREATE UNIQUE INDEX tickets_session_id_seat_number_idx ON tickets (session_id, seat_number)
+    WHERE status <> 'cancelled';
+
+CREATE TABLE IF NOT EXISTS refunds (
+    refund_id SERIAL PRIMARY KEY,
+    ticket_id INTEGER,
+    user_id INTEGER NOT NULL,
+    amount DECIMAL(5,2) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    reason VARCHAR(50) NOT NULL,
+    provider_ref VARCHAR(255),
+    failure VARCHAR(255),
+    created_at timestamptz NOT NULL DEFAULT now(),
+    updated_at timestamptz NOT NULL DEFAULT now(),
+    CONSTRAINT refunds_status_check CHECK (status IN ('pending', 'succeeded', 'failed')),
+    CONSTRAINT refunds_ticket_id_fkey FOREIGN KEY (ticket_id)
+        REFERENCES tickets (ticket_id) ON DELETE SET NULL,
+    CONSTRAINT refunds_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES users (user_id) ON DELETE RESTRICT
+);
+
+CREATE INDEX IF NOT EXISTS refunds_status_idx ON refunds (status);
+
+COMMIT;
@@ -0,0 +1,15 @@
+-- Adds the permission to list and view tickets of any user and grants it to
+-- the admin role.
+BEGIN;
+
+INSERT INTO permissions (permission_name)
+SELECT 'tickets:read'
+WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE permission_name = 'tickets:read');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.role_id, p.permission_id
+FROM roles r, permissions p
+WHERE r.role_name = 'admin' AND p.permission_name = 'tickets:read'
+ON CONFLICT DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,8 @@
+-- Remembers the storage key of the PDF of every ticket so the file can be
+-- downloaded again through a presigned URL. Tickets bought before this
+-- migration have no key.
+BEGIN;
+
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS pdf_key VARCHAR(100);
+
+COMMIT;
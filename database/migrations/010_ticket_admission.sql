@@ -0,0 +1,17 @@
+-- Records when a ticket was scanned at the door so it cannot be admitted
+-- twice, and adds the permission for staff to validate tickets.
+BEGIN;
+
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS admitted_at timestamptz;
+
+INSERT INTO permissions (permission_name)
+SELECT 'tickets:validate'
+WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE permission_name = 'tickets:validate');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.role_id, p.permission_id
+FROM roles r, permissions p
+WHERE r.role_name = 'admin' AND p.permission_name = 'tickets:validate'
+ON CONFLICT DO NOTHING;
+
+COMMIT;
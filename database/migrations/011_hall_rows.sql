@@ -0,0 +1,3 @@
+-- Stores how many seats a hall row has so tickets can print the row and seat.
+-- Halls without a layout keep 0 and tickets show only the seat number.
+ALTER TABLE halls ADD COLUMN IF NOT EXISTS seats_per_row INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,22 @@
+-- Queues emails that deliver ticket PDFs and calendar invites after a
+-- purchase. Failed deliveries are retried until they run out of attempts.
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS ticket_emails (
+    email_id SERIAL PRIMARY KEY,
+    pdf_key VARCHAR(100) NOT NULL,
+    recipient VARCHAR(50) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at timestamptz NOT NULL DEFAULT now(),
+    failure VARCHAR(255),
+    created_at timestamptz NOT NULL DEFAULT now(),
+    sent_at timestamptz,
+    CONSTRAINT ticket_emails_status_check CHECK (status IN ('pending', 'sent', 'failed'))
+);
+
+CREATE INDEX IF NOT EXISTS ticket_emails_status_idx ON ticket_emails (status, next_attempt_at);
+
+CREATE INDEX IF NOT EXISTS tickets_pdf_key_idx ON tickets (pdf_key);
+
+COMMIT;
@@ -0,0 +1,11 @@
+-- Retries failed refunds with a growing delay instead of giving up after the
+-- first failure, and lets workers of several instances claim refunds.
+BEGIN;
+
+ALTER TABLE refunds ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE refunds ADD COLUMN IF NOT EXISTS next_attempt_at timestamptz NOT NULL DEFAULT now();
+
+DROP INDEX IF EXISTS refunds_status_idx;
+CREATE INDEX refunds_status_idx ON refunds (status, next_attempt_at);
+
+COMMIT;
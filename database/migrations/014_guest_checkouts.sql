@@ -0,0 +1,13 @@
+-- Stores the email and the lookup code of tickets bought without an account.
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS guest_checkouts (
+    user_id INTEGER PRIMARY KEY,
+    email VARCHAR(50) NOT NULL,
+    lookup_code_hash VARCHAR(64) NOT NULL UNIQUE,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    CONSTRAINT guest_checkouts_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES users (user_id) ON DELETE CASCADE
+);
+
+COMMIT;
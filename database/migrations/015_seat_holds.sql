@@ -0,0 +1,18 @@
+-- Keeps seats held during checkout until they expire.
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS seat_holds (
+    session_id INTEGER NOT NULL,
+    seat_number INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    expires_at timestamptz NOT NULL,
+    PRIMARY KEY (session_id, seat_number),
+    CONSTRAINT seat_holds_session_id_fkey FOREIGN KEY (session_id)
+        REFERENCES cinema_sessions (session_id) ON DELETE CASCADE,
+    CONSTRAINT seat_holds_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES users (user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS seat_holds_expires_at_idx ON seat_holds (expires_at);
+
+COMMIT;
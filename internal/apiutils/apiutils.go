@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"log"
+	"net"
 	"net/http"
 	"strconv"
 
@@ -33,3 +34,12 @@ func WriteResponse(w http.ResponseWriter, data interface{}, statusCode int) {
 		http.Error(w, service.ErrInternalError.Error(), http.StatusInternalServerError)
 	}
 }
+
+// ClientIP returns the address the request came from without its port.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/apiutils"
+	authService "bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/auth/service"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+var (
+	ErrNoKeyName      = errors.New("missing api key name")
+	ErrInvalidKeyId   = errors.New("invalid api key id")
+	ErrInvalidExpires = errors.New("expiration time must be in the future")
+	ErrKeyByAPIKey    = errors.New("api keys cannot be created with an api key")
+	ErrKeyForOther    = errors.New("only administrators signed in with two-factor authentication " +
+		"can create api keys for other users")
+	ErrScopeNotHeld = errors.New("scope is not granted to the caller")
+)
+
+type apiKeyRequest struct {
+	Name      string     `json:"name"`
+	UserID    int        `json:"userId"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+type apiKey struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	UserID     int        `json:"userId"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+}
+
+type createdAPIKey struct {
+	apiKey
+	Key string `json:"key"`
+}
+
+func (h HttpHandler) getAPIKeysHandler(w http.ResponseWriter, _ *http.Request) {
+	keys, err := h.s.APIKeys()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	keysDTO := make([]apiKey, 0, len(keys))
+	for _, k := range keys {
+		keysDTO = append(keysDTO, apiKeyToDTO(k))
+	}
+
+	apiutils.WriteResponse(w, keysDTO, http.StatusOK)
+}
+
+func (h HttpHandler) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var req apiKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, ErrReadRequestFail.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Name == "" {
+		http.Error(w, ErrNoKeyName.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		http.Error(w, ErrInvalidExpires.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// A key must never grant more than its creator holds, otherwise anyone
+	// allowed to create keys could mint one with the permissions of an admin.
+	ctx := r.Context()
+	callerID, _ := ctx.Value("userID").(int)
+	perms, _ := ctx.Value("permissions").([]string)
+	roles, _ := ctx.Value("roles").([]string)
+	amr, _ := ctx.Value("amr").([]string)
+
+	if contains(amr, authService.AMRAPIKey) {
+		http.Error(w, ErrKeyByAPIKey.Error(), http.StatusForbidden)
+		return
+	}
+
+	if req.UserID == 0 {
+		req.UserID = callerID
+	}
+	if req.UserID != callerID &&
+		(!contains(roles, authService.MFARequiredRole) || !contains(amr, authService.AMRMFA)) {
+		http.Error(w, ErrKeyForOther.Error(), http.StatusForbidden)
+		return
+	}
+
+	if req.Scopes == nil {
+		req.Scopes = []string{}
+	}
+	for _, scope := range req.Scopes {
+		if !contains(perms, scope) {
+			http.Error(w, ErrScopeNotHeld.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
+	key, k, err := h.s.CreateAPIKey(req.Name, req.UserID, req.Scopes, req.ExpiresAt)
+	if errors.Is(err, authService.ErrInvalidScope) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if errors.Is(err, authService.ErrUserNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	apiutils.WriteResponse(w, createdAPIKey{apiKey: apiKeyToDTO(k), Key: key}, http.StatusCreated)
+}
+
+func (h HttpHandler) revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	keyId, err := apiutils.IntPathParam(r, "keyId")
+	if err != nil {
+		http.Error(w, ErrInvalidKeyId.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.s.RevokeAPIKey(keyId)
+	if errors.Is(err, authService.ErrAPIKeyNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func apiKeyToDTO(k authService.APIKey) apiKey {
+	return apiKey{
+		ID:         k.ID,
+		Name:       k.Name,
+		Prefix:     k.Prefix,
+		UserID:     k.UserID,
+		Scopes:     k.Scopes,
+		CreatedAt:  k.CreatedAt,
+		ExpiresAt:  k.ExpiresAt,
+		LastUsedAt: k.LastUsedAt,
+		RevokedAt:  k.RevokedAt,
+	}
+}
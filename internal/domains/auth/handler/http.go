@@ -2,17 +2,27 @@ package handler
 
 import (
 	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/apiutils"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/auth/keys"
+	authService "bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/auth/service"
+	"context"
 	"encoding/json"
 	"errors"
 	"github.com/gorilla/mux"
 	"io"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var (
 	ErrReadRequestFail = errors.New("failed to read request body")
 	ErrNoUsername      = errors.New("missing username")
 	ErrNoPassword      = errors.New("missing password")
+	ErrNoRefreshToken  = errors.New("missing refresh token")
+	ErrNoEmail         = errors.New("missing email")
+	ErrNoResetToken    = errors.New("missing password reset token")
 )
 
 type credentials struct {
@@ -20,23 +30,86 @@ type credentials struct {
 	Password string `json:"password"`
 }
 
+type refreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type passwordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type passwordResetConfirmation struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type tokens struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+}
+
 type service interface {
-	Authenticate(username string, passwordHash string) (token string, err error)
+	Authenticate(username string, password string, clientIP string) (authService.Tokens, error)
+	Refresh(refreshToken string) (authService.Tokens, error)
+	Logout(accessToken string, refreshToken string) error
+	RequestPasswordReset(email string) error
+	ResetPassword(token string, password string) error
+	VerifyMFA(mfaToken string, code string) (authService.Tokens, error)
+	EnrollTOTP(userID int) (authService.TOTPEnrollment, error)
+	ConfirmTOTP(userID int, code string) ([]string, error)
+	DisableTOTP(userID int, code string) error
+	CreateAPIKey(name string, userID int, scopes []string, expiresAt *time.Time) (string, authService.APIKey, error)
+	APIKeys() ([]authService.APIKey, error)
+	RevokeAPIKey(id int) error
+	Unlock(username string) error
+	StartOIDCLogin() (authURL string, stateToken string, err error)
+	CompleteOIDCLogin(ctx context.Context, stateToken, state, code string) (authService.Tokens, error)
+	JWKS() keys.JWKS
+}
+
+type accessChecker interface {
+	Authenticate(next http.Handler) http.Handler
+	CheckPerms(perms ...string) mux.MiddlewareFunc
 }
 
 type HttpHandler struct {
 	s service
 }
 
-func New(router *mux.Router, s service) HttpHandler {
-	handler := HttpHandler{s: s}
-	handler.setRoutes(router)
-
-	return handler
+func New(s service) HttpHandler {
+	return HttpHandler{s: s}
 }
 
-func (h HttpHandler) setRoutes(router *mux.Router) {
-	router.HandleFunc("/auth/", h.loginHandler).Methods("POST")
+func (h HttpHandler) SetRoutes(router *mux.Router, a accessChecker) {
+	router.HandleFunc("/.well-known/jwks.json", h.jwksHandler).Methods(http.MethodGet)
+
+	allRouter := router.PathPrefix("/auth").Subrouter()
+	allRouter.HandleFunc("/", h.loginHandler).Methods(http.MethodPost)
+	allRouter.HandleFunc("/refresh", h.refreshHandler).Methods(http.MethodPost)
+	allRouter.HandleFunc("/password-reset", h.passwordResetHandler).Methods(http.MethodPost)
+	allRouter.HandleFunc("/password-reset/confirm", h.confirmPasswordResetHandler).Methods(http.MethodPost)
+	allRouter.HandleFunc("/mfa/verify", h.verifyMFAHandler).Methods(http.MethodPost)
+	allRouter.HandleFunc("/oidc/login", h.oidcLoginHandler).Methods(http.MethodGet)
+	allRouter.HandleFunc("/oidc/callback", h.oidcCallbackHandler).Methods(http.MethodGet)
+
+	userRouter := router.PathPrefix("/auth").Subrouter()
+	userRouter.Use(a.Authenticate)
+	userRouter.HandleFunc("/logout", h.logoutHandler).Methods(http.MethodPost)
+	userRouter.HandleFunc("/mfa/totp", h.enrollTOTPHandler).Methods(http.MethodPost)
+	userRouter.HandleFunc("/mfa/totp/confirm", h.confirmTOTPHandler).Methods(http.MethodPost)
+	userRouter.HandleFunc("/mfa/totp", h.disableTOTPHandler).Methods(http.MethodDelete)
+
+	adminRouter := router.PathPrefix("/auth").Subrouter()
+	adminRouter.Use(a.Authenticate)
+	adminRouter.Use(a.CheckPerms(authService.UnlockPermission))
+	adminRouter.HandleFunc("/lockouts/{username}", h.unlockHandler).Methods(http.MethodDelete)
+
+	apiKeysRouter := router.PathPrefix("/api-keys").Subrouter()
+	apiKeysRouter.Use(a.Authenticate)
+	apiKeysRouter.Use(a.CheckPerms(authService.APIKeyPermission))
+	apiKeysRouter.HandleFunc("/", h.getAPIKeysHandler).Methods(http.MethodGet)
+	apiKeysRouter.HandleFunc("/", h.createAPIKeyHandler).Methods(http.MethodPost)
+	apiKeysRouter.HandleFunc("/{keyId}", h.revokeAPIKeyHandler).Methods(http.MethodDelete)
 }
 
 func (h HttpHandler) loginHandler(w http.ResponseWriter, r *http.Request) {
@@ -58,13 +131,164 @@ func (h HttpHandler) loginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := h.s.Authenticate(creds.Username, creds.Password)
+	t, err := h.s.Authenticate(creds.Username, creds.Password, apiutils.ClientIP(r))
+	setRetryAfter(w, err)
+
+	if errors.Is(err, authService.ErrAccountLocked) {
+		http.Error(w, "failed to authenticate: "+err.Error(), http.StatusLocked)
+		return
+	}
+
+	if errors.Is(err, authService.ErrTooManyAttempts) {
+		http.Error(w, "failed to authenticate: "+err.Error(), http.StatusTooManyRequests)
+		return
+	}
+
+	if errors.Is(err, authService.ErrAccountDisabled) {
+		http.Error(w, "failed to authenticate: "+err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if errors.Is(err, authService.ErrInternalError) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	if err != nil {
 		http.Error(w, "failed to authenticate: "+err.Error(), http.StatusUnauthorized)
 		return
 	}
 
-	apiutils.WriteResponse(w, map[string]string{"token": token}, http.StatusCreated)
+	if t.MFAToken != "" {
+		apiutils.WriteResponse(w, mfaChallenge{MFAToken: t.MFAToken}, http.StatusOK)
+		return
+	}
+
+	apiutils.WriteResponse(w, tokensToDTO(t), http.StatusCreated)
+}
+
+func (h HttpHandler) refreshHandler(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, ErrReadRequestFail.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.RefreshToken == "" {
+		http.Error(w, ErrNoRefreshToken.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t, err := h.s.Refresh(req.RefreshToken)
+	if errors.Is(err, authService.ErrInternalError) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, "failed to refresh token: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	apiutils.WriteResponse(w, tokensToDTO(t), http.StatusCreated)
+}
+
+func (h HttpHandler) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, ErrReadRequestFail.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	accessToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	err := h.s.Logout(accessToken, req.RefreshToken)
+	if errors.Is(err, authService.ErrInternalError) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, "failed to log out: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h HttpHandler) passwordResetHandler(w http.ResponseWriter, r *http.Request) {
+	var req passwordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, ErrReadRequestFail.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Email == "" {
+		http.Error(w, ErrNoEmail.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.s.RequestPasswordReset(req.Email); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h HttpHandler) confirmPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	var req passwordResetConfirmation
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, ErrReadRequestFail.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Token == "" {
+		http.Error(w, ErrNoResetToken.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Password == "" {
+		http.Error(w, ErrNoPassword.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := h.s.ResetPassword(req.Token, req.Password)
+	if errors.Is(err, authService.ErrInvalidResetToken) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h HttpHandler) unlockHandler(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+
+	err := h.s.Unlock(username)
+	if errors.Is(err, authService.ErrUserNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h HttpHandler) jwksHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	apiutils.WriteResponse(w, h.s.JWKS(), http.StatusOK)
 }
 
 func (c credentials) validate() error {
@@ -75,3 +299,17 @@ func (c credentials) validate() error {
 	}
 	return nil
 }
+
+func setRetryAfter(w http.ResponseWriter, err error) {
+	var retryErr authService.RetryError
+	if errors.As(err, &retryErr) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryErr.RetryAfter.Seconds()))))
+	}
+}
+
+func tokensToDTO(t authService.Tokens) tokens {
+	return tokens{
+		Token:        t.AccessToken,
+		RefreshToken: t.RefreshToken,
+	}
+}
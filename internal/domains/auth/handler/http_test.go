@@ -1,6 +1,9 @@
 package handler
 
 import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/auth/keys"
+	authService "bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/auth/service"
+	"context"
 	"errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -8,24 +11,90 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 type mockAuth struct {
-	token string
-	err   error
+	token        string
+	refreshToken string
+	mfaToken     string
+	err          error
 }
 
-func (m mockAuth) Authenticate(username string, password string) (string, error) {
-	return m.token, m.err
+func (m mockAuth) Authenticate(username string, password string, clientIP string) (authService.Tokens, error) {
+	return authService.Tokens{AccessToken: m.token, RefreshToken: m.refreshToken, MFAToken: m.mfaToken}, m.err
 }
-func (m mockAuth) VerifyToken(token string) (int, error) {
-	return 0, nil
+
+func (m mockAuth) VerifyMFA(mfaToken string, code string) (authService.Tokens, error) {
+	return authService.Tokens{AccessToken: m.token, RefreshToken: m.refreshToken}, m.err
+}
+
+func (m mockAuth) EnrollTOTP(userID int) (authService.TOTPEnrollment, error) {
+	return authService.TOTPEnrollment{Secret: "SECRET", URI: "otpauth://totp/Cinema:test?secret=SECRET"}, m.err
+}
+
+func (m mockAuth) ConfirmTOTP(userID int, code string) ([]string, error) {
+	return []string{"aaaa-bbbb-cccc-dddd"}, m.err
+}
+
+func (m mockAuth) DisableTOTP(userID int, code string) error {
+	return m.err
+}
+
+func (m mockAuth) CreateAPIKey(name string, userID int, scopes []string,
+	expiresAt *time.Time) (string, authService.APIKey, error) {
+	return "ck_abc_secret", authService.APIKey{ID: 1, Name: name, Prefix: "abc", UserID: userID, Scopes: scopes,
+		CreatedAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}, m.err
+}
+
+func (m mockAuth) APIKeys() ([]authService.APIKey, error) {
+	return nil, m.err
+}
+
+func (m mockAuth) RevokeAPIKey(id int) error {
+	return m.err
+}
+
+func (m mockAuth) Refresh(refreshToken string) (authService.Tokens, error) {
+	return authService.Tokens{AccessToken: m.token, RefreshToken: m.refreshToken}, m.err
+}
+
+func (m mockAuth) Logout(accessToken string, refreshToken string) error {
+	return m.err
+}
+
+func (m mockAuth) RequestPasswordReset(email string) error {
+	return m.err
+}
+
+func (m mockAuth) ResetPassword(token string, password string) error {
+	return m.err
+}
+
+func (m mockAuth) Unlock(username string) error {
+	return m.err
+}
+
+func (m mockAuth) StartOIDCLogin() (string, string, error) {
+	return "https://idp.example.com/authorize?state=abc", "state_token", m.err
+}
+
+func (m mockAuth) CompleteOIDCLogin(ctx context.Context, stateToken, state, code string) (authService.Tokens, error) {
+	if stateToken != "state_token" {
+		return authService.Tokens{}, authService.ErrInvalidOIDCState
+	}
+	return authService.Tokens{AccessToken: m.token, RefreshToken: m.refreshToken}, m.err
+}
+
+func (m mockAuth) JWKS() keys.JWKS {
+	return keys.JWKS{Keys: []keys.JWK{{Kty: "OKP", Use: "sig", Alg: "EdDSA", Kid: "test", Crv: "Ed25519", X: "AAAA"}}}
 }
 
 func TestLoginHandler(t *testing.T) {
 	auth := mockAuth{}
 	t.Run("successful authentication", func(t *testing.T) {
 		auth.token = "test_token"
+		auth.refreshToken = "test_refresh_token"
 		auth.err = nil
 		req, err := http.NewRequest(http.MethodPost, "auth/",
 			strings.NewReader(`{"username": "test_user", "password": "test_password"}`))
@@ -35,7 +104,7 @@ func TestLoginHandler(t *testing.T) {
 		handler := HttpHandler{s: auth}.loginHandler
 		handler(response, req)
 
-		assert.Equal(t, "{\"token\":\"test_token\"}\n", response.Body.String())
+		assert.Equal(t, "{\"token\":\"test_token\",\"refreshToken\":\"test_refresh_token\"}\n", response.Body.String())
 		assert.Equal(t, http.StatusCreated, response.Code)
 	})
 
@@ -95,4 +164,499 @@ func TestLoginHandler(t *testing.T) {
 		assert.Equal(t, "failed to authenticate: something went wrong\n", response.Body.String())
 		assert.Equal(t, http.StatusUnauthorized, response.Code)
 	})
+
+	t.Run("two-factor authentication required", func(t *testing.T) {
+		auth.err = nil
+		auth.mfaToken = "test_mfa_token"
+		defer func() { auth.mfaToken = "" }()
+		req, err := http.NewRequest(http.MethodPost, "auth/",
+			strings.NewReader(`{"username": "test_user", "password": "test_password"}`))
+		require.NoError(t, err, "failed to create test request")
+
+		response := httptest.NewRecorder()
+		handler := HttpHandler{s: auth}.loginHandler
+		handler(response, req)
+
+		assert.Equal(t, "{\"mfaToken\":\"test_mfa_token\"}\n", response.Body.String())
+		assert.Equal(t, http.StatusOK, response.Code)
+	})
+
+	t.Run("account locked", func(t *testing.T) {
+		auth.err = authService.RetryError{Err: authService.ErrAccountLocked, RetryAfter: 90500 * time.Millisecond}
+		req, err := http.NewRequest(http.MethodPost, "auth/",
+			strings.NewReader(`{"username": "test_user", "password": "test_password"}`))
+		require.NoError(t, err, "failed to create test request")
+
+		response := httptest.NewRecorder()
+		handler := HttpHandler{s: auth}.loginHandler
+		handler(response, req)
+
+		assert.Equal(t, http.StatusLocked, response.Code)
+		assert.Equal(t, "91", response.Header().Get("Retry-After"))
+	})
+
+	t.Run("account disabled", func(t *testing.T) {
+		auth.err = authService.ErrAccountDisabled
+		req, err := http.NewRequest(http.MethodPost, "auth/",
+			strings.NewReader(`{"username": "test_user", "password": "test_password"}`))
+		require.NoError(t, err, "failed to create test request")
+
+		response := httptest.NewRecorder()
+		handler := HttpHandler{s: auth}.loginHandler
+		handler(response, req)
+
+		assert.Equal(t, http.StatusForbidden, response.Code)
+	})
+
+	t.Run("too many attempts", func(t *testing.T) {
+		auth.err = authService.RetryError{Err: authService.ErrTooManyAttempts, RetryAfter: 2 * time.Second}
+		req, err := http.NewRequest(http.MethodPost, "auth/",
+			strings.NewReader(`{"username": "test_user", "password": "test_password"}`))
+		require.NoError(t, err, "failed to create test request")
+
+		response := httptest.NewRecorder()
+		handler := HttpHandler{s: auth}.loginHandler
+		handler(response, req)
+
+		assert.Equal(t, http.StatusTooManyRequests, response.Code)
+		assert.Equal(t, "2", response.Header().Get("Retry-After"))
+	})
+}
+
+func TestRefreshHandler(t *testing.T) {
+	auth := mockAuth{}
+	t.Run("successful refresh", func(t *testing.T) {
+		auth.token = "new_token"
+		auth.refreshToken = "new_refresh_token"
+		auth.err = nil
+		req, err := http.NewRequest(http.MethodPost, "auth/refresh",
+			strings.NewReader(`{"refreshToken": "test_refresh_token"}`))
+		require.NoError(t, err, "failed to create test request")
+
+		response := httptest.NewRecorder()
+		handler := HttpHandler{s: auth}.refreshHandler
+		handler(response, req)
+
+		assert.Equal(t, "{\"token\":\"new_token\",\"refreshToken\":\"new_refresh_token\"}\n", response.Body.String())
+		assert.Equal(t, http.StatusCreated, response.Code)
+	})
+
+	t.Run("no refresh token provided", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "auth/refresh", strings.NewReader(`{}`))
+		require.NoError(t, err, "failed to create test request")
+
+		response := httptest.NewRecorder()
+		handler := HttpHandler{s: auth}.refreshHandler
+		handler(response, req)
+
+		assert.Equal(t, ErrNoRefreshToken.Error()+"\n", response.Body.String())
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+	})
+
+	t.Run("revoked refresh token", func(t *testing.T) {
+		auth.err = authService.ErrRevokedToken
+		req, err := http.NewRequest(http.MethodPost, "auth/refresh",
+			strings.NewReader(`{"refreshToken": "test_refresh_token"}`))
+		require.NoError(t, err, "failed to create test request")
+
+		response := httptest.NewRecorder()
+		handler := HttpHandler{s: auth}.refreshHandler
+		handler(response, req)
+
+		assert.Equal(t, "failed to refresh token: token is revoked\n", response.Body.String())
+		assert.Equal(t, http.StatusUnauthorized, response.Code)
+	})
+}
+
+func TestLogoutHandler(t *testing.T) {
+	auth := mockAuth{}
+	t.Run("successful logout", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "auth/logout",
+			strings.NewReader(`{"refreshToken": "test_refresh_token"}`))
+		require.NoError(t, err, "failed to create test request")
+		req.Header.Set("Authorization", "Bearer test_token")
+
+		response := httptest.NewRecorder()
+		handler := HttpHandler{s: auth}.logoutHandler
+		handler(response, req)
+
+		assert.Equal(t, http.StatusNoContent, response.Code)
+	})
+
+	t.Run("logout without body", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "auth/logout", nil)
+		require.NoError(t, err, "failed to create test request")
+		req.Header.Set("Authorization", "Bearer test_token")
+
+		response := httptest.NewRecorder()
+		handler := HttpHandler{s: auth}.logoutHandler
+		handler(response, req)
+
+		assert.Equal(t, http.StatusNoContent, response.Code)
+	})
+
+	t.Run("internal error", func(t *testing.T) {
+		auth.err = authService.ErrInternalError
+		req, err := http.NewRequest(http.MethodPost, "auth/logout", nil)
+		require.NoError(t, err, "failed to create test request")
+		req.Header.Set("Authorization", "Bearer test_token")
+
+		response := httptest.NewRecorder()
+		handler := HttpHandler{s: auth}.logoutHandler
+		handler(response, req)
+
+		assert.Equal(t, authService.ErrInternalError.Error()+"\n", response.Body.String())
+		assert.Equal(t, http.StatusInternalServerError, response.Code)
+	})
+}
+
+func TestPasswordResetHandler(t *testing.T) {
+	auth := mockAuth{}
+	t.Run("reset requested", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "auth/password-reset",
+			strings.NewReader(`{"email": "test@example.com"}`))
+		require.NoError(t, err, "failed to create test request")
+
+		response := httptest.NewRecorder()
+		handler := HttpHandler{s: auth}.passwordResetHandler
+		handler(response, req)
+
+		assert.Equal(t, http.StatusAccepted, response.Code)
+	})
+
+	t.Run("no email provided", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "auth/password-reset", strings.NewReader(`{}`))
+		require.NoError(t, err, "failed to create test request")
+
+		response := httptest.NewRecorder()
+		handler := HttpHandler{s: auth}.passwordResetHandler
+		handler(response, req)
+
+		assert.Equal(t, ErrNoEmail.Error()+"\n", response.Body.String())
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+	})
+}
+
+func TestConfirmPasswordResetHandler(t *testing.T) {
+	auth := mockAuth{}
+	t.Run("password reset", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "auth/password-reset/confirm",
+			strings.NewReader(`{"token": "reset_token", "password": "new_password"}`))
+		require.NoError(t, err, "failed to create test request")
+
+		response := httptest.NewRecorder()
+		handler := HttpHandler{s: auth}.confirmPasswordResetHandler
+		handler(response, req)
+
+		assert.Equal(t, http.StatusNoContent, response.Code)
+	})
+
+	t.Run("no password provided", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "auth/password-reset/confirm",
+			strings.NewReader(`{"token": "reset_token"}`))
+		require.NoError(t, err, "failed to create test request")
+
+		response := httptest.NewRecorder()
+		handler := HttpHandler{s: auth}.confirmPasswordResetHandler
+		handler(response, req)
+
+		assert.Equal(t, ErrNoPassword.Error()+"\n", response.Body.String())
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		auth.err = authService.ErrInvalidResetToken
+		req, err := http.NewRequest(http.MethodPost, "auth/password-reset/confirm",
+			strings.NewReader(`{"token": "reset_token", "password": "new_password"}`))
+		require.NoError(t, err, "failed to create test request")
+
+		response := httptest.NewRecorder()
+		handler := HttpHandler{s: auth}.confirmPasswordResetHandler
+		handler(response, req)
+
+		assert.Equal(t, authService.ErrInvalidResetToken.Error()+"\n", response.Body.String())
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+	})
+}
+
+func TestJWKSHandler(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, ".well-known/jwks.json", nil)
+	require.NoError(t, err, "failed to create test request")
+
+	response := httptest.NewRecorder()
+	handler := HttpHandler{s: mockAuth{}}.jwksHandler
+	handler(response, req)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"keys":[{"kty":"OKP","use":"sig","alg":"EdDSA","kid":"test","crv":"Ed25519","x":"AAAA"}]}`,
+		response.Body.String())
+}
+
+func TestVerifyMFAHandler(t *testing.T) {
+	auth := mockAuth{token: "test_token", refreshToken: "test_refresh_token"}
+	t.Run("successful verification", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "auth/mfa/verify",
+			strings.NewReader(`{"mfaToken": "test_mfa_token", "code": "123456"}`))
+		require.NoError(t, err, "failed to create test request")
+
+		response := httptest.NewRecorder()
+		handler := HttpHandler{s: auth}.verifyMFAHandler
+		handler(response, req)
+
+		assert.Equal(t, "{\"token\":\"test_token\",\"refreshToken\":\"test_refresh_token\"}\n", response.Body.String())
+		assert.Equal(t, http.StatusCreated, response.Code)
+	})
+
+	t.Run("no code provided", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "auth/mfa/verify",
+			strings.NewReader(`{"mfaToken": "test_mfa_token"}`))
+		require.NoError(t, err, "failed to create test request")
+
+		response := httptest.NewRecorder()
+		handler := HttpHandler{s: auth}.verifyMFAHandler
+		handler(response, req)
+
+		assert.Equal(t, ErrNoCode.Error()+"\n", response.Body.String())
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+	})
+
+	t.Run("invalid code", func(t *testing.T) {
+		auth.err = authService.ErrInvalidMFACode
+		req, err := http.NewRequest(http.MethodPost, "auth/mfa/verify",
+			strings.NewReader(`{"mfaToken": "test_mfa_token", "code": "000000"}`))
+		require.NoError(t, err, "failed to create test request")
+
+		response := httptest.NewRecorder()
+		handler := HttpHandler{s: auth}.verifyMFAHandler
+		handler(response, req)
+
+		assert.Equal(t, http.StatusUnauthorized, response.Code)
+	})
+
+	t.Run("too many attempts", func(t *testing.T) {
+		auth.err = authService.RetryError{Err: authService.ErrTooManyAttempts, RetryAfter: time.Minute}
+		req, err := http.NewRequest(http.MethodPost, "auth/mfa/verify",
+			strings.NewReader(`{"mfaToken": "test_mfa_token", "code": "000000"}`))
+		require.NoError(t, err, "failed to create test request")
+
+		response := httptest.NewRecorder()
+		handler := HttpHandler{s: auth}.verifyMFAHandler
+		handler(response, req)
+
+		assert.Equal(t, http.StatusTooManyRequests, response.Code)
+		assert.Equal(t, "60", response.Header().Get("Retry-After"))
+	})
+}
+
+func TestConfirmTOTPHandler(t *testing.T) {
+	auth := mockAuth{}
+	t.Run("successful confirmation", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "auth/mfa/totp/confirm", strings.NewReader(`{"code": "123456"}`))
+		require.NoError(t, err, "failed to create test request")
+		req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+
+		response := httptest.NewRecorder()
+		handler := HttpHandler{s: auth}.confirmTOTPHandler
+		handler(response, req)
+
+		assert.Equal(t, "{\"recoveryCodes\":[\"aaaa-bbbb-cccc-dddd\"]}\n", response.Body.String())
+		assert.Equal(t, http.StatusOK, response.Code)
+	})
+
+	t.Run("already enabled", func(t *testing.T) {
+		auth.err = authService.ErrTOTPAlreadyEnabled
+		req, err := http.NewRequest(http.MethodPost, "auth/mfa/totp/confirm", strings.NewReader(`{"code": "123456"}`))
+		require.NoError(t, err, "failed to create test request")
+		req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+
+		response := httptest.NewRecorder()
+		handler := HttpHandler{s: auth}.confirmTOTPHandler
+		handler(response, req)
+
+		assert.Equal(t, http.StatusConflict, response.Code)
+	})
+}
+
+func TestCreateAPIKeyHandler(t *testing.T) {
+	auth := mockAuth{}
+	caller := func(req *http.Request, roles, perms, amr []string) *http.Request {
+		ctx := context.WithValue(req.Context(), "userID", 1)
+		ctx = context.WithValue(ctx, "roles", roles)
+		ctx = context.WithValue(ctx, "permissions", perms)
+		ctx = context.WithValue(ctx, "amr", amr)
+		return req.WithContext(ctx)
+	}
+	perms := []string{"apikeys:write", "sessions:write"}
+	admin := []string{authService.MFARequiredRole}
+	mfa := []string{authService.AMRPassword, authService.AMROTP, authService.AMRMFA}
+
+	t.Run("successful creation", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "api-keys/",
+			strings.NewReader(`{"name": "kiosk", "scopes": ["sessions:write"]}`))
+		require.NoError(t, err, "failed to create test request")
+		req = caller(req, nil, perms, []string{authService.AMRPassword})
+
+		response := httptest.NewRecorder()
+		handler := HttpHandler{s: auth}.createAPIKeyHandler
+		handler(response, req)
+
+		assert.Equal(t, http.StatusCreated, response.Code)
+		assert.JSONEq(t, `{"id":1,"name":"kiosk","prefix":"abc","userId":1,"scopes":["sessions:write"],
+			"createdAt":"2026-01-01T00:00:00Z","key":"ck_abc_secret"}`, response.Body.String())
+	})
+
+	t.Run("no name provided", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "api-keys/", strings.NewReader(`{"scopes": []}`))
+		require.NoError(t, err, "failed to create test request")
+
+		response := httptest.NewRecorder()
+		handler := HttpHandler{s: auth}.createAPIKeyHandler
+		handler(response, req)
+
+		assert.Equal(t, ErrNoKeyName.Error()+"\n", response.Body.String())
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+	})
+
+	tests := []struct {
+		name  string
+		body  string
+		roles []string
+		amr   []string
+		code  int
+		err   error
+	}{
+		{
+			name: "scope not held by the caller",
+			body: `{"name": "kiosk", "scopes": ["halls:write"]}`,
+			amr:  []string{authService.AMRPassword},
+			code: http.StatusForbidden,
+			err:  ErrScopeNotHeld,
+		},
+		{
+			name: "caller authenticated with an api key",
+			body: `{"name": "kiosk", "scopes": ["sessions:write"]}`,
+			amr:  []string{authService.AMRAPIKey},
+			code: http.StatusForbidden,
+			err:  ErrKeyByAPIKey,
+		},
+		{
+			name: "key for another user without admin role",
+			body: `{"name": "kiosk", "userId": 2, "scopes": ["sessions:write"]}`,
+			amr:  mfa,
+			code: http.StatusForbidden,
+			err:  ErrKeyForOther,
+		},
+		{
+			name:  "key for another user without two-factor authentication",
+			body:  `{"name": "kiosk", "userId": 2, "scopes": ["sessions:write"]}`,
+			roles: admin,
+			amr:   []string{authService.AMRPassword},
+			code:  http.StatusForbidden,
+			err:   ErrKeyForOther,
+		},
+		{
+			name:  "key for another user by an admin with two-factor authentication",
+			body:  `{"name": "kiosk", "userId": 2, "scopes": ["sessions:write"]}`,
+			roles: admin,
+			amr:   mfa,
+			code:  http.StatusCreated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "api-keys/", strings.NewReader(tt.body))
+			require.NoError(t, err, "failed to create test request")
+			req = caller(req, tt.roles, perms, tt.amr)
+
+			response := httptest.NewRecorder()
+			handler := HttpHandler{s: auth}.createAPIKeyHandler
+			handler(response, req)
+
+			assert.Equal(t, tt.code, response.Code)
+			if tt.err != nil {
+				assert.Equal(t, tt.err.Error()+"\n", response.Body.String())
+			}
+		})
+	}
+
+	t.Run("scope not granted to the owner", func(t *testing.T) {
+		auth.err = authService.ErrInvalidScope
+		req, err := http.NewRequest(http.MethodPost, "api-keys/",
+			strings.NewReader(`{"name": "kiosk", "userId": 2, "scopes": ["sessions:write"]}`))
+		require.NoError(t, err, "failed to create test request")
+		req = caller(req, admin, perms, mfa)
+
+		response := httptest.NewRecorder()
+		handler := HttpHandler{s: auth}.createAPIKeyHandler
+		handler(response, req)
+
+		assert.Equal(t, authService.ErrInvalidScope.Error()+"\n", response.Body.String())
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+	})
+}
+
+func TestOIDCLoginHandler(t *testing.T) {
+	t.Run("redirect to provider", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/auth/oidc/login", nil)
+
+		response := httptest.NewRecorder()
+		HttpHandler{s: mockAuth{}}.oidcLoginHandler(response, req)
+
+		assert.Equal(t, http.StatusFound, response.Code)
+		assert.Equal(t, "https://idp.example.com/authorize?state=abc", response.Header().Get("Location"))
+
+		cookies := response.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, "state_token", cookies[0].Value)
+		assert.True(t, cookies[0].HttpOnly)
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/auth/oidc/login", nil)
+
+		response := httptest.NewRecorder()
+		HttpHandler{s: mockAuth{err: authService.ErrOIDCNotConfigured}}.oidcLoginHandler(response, req)
+
+		assert.Equal(t, http.StatusNotFound, response.Code)
+	})
+}
+
+func TestOIDCCallbackHandler(t *testing.T) {
+	auth := mockAuth{token: "test_token", refreshToken: "test_refresh_token"}
+
+	tests := []struct {
+		name   string
+		query  string
+		cookie string
+		err    error
+		code   int
+	}{
+		{name: "successful login", query: "?state=abc&code=xyz", cookie: "state_token", code: http.StatusCreated},
+		{name: "missing cookie", query: "?state=abc&code=xyz", code: http.StatusBadRequest},
+		{name: "missing code", query: "?state=abc", cookie: "state_token", code: http.StatusBadRequest},
+		{name: "invalid state", query: "?state=abc&code=xyz", cookie: "forged", code: http.StatusBadRequest},
+		{name: "provider error", query: "?error=access_denied&state=abc", cookie: "state_token",
+			code: http.StatusUnauthorized},
+		{name: "exchange failed", query: "?state=abc&code=xyz", cookie: "state_token",
+			err: authService.ErrInvalidToken, code: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth.err = tt.err
+			req := httptest.NewRequest(http.MethodGet, "/auth/oidc/callback"+tt.query, nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: tt.cookie})
+			}
+
+			response := httptest.NewRecorder()
+			HttpHandler{s: auth}.oidcCallbackHandler(response, req)
+
+			assert.Equal(t, tt.code, response.Code)
+			if tt.code == http.StatusCreated {
+				assert.Contains(t, response.Body.String(), "test_token")
+			}
+		})
+	}
 }
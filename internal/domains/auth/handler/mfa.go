@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/apiutils"
+	authService "bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/auth/service"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+var (
+	ErrNoMFAToken = errors.New("missing mfa token")
+	ErrNoCode     = errors.New("missing authentication code")
+)
+
+type mfaChallenge struct {
+	MFAToken string `json:"mfaToken"`
+}
+
+type mfaVerification struct {
+	MFAToken string `json:"mfaToken"`
+	Code     string `json:"code"`
+}
+
+type codeRequest struct {
+	Code string `json:"code"`
+}
+
+type totpEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type recoveryCodes struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+func (h HttpHandler) verifyMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var req mfaVerification
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, ErrReadRequestFail.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.MFAToken == "" {
+		http.Error(w, ErrNoMFAToken.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Code == "" {
+		http.Error(w, ErrNoCode.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t, err := h.s.VerifyMFA(req.MFAToken, req.Code)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+
+	apiutils.WriteResponse(w, tokensToDTO(t), http.StatusCreated)
+}
+
+func (h HttpHandler) enrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	enrollment, err := h.s.EnrollTOTP(userID)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+
+	apiutils.WriteResponse(w, totpEnrollment{Secret: enrollment.Secret, URI: enrollment.URI}, http.StatusCreated)
+}
+
+func (h HttpHandler) confirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	var req codeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, ErrReadRequestFail.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Code == "" {
+		http.Error(w, ErrNoCode.Error(), http.StatusBadRequest)
+		return
+	}
+
+	codes, err := h.s.ConfirmTOTP(userID, req.Code)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+
+	apiutils.WriteResponse(w, recoveryCodes{RecoveryCodes: codes}, http.StatusOK)
+}
+
+func (h HttpHandler) disableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	var req codeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, ErrReadRequestFail.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.s.DisableTOTP(userID, req.Code); err != nil {
+		writeMFAError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeMFAError(w http.ResponseWriter, err error) {
+	setRetryAfter(w, err)
+
+	switch {
+	case errors.Is(err, authService.ErrTooManyAttempts):
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+	case errors.Is(err, authService.ErrTOTPAlreadyEnabled):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, authService.ErrTOTPNotFound), errors.Is(err, authService.ErrUserNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, authService.ErrInternalError):
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		http.Error(w, "failed to authenticate: "+err.Error(), http.StatusUnauthorized)
+	}
+}
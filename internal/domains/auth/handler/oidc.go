@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/apiutils"
+	authService "bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/auth/service"
+	"errors"
+	"net/http"
+)
+
+const oidcStateCookie = "oidc_state"
+
+var (
+	ErrNoState    = errors.New("missing login state")
+	ErrNoAuthCode = errors.New("missing authorization code")
+)
+
+func (h HttpHandler) oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	authURL, stateToken, err := h.s.StartOIDCLogin()
+	if err != nil {
+		writeOIDCError(w, err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    stateToken,
+		Path:     "/auth/oidc",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+func (h HttpHandler) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if idpErr := query.Get("error"); idpErr != "" {
+		http.Error(w, "identity provider returned an error: "+idpErr, http.StatusUnauthorized)
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || query.Get("state") == "" {
+		http.Error(w, ErrNoState.Error(), http.StatusBadRequest)
+		return
+	}
+
+	code := query.Get("code")
+	if code == "" {
+		http.Error(w, ErrNoAuthCode.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/auth/oidc", MaxAge: -1})
+
+	t, err := h.s.CompleteOIDCLogin(r.Context(), cookie.Value, query.Get("state"), code)
+	if err != nil {
+		writeOIDCError(w, err)
+		return
+	}
+
+	apiutils.WriteResponse(w, tokensToDTO(t), http.StatusCreated)
+}
+
+func writeOIDCError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, authService.ErrOIDCNotConfigured):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, authService.ErrAccountDisabled):
+		http.Error(w, "failed to authenticate: "+err.Error(), http.StatusForbidden)
+	case errors.Is(err, authService.ErrInvalidOIDCState):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, authService.ErrInternalError):
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		http.Error(w, "failed to authenticate: "+err.Error(), http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,224 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrNoSigningKey       = errors.New("no signing key")
+	ErrUnknownKey         = errors.New("unknown key id")
+	ErrInvalidMethod      = errors.New("signing method does not match the key")
+	ErrUnsupportedKeyType = errors.New("unsupported key type")
+)
+
+const keyFileExt = ".pem"
+
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	signer interface{}
+	public interface{}
+}
+
+func (k Key) canSign() bool {
+	return k.signer != nil
+}
+
+type Set struct {
+	signing Key
+	keys    map[string]Key
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func NewHMAC(id string, secret []byte) Set {
+	key := Key{
+		ID:     id,
+		Method: jwt.SigningMethodHS256,
+		signer: secret,
+		public: secret,
+	}
+	return Set{
+		signing: key,
+		keys:    map[string]Key{id: key},
+	}
+}
+
+func LoadDir(dir string, signingKeyID string) (Set, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return Set{}, fmt.Errorf("failed to read keys directory: %w", err)
+	}
+
+	set := Set{keys: map[string]Key{}}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != keyFileExt {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return Set{}, fmt.Errorf("failed to read key %q: %w", entry.Name(), err)
+		}
+
+		id := strings.TrimSuffix(entry.Name(), keyFileExt)
+		key, err := ParsePEM(id, data)
+		if err != nil {
+			return Set{}, err
+		}
+		set.keys[id] = key
+	}
+
+	if signingKeyID == "" {
+		signingKeyID, err = onlySigningKey(set.keys)
+		if err != nil {
+			return Set{}, err
+		}
+	}
+
+	signing, ok := set.keys[signingKeyID]
+	if !ok || !signing.canSign() {
+		return Set{}, fmt.Errorf("%w: private key %q was not found", ErrNoSigningKey, signingKeyID)
+	}
+	set.signing = signing
+
+	return set, nil
+}
+
+func ParsePEM(id string, data []byte) (Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, fmt.Errorf("key %q is not PEM encoded", id)
+	}
+
+	var (
+		parsed interface{}
+		err    error
+	)
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return Key{}, fmt.Errorf("%w: %q in key %q", ErrUnsupportedKeyType, block.Type, id)
+	}
+	if err != nil {
+		return Key{}, fmt.Errorf("failed to parse key %q: %w", id, err)
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		return Key{ID: id, Method: jwt.SigningMethodRS256, signer: k, public: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		return Key{ID: id, Method: jwt.SigningMethodRS256, public: k}, nil
+	case ed25519.PrivateKey:
+		return Key{ID: id, Method: jwt.SigningMethodEdDSA, signer: k, public: k.Public()}, nil
+	case ed25519.PublicKey:
+		return Key{ID: id, Method: jwt.SigningMethodEdDSA, public: k}, nil
+	default:
+		return Key{}, fmt.Errorf("%w: %T in key %q", ErrUnsupportedKeyType, parsed, id)
+	}
+}
+
+func (s Set) Sign(claims jwt.Claims) (string, error) {
+	if !s.signing.canSign() {
+		return "", ErrNoSigningKey
+	}
+
+	token := jwt.NewWithClaims(s.signing.Method, claims)
+	token.Header["kid"] = s.signing.ID
+
+	return token.SignedString(s.signing.signer)
+}
+
+func (s Set) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, ErrInvalidMethod
+	}
+
+	return key.public, nil
+}
+
+func (s Set) JWKS() JWKS {
+	ids := make([]string, 0, len(s.keys))
+	for id := range s.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	jwks := JWKS{Keys: []JWK{}}
+	for _, id := range ids {
+		key := s.keys[id]
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				Kty: "RSA",
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				Kid: key.ID,
+				N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				Kty: "OKP",
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				Kid: key.ID,
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+
+	return jwks
+}
+
+func onlySigningKey(keys map[string]Key) (string, error) {
+	var found []string
+	for id, key := range keys {
+		if key.canSign() {
+			found = append(found, id)
+		}
+	}
+
+	if len(found) != 1 {
+		return "", fmt.Errorf("%w: expected exactly one private key, found %d", ErrNoSigningKey, len(found))
+	}
+
+	return found[0], nil
+}
@@ -0,0 +1,147 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeKey(t *testing.T, dir, name, blockType string, der []byte) {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0600))
+}
+
+func newKeysDir(t *testing.T) string {
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	writeKey(t, dir, "rsa-1.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+	writeKey(t, dir, "ed-1.pem", "PRIVATE KEY", der)
+
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err = x509.MarshalPKIXPublicKey(&oldKey.PublicKey)
+	require.NoError(t, err)
+	writeKey(t, dir, "rsa-0.pem", "PUBLIC KEY", der)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README"), []byte("not a key"), 0600))
+
+	return dir
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := newKeysDir(t)
+
+	t.Run("signing key is selected by id", func(t *testing.T) {
+		set, err := LoadDir(dir, "ed-1")
+		require.NoError(t, err)
+		assert.Equal(t, "ed-1", set.signing.ID)
+		assert.Equal(t, jwt.SigningMethodEdDSA, set.signing.Method)
+		assert.Len(t, set.keys, 3)
+	})
+
+	t.Run("several private keys require signing key id", func(t *testing.T) {
+		_, err := LoadDir(dir, "")
+		assert.ErrorIs(t, err, ErrNoSigningKey)
+	})
+
+	t.Run("public key can not be used for signing", func(t *testing.T) {
+		_, err := LoadDir(dir, "rsa-0")
+		assert.ErrorIs(t, err, ErrNoSigningKey)
+	})
+
+	t.Run("missing directory", func(t *testing.T) {
+		_, err := LoadDir(filepath.Join(dir, "missing"), "")
+		assert.Error(t, err)
+	})
+}
+
+func TestSignAndVerify(t *testing.T) {
+	dir := newKeysDir(t)
+
+	for _, kid := range []string{"rsa-1", "ed-1"} {
+		t.Run(kid, func(t *testing.T) {
+			set, err := LoadDir(dir, kid)
+			require.NoError(t, err)
+
+			signed, err := set.Sign(jwt.MapClaims{"user_id": 1})
+			require.NoError(t, err)
+
+			token, err := jwt.Parse(signed, set.Keyfunc)
+			require.NoError(t, err)
+			assert.True(t, token.Valid)
+			assert.Equal(t, kid, token.Header["kid"])
+		})
+	}
+
+	t.Run("token signed by rotated key is still valid", func(t *testing.T) {
+		old, err := LoadDir(dir, "rsa-1")
+		require.NoError(t, err)
+		signed, err := old.Sign(jwt.MapClaims{"user_id": 1})
+		require.NoError(t, err)
+
+		current, err := LoadDir(dir, "ed-1")
+		require.NoError(t, err)
+		_, err = jwt.Parse(signed, current.Keyfunc)
+		assert.NoError(t, err)
+	})
+
+	t.Run("unknown key id", func(t *testing.T) {
+		set, err := LoadDir(dir, "ed-1")
+		require.NoError(t, err)
+
+		other := NewHMAC("other", []byte("secret"))
+		signed, err := other.Sign(jwt.MapClaims{"user_id": 1})
+		require.NoError(t, err)
+
+		_, err = jwt.Parse(signed, set.Keyfunc)
+		assert.ErrorIs(t, err, ErrUnknownKey)
+	})
+
+	t.Run("algorithm confusion is rejected", func(t *testing.T) {
+		set, err := LoadDir(dir, "rsa-1")
+		require.NoError(t, err)
+
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": 1})
+		token.Header["kid"] = "rsa-1"
+		signed, err := token.SignedString([]byte("secret"))
+		require.NoError(t, err)
+
+		_, err = jwt.Parse(signed, set.Keyfunc)
+		assert.ErrorIs(t, err, ErrInvalidMethod)
+	})
+}
+
+func TestJWKS(t *testing.T) {
+	set, err := LoadDir(newKeysDir(t), "ed-1")
+	require.NoError(t, err)
+
+	jwks := set.JWKS()
+	require.Len(t, jwks.Keys, 3)
+
+	assert.Equal(t, "ed-1", jwks.Keys[0].Kid)
+	assert.Equal(t, "OKP", jwks.Keys[0].Kty)
+	assert.Equal(t, "Ed25519", jwks.Keys[0].Crv)
+	assert.NotEmpty(t, jwks.Keys[0].X)
+
+	assert.Equal(t, "rsa-0", jwks.Keys[1].Kid)
+	assert.Equal(t, "RSA", jwks.Keys[1].Kty)
+	assert.Equal(t, "RS256", jwks.Keys[1].Alg)
+	assert.Equal(t, "AQAB", jwks.Keys[1].E)
+
+	assert.Empty(t, NewHMAC("default", []byte("secret")).JWKS().Keys, "symmetric keys must not be published")
+}
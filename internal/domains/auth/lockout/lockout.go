@@ -0,0 +1,142 @@
+package lockout
+
+import (
+	"sync"
+	"time"
+)
+
+type Attempts struct {
+	Failures    int
+	LockedUntil time.Time
+}
+
+type Store interface {
+	Attempts(key string) (Attempts, error)
+	AddFailure(key string, since time.Time) (failures int, err error)
+	Lock(key string, until time.Time) error
+	ResetAttempts(key string) error
+}
+
+type Policy struct {
+	MaxFailures int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Window      time.Duration
+}
+
+type Limiter struct {
+	store  Store
+	policy Policy
+}
+
+func New(store Store, policy Policy) Limiter {
+	return Limiter{
+		store:  store,
+		policy: policy,
+	}
+}
+
+func (l Limiter) Check(key string) (retryAfter time.Duration, err error) {
+	attempts, err := l.store.Attempts(key)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Until(attempts.LockedUntil), nil
+}
+
+func (l Limiter) Fail(key string) (retryAfter time.Duration, err error) {
+	now := time.Now()
+	failures, err := l.store.AddFailure(key, now.Add(-l.policy.Window))
+	if err != nil {
+		return 0, err
+	}
+
+	if failures < l.policy.MaxFailures {
+		return 0, nil
+	}
+
+	delay := l.delay(failures)
+	if err = l.store.Lock(key, now.Add(delay)); err != nil {
+		return 0, err
+	}
+
+	return delay, nil
+}
+
+func (l Limiter) Reset(key string) error {
+	return l.store.ResetAttempts(key)
+}
+
+func (l Limiter) delay(failures int) time.Duration {
+	delay := l.policy.BaseDelay
+	for i := l.policy.MaxFailures; i < failures; i++ {
+		delay *= 2
+		if delay >= l.policy.MaxDelay {
+			return l.policy.MaxDelay
+		}
+	}
+	return delay
+}
+
+type MemoryStore struct {
+	mu       sync.Mutex
+	attempts map[string]*memoryAttempts
+}
+
+type memoryAttempts struct {
+	Attempts
+	lastFailure time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{attempts: map[string]*memoryAttempts{}}
+}
+
+func (m *MemoryStore) Attempts(key string) (Attempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, ok := m.attempts[key]
+	if !ok {
+		return Attempts{}, nil
+	}
+	return a.Attempts, nil
+}
+
+func (m *MemoryStore) AddFailure(key string, since time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, ok := m.attempts[key]
+	if !ok {
+		a = &memoryAttempts{}
+		m.attempts[key] = a
+	}
+
+	if a.lastFailure.Before(since) {
+		a.Failures = 0
+	}
+	a.Failures++
+	a.lastFailure = time.Now()
+
+	return a.Failures, nil
+}
+
+func (m *MemoryStore) Lock(key string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if a, ok := m.attempts[key]; ok {
+		a.LockedUntil = until
+	}
+	return nil
+}
+
+func (m *MemoryStore) ResetAttempts(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.attempts, key)
+	return nil
+}
@@ -0,0 +1,92 @@
+package lockout
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	policy := Policy{
+		MaxFailures: 3,
+		BaseDelay:   time.Minute,
+		MaxDelay:    5 * time.Minute,
+		Window:      time.Hour,
+	}
+
+	t.Run("key is locked after max failures", func(t *testing.T) {
+		l := New(NewMemoryStore(), policy)
+
+		for i := 0; i < 2; i++ {
+			retryAfter, err := l.Fail("user")
+			require.NoError(t, err)
+			assert.Zero(t, retryAfter)
+		}
+
+		retryAfter, err := l.Check("user")
+		require.NoError(t, err)
+		assert.LessOrEqual(t, retryAfter, time.Duration(0))
+
+		retryAfter, err = l.Fail("user")
+		require.NoError(t, err)
+		assert.Equal(t, time.Minute, retryAfter)
+
+		retryAfter, err = l.Check("user")
+		require.NoError(t, err)
+		assert.Greater(t, retryAfter, 59*time.Second)
+	})
+
+	t.Run("delay grows exponentially up to the limit", func(t *testing.T) {
+		l := New(NewMemoryStore(), policy)
+
+		var delays []time.Duration
+		for i := 0; i < 7; i++ {
+			retryAfter, err := l.Fail("user")
+			require.NoError(t, err)
+			delays = append(delays, retryAfter)
+		}
+
+		assert.Equal(t, []time.Duration{0, 0, time.Minute, 2 * time.Minute, 4 * time.Minute,
+			5 * time.Minute, 5 * time.Minute}, delays)
+	})
+
+	t.Run("reset unlocks key", func(t *testing.T) {
+		l := New(NewMemoryStore(), policy)
+		for i := 0; i < 3; i++ {
+			_, err := l.Fail("user")
+			require.NoError(t, err)
+		}
+
+		require.NoError(t, l.Reset("user"))
+
+		retryAfter, err := l.Check("user")
+		require.NoError(t, err)
+		assert.LessOrEqual(t, retryAfter, time.Duration(0))
+	})
+
+	t.Run("old failures are forgotten", func(t *testing.T) {
+		p := policy
+		p.Window = 0
+		l := New(NewMemoryStore(), p)
+
+		for i := 0; i < 5; i++ {
+			retryAfter, err := l.Fail("user")
+			require.NoError(t, err)
+			assert.Zero(t, retryAfter)
+			time.Sleep(time.Millisecond)
+		}
+	})
+
+	t.Run("keys are independent", func(t *testing.T) {
+		l := New(NewMemoryStore(), policy)
+		for i := 0; i < 3; i++ {
+			_, err := l.Fail("user")
+			require.NoError(t, err)
+		}
+
+		retryAfter, err := l.Check("other")
+		require.NoError(t, err)
+		assert.LessOrEqual(t, retryAfter, time.Duration(0))
+	})
+}
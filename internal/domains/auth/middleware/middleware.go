@@ -1,6 +1,7 @@
 package authmw
 
 import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/auth/service"
 	"context"
 	"fmt"
 	"github.com/gorilla/mux"
@@ -9,8 +10,8 @@ import (
 )
 
 type auth interface {
-	VerifyToken(token string) (userID int, err error)
-	UserPermissions(id int) (string, error)
+	VerifyToken(token string) (service.Claims, error)
+	VerifyAPIKey(key string) (service.Claims, error)
 }
 
 type AccessChecker struct {
@@ -25,25 +26,38 @@ func New(a auth) AccessChecker {
 
 func (a AccessChecker) Authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "authorization header required", http.StatusUnauthorized)
-			return
-		}
+		var (
+			claims service.Claims
+			err    error
+		)
 
-		token := strings.TrimPrefix(authHeader, "Bearer ")
-		if token == authHeader {
-			http.Error(w, "invalid authorization header", http.StatusBadRequest)
-			return
+		if apiKey := r.Header.Get("X-API-Key"); apiKey != "" {
+			claims, err = a.a.VerifyAPIKey(apiKey)
+		} else {
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" {
+				http.Error(w, "authorization header required", http.StatusUnauthorized)
+				return
+			}
+
+			token := strings.TrimPrefix(authHeader, "Bearer ")
+			if token == authHeader {
+				http.Error(w, "invalid authorization header", http.StatusBadRequest)
+				return
+			}
+
+			claims, err = a.a.VerifyToken(token)
 		}
 
-		userID, err := a.a.VerifyToken(token)
 		if err != nil {
 			http.Error(w, fmt.Sprintln("could not authorize:", err), http.StatusUnauthorized)
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), "userID", userID)
+		ctx := context.WithValue(r.Context(), "userID", claims.UserID)
+		ctx = context.WithValue(ctx, "permissions", claims.Permissions)
+		ctx = context.WithValue(ctx, "roles", claims.Roles)
+		ctx = context.WithValue(ctx, "amr", claims.AMR)
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -52,10 +66,8 @@ func (a AccessChecker) Authenticate(next http.Handler) http.Handler {
 func (a AccessChecker) CheckPerms(perms ...string) mux.MiddlewareFunc {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			userID := r.Context().Value("userID").(int)
-
-			userPermissions, err := a.a.UserPermissions(userID)
-			if err != nil {
+			userPermissions, ok := r.Context().Value("permissions").([]string)
+			if !ok {
 				http.Error(w, "failed to get user permissions", http.StatusInternalServerError)
 				return
 			}
@@ -65,14 +77,30 @@ func (a AccessChecker) CheckPerms(perms ...string) mux.MiddlewareFunc {
 				return
 			}
 
+			roles, _ := r.Context().Value("roles").([]string)
+			amr, _ := r.Context().Value("amr").([]string)
+			if contains(roles, service.MFARequiredRole) && !contains(amr, service.AMRMFA) {
+				http.Error(w, "two-factor authentication required", http.StatusForbidden)
+				return
+			}
+
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
-func hasPermissions(userPerms string, reqPerms []string) bool {
-	for _, word := range reqPerms {
-		if word == userPerms {
+func hasPermissions(userPerms []string, reqPerms []string) bool {
+	for _, required := range reqPerms {
+		if contains(userPerms, required) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
 			return true
 		}
 	}
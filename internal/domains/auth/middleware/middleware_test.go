@@ -0,0 +1,136 @@
+package authmw
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/auth/service"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type mockAuth struct {
+	claims service.Claims
+	err    error
+}
+
+func (m mockAuth) VerifyToken(token string) (service.Claims, error) {
+	return m.claims, m.err
+}
+
+func (m mockAuth) VerifyAPIKey(key string) (service.Claims, error) {
+	if key != "ck_valid_key" {
+		return service.Claims{}, service.ErrInvalidAPIKey
+	}
+	return service.Claims{UserID: 2, Permissions: []string{"sessions:write"}}, nil
+}
+
+func TestCheckPerms(t *testing.T) {
+	a := mockAuth{claims: service.Claims{UserID: 1, Permissions: []string{"movies:write"}}}
+	checker := New(a)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name  string
+		perms []string
+		code  int
+	}{
+		{name: "permission granted", perms: []string{"movies:write"}, code: http.StatusOK},
+		{name: "one of permissions granted", perms: []string{"halls:write", "movies:write"}, code: http.StatusOK},
+		{name: "insufficient permissions", perms: []string{"halls:write"}, code: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/movies/", nil)
+			req.Header.Set("Authorization", "Bearer token")
+
+			response := httptest.NewRecorder()
+			checker.Authenticate(checker.CheckPerms(tt.perms...)(ok)).ServeHTTP(response, req)
+
+			assert.Equal(t, tt.code, response.Code)
+		})
+	}
+}
+
+func TestCheckPermsRequiresMFA(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		claims service.Claims
+		code   int
+	}{
+		{
+			name: "admin without MFA",
+			claims: service.Claims{UserID: 1, Roles: []string{"admin"}, Permissions: []string{"halls:write"},
+				AMR: []string{"pwd"}},
+			code: http.StatusForbidden,
+		},
+		{
+			name: "admin with MFA",
+			claims: service.Claims{UserID: 1, Roles: []string{"admin"}, Permissions: []string{"halls:write"},
+				AMR: []string{"pwd", "otp", "mfa"}},
+			code: http.StatusOK,
+		},
+		{
+			name: "non-admin without MFA",
+			claims: service.Claims{UserID: 1, Roles: []string{"manager"}, Permissions: []string{"halls:write"},
+				AMR: []string{"pwd"}},
+			code: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := New(mockAuth{claims: tt.claims})
+			req := httptest.NewRequest(http.MethodDelete, "/halls/1", nil)
+			req.Header.Set("Authorization", "Bearer token")
+
+			response := httptest.NewRecorder()
+			checker.Authenticate(checker.CheckPerms("halls:write")(ok)).ServeHTTP(response, req)
+
+			assert.Equal(t, tt.code, response.Code)
+		})
+	}
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	checker := New(mockAuth{err: service.ErrInvalidToken})
+
+	var userID int
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID = r.Context().Value("userID").(int)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		key    string
+		perms  []string
+		code   int
+		userID int
+	}{
+		{name: "valid key", key: "ck_valid_key", perms: []string{"sessions:write"}, code: http.StatusOK, userID: 2},
+		{name: "key without scope", key: "ck_valid_key", perms: []string{"halls:write"}, code: http.StatusForbidden},
+		{name: "invalid key", key: "ck_invalid_key", perms: []string{"sessions:write"}, code: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID = 0
+			req := httptest.NewRequest(http.MethodPost, "/cinema-sessions/1", nil)
+			req.Header.Set("X-API-Key", tt.key)
+
+			response := httptest.NewRecorder()
+			checker.Authenticate(checker.CheckPerms(tt.perms...)(ok)).ServeHTTP(response, req)
+
+			assert.Equal(t, tt.code, response.Code)
+			assert.Equal(t, tt.userID, userID)
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package oidc
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/auth/service"
+	"context"
+	"errors"
+	"fmt"
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var ErrNoIDToken = errors.New("token response does not contain an id token")
+
+type Provider struct {
+	config      oauth2.Config
+	verifier    *gooidc.IDTokenVerifier
+	groupsClaim string
+}
+
+func New(ctx context.Context, issuer, clientID, clientSecret, redirectURL string, scopes []string,
+	groupsClaim string) (Provider, error) {
+	provider, err := gooidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return Provider{}, fmt.Errorf("failed to discover OIDC provider: %w", err)
+	}
+
+	return Provider{
+		config: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  redirectURL,
+			Scopes:       append([]string{gooidc.ScopeOpenID}, scopes...),
+		},
+		verifier:    provider.Verifier(&gooidc.Config{ClientID: clientID}),
+		groupsClaim: groupsClaim,
+	}, nil
+}
+
+func (p Provider) AuthCodeURL(state, nonce, codeChallenge string) string {
+	return p.config.AuthCodeURL(state,
+		gooidc.Nonce(nonce),
+		oauth2.SetAuthURLParam("code_challenge", codeChallenge),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	)
+}
+
+func (p Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (service.Identity, error) {
+	token, err := p.config.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", codeVerifier))
+	if err != nil {
+		return service.Identity{}, fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return service.Identity{}, ErrNoIDToken
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return service.Identity{}, fmt.Errorf("failed to verify id token: %w", err)
+	}
+
+	if idToken.Nonce != nonce {
+		return service.Identity{}, errors.New("id token nonce does not match")
+	}
+
+	var claims struct {
+		Email             string   `json:"email"`
+		EmailVerified     bool     `json:"email_verified"`
+		PreferredUsername string   `json:"preferred_username"`
+		AMR               []string `json:"amr"`
+	}
+	if err = idToken.Claims(&claims); err != nil {
+		return service.Identity{}, fmt.Errorf("failed to parse id token claims: %w", err)
+	}
+
+	var rawClaims map[string]interface{}
+	if err = idToken.Claims(&rawClaims); err != nil {
+		return service.Identity{}, fmt.Errorf("failed to parse id token claims: %w", err)
+	}
+
+	return service.Identity{
+		Issuer:        idToken.Issuer,
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Username:      claims.PreferredUsername,
+		Groups:        stringSlice(rawClaims[p.groupsClaim]),
+		AMR:           claims.AMR,
+	}, nil
+}
+
+func stringSlice(v interface{}) []string {
+	values, _ := v.([]interface{})
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if str, ok := value.(string); ok {
+			result = append(result, str)
+		}
+	}
+	return result
+}
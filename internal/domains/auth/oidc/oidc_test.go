@@ -0,0 +1,173 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+type mockIdP struct {
+	*httptest.Server
+	key           *rsa.PrivateKey
+	codeChallenge string
+	nonce         string
+	claims        jwt.MapClaims
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	idp := &mockIdP{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/keys", idp.jwks)
+	mux.HandleFunc("/token", idp.token)
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+
+	return idp
+}
+
+func (m *mockIdP) discovery(w http.ResponseWriter, r *http.Request) {
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                m.URL,
+		"authorization_endpoint":                m.URL + "/authorize",
+		"token_endpoint":                        m.URL + "/token",
+		"jwks_uri":                              m.URL + "/keys",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (m *mockIdP) jwks(w http.ResponseWriter, r *http.Request) {
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (m *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if r.Form.Get("code") != "valid_code" || base64.RawURLEncoding.EncodeToString(sum[:]) != m.codeChallenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   m.URL,
+		"sub":   "user-1",
+		"aud":   "cinema",
+		"nonce": m.nonce,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+	}
+	for k, v := range m.claims {
+		claims[k] = v
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	idToken, err := token.SignedString(m.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "idp_access_token",
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     idToken,
+	})
+}
+
+func TestProvider(t *testing.T) {
+	idp := newMockIdP(t)
+	ctx := context.Background()
+
+	p, err := New(ctx, idp.URL, "cinema", "secret", "http://localhost:8080/auth/oidc/callback",
+		[]string{"profile", "email"}, "groups")
+	require.NoError(t, err)
+
+	verifier := "test_verifier"
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	authURL, err := url.Parse(p.AuthCodeURL("state", "nonce", challenge))
+	require.NoError(t, err)
+
+	query := authURL.Query()
+	assert.Equal(t, idp.URL+"/authorize", authURL.Scheme+"://"+authURL.Host+authURL.Path)
+	assert.Equal(t, "state", query.Get("state"))
+	assert.Equal(t, "nonce", query.Get("nonce"))
+	assert.Equal(t, challenge, query.Get("code_challenge"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	assert.Equal(t, "openid profile email", query.Get("scope"))
+
+	idp.codeChallenge = challenge
+	idp.nonce = "nonce"
+
+	t.Run("successful exchange", func(t *testing.T) {
+		idp.claims = jwt.MapClaims{
+			"email":              "jane@example.com",
+			"email_verified":     true,
+			"preferred_username": "jane",
+			"groups":             []string{"cinema-admins", "staff"},
+			"amr":                []string{"pwd", "mfa"},
+		}
+
+		identity, err := p.Exchange(ctx, "valid_code", verifier, "nonce")
+		require.NoError(t, err)
+
+		assert.Equal(t, idp.URL, identity.Issuer)
+		assert.Equal(t, "user-1", identity.Subject)
+		assert.Equal(t, "jane@example.com", identity.Email)
+		assert.True(t, identity.EmailVerified)
+		assert.Equal(t, "jane", identity.Username)
+		assert.Equal(t, []string{"cinema-admins", "staff"}, identity.Groups)
+		assert.Equal(t, []string{"pwd", "mfa"}, identity.AMR)
+	})
+
+	t.Run("wrong code verifier", func(t *testing.T) {
+		_, err := p.Exchange(ctx, "valid_code", "other_verifier", "nonce")
+		assert.Error(t, err)
+	})
+
+	t.Run("nonce mismatch", func(t *testing.T) {
+		_, err := p.Exchange(ctx, "valid_code", verifier, "other_nonce")
+		assert.Error(t, err)
+	})
+
+	t.Run("wrong audience", func(t *testing.T) {
+		idp.claims = jwt.MapClaims{"aud": "another-client"}
+
+		_, err := p.Exchange(ctx, "valid_code", verifier, "nonce")
+		assert.Error(t, err)
+	})
+}
@@ -1,11 +1,14 @@
 package repository
 
 import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/auth/lockout"
 	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/auth/service"
 	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/lib/pq"
 	"log"
+	"time"
 )
 
 type AuthRepository struct {
@@ -18,8 +21,11 @@ func New(db *sql.DB) AuthRepository {
 
 func (a AuthRepository) GetUser(username string) (service.Credentials, error) {
 	credentials := service.Credentials{}
-	err := a.db.QueryRow("SELECT user_id, hashed_password FROM users WHERE username=$1", username).
-		Scan(&credentials.ID, &credentials.PasswordHash)
+	err := a.db.QueryRow(`SELECT u.user_id, u.hashed_password, t.confirmed_at IS NOT NULL, u.disabled_at IS NOT NULL
+			FROM users u
+			LEFT JOIN user_totp t ON t.user_id = u.user_id
+			WHERE u.username = $1`, username).
+		Scan(&credentials.ID, &credentials.PasswordHash, &credentials.MFAEnabled, &credentials.Disabled)
 
 	if errors.Is(err, sql.ErrNoRows) {
 		return service.Credentials{}, service.ErrUserNotFound
@@ -32,23 +38,696 @@ func (a AuthRepository) GetUser(username string) (service.Credentials, error) {
 	return credentials, nil
 }
 
-func (a AuthRepository) Permissions(userId int) (string, error) {
-	var roleName string
-	err := a.db.QueryRow(`SELECT r.role_name
+func (a AuthRepository) UserDisabled(userId int) (bool, error) {
+	var disabled bool
+	err := a.db.QueryRow("SELECT disabled_at IS NOT NULL FROM users WHERE user_id = $1", userId).Scan(&disabled)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, service.ErrUserNotFound
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("could not check if user is disabled: %w", err)
+	}
+
+	return disabled, nil
+}
+
+func (a AuthRepository) UpdatePasswordHash(userId int, passwordHash string) error {
+	_, err := a.db.Exec("UPDATE users SET hashed_password = $1 WHERE user_id = $2", passwordHash, userId)
+	if err != nil {
+		return fmt.Errorf("could not update password hash: %w", err)
+	}
+
+	return nil
+}
+
+func (a AuthRepository) Access(userId int) (service.Access, error) {
+	var access service.Access
+	err := a.db.QueryRow(`SELECT
+				COALESCE(array_agg(DISTINCT r.role_name) FILTER (WHERE r.role_name IS NOT NULL), '{}'),
+				COALESCE(array_agg(DISTINCT p.permission_name) FILTER (WHERE p.permission_name IS NOT NULL), '{}')
 			FROM users u
-			JOIN roles r ON u.role_id = r.role_id
+			LEFT JOIN user_roles ur ON ur.user_id = u.user_id
+			LEFT JOIN roles r ON r.role_id = ur.role_id
+			LEFT JOIN role_permissions rp ON rp.role_id = r.role_id
+			LEFT JOIN permissions p ON p.permission_id = rp.permission_id
 			WHERE u.user_id = $1
-		`, userId).Scan(&roleName)
+			GROUP BY u.user_id
+		`, userId).Scan(pq.Array(&access.Roles), pq.Array(&access.Permissions))
 
 	if errors.Is(err, sql.ErrNoRows) {
 		log.Printf("%v with id %d", service.ErrUserNotFound, userId)
+		return service.Access{}, service.ErrUserNotFound
+	}
+
+	if err != nil {
+		return service.Access{}, fmt.Errorf("could not get user permissions: %w", err)
+	}
+
+	return access, nil
+}
+
+func (a AuthRepository) CreateRefreshToken(userId int, tokenHash string, expiresAt time.Time, mfa bool) error {
+	_, err := a.db.Exec(`INSERT INTO refresh_tokens (user_id, token_hash, expires_at, mfa)
+			VALUES ($1, $2, $3, $4)`, userId, tokenHash, expiresAt, mfa)
+	if err != nil {
+		return fmt.Errorf("could not create refresh token: %w", err)
+	}
+
+	return nil
+}
+
+func (a AuthRepository) RefreshToken(tokenHash string) (service.RefreshToken, error) {
+	var (
+		token     service.RefreshToken
+		revokedAt sql.NullTime
+	)
+	err := a.db.QueryRow(`SELECT token_id, user_id, expires_at, revoked_at, mfa
+			FROM refresh_tokens
+			WHERE token_hash = $1`, tokenHash).
+		Scan(&token.ID, &token.UserID, &token.ExpiresAt, &revokedAt, &token.MFA)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return service.RefreshToken{}, service.ErrTokenNotFound
+	}
+
+	if err != nil {
+		return service.RefreshToken{}, fmt.Errorf("could not get refresh token: %w", err)
+	}
+
+	token.Revoked = revokedAt.Valid
+	return token, nil
+}
+
+func (a AuthRepository) RotateRefreshToken(id, userId int, tokenHash string, expiresAt time.Time) (bool, error) {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Println(err)
+		}
+	}()
+
+	res, err := tx.Exec(`UPDATE refresh_tokens
+			SET revoked_at = now()
+			WHERE token_id = $1 AND revoked_at IS NULL`, id)
+	if err != nil {
+		return false, fmt.Errorf("could not revoke refresh token: %w", err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("could not revoke refresh token: %w", err)
+	}
+	if rowsAffected == 0 {
+		return false, nil
+	}
+
+	_, err = tx.Exec(`INSERT INTO refresh_tokens (user_id, token_hash, expires_at, mfa)
+			SELECT $1, $2, $3, mfa FROM refresh_tokens WHERE token_id = $4`, userId, tokenHash, expiresAt, id)
+	if err != nil {
+		return false, fmt.Errorf("could not create refresh token: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("could not commit refresh token rotation: %w", err)
+	}
+
+	return true, nil
+}
+
+func (a AuthRepository) RevokeRefreshToken(userId int, tokenHash string) error {
+	_, err := a.db.Exec(`UPDATE refresh_tokens
+			SET revoked_at = now()
+			WHERE user_id = $1 AND token_hash = $2 AND revoked_at IS NULL`, userId, tokenHash)
+	if err != nil {
+		return fmt.Errorf("could not revoke refresh token: %w", err)
+	}
+
+	return nil
+}
+
+func (a AuthRepository) RevokeUserRefreshTokens(userId int) error {
+	_, err := a.db.Exec(`UPDATE refresh_tokens
+			SET revoked_at = now()
+			WHERE user_id = $1 AND revoked_at IS NULL`, userId)
+	if err != nil {
+		return fmt.Errorf("could not revoke refresh tokens: %w", err)
+	}
+
+	return nil
+}
+
+func (a AuthRepository) RevokeToken(jti string, expiresAt time.Time) error {
+	_, err := a.db.Exec(`INSERT INTO revoked_tokens (jti, expires_at)
+			VALUES ($1, $2)
+			ON CONFLICT (jti) DO NOTHING`, jti, expiresAt)
+	if err != nil {
+		return fmt.Errorf("could not revoke token: %w", err)
+	}
+
+	if _, err = a.db.Exec("DELETE FROM revoked_tokens WHERE expires_at < now()"); err != nil {
+		log.Println("failed to clean up expired revoked tokens:", err)
+	}
+
+	return nil
+}
+
+func (a AuthRepository) TokenRevoked(jti string) (bool, error) {
+	var revoked bool
+	err := a.db.QueryRow("SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti = $1)", jti).Scan(&revoked)
+	if err != nil {
+		return false, fmt.Errorf("could not check if token is revoked: %w", err)
+	}
+
+	return revoked, nil
+}
+
+func (a AuthRepository) Attempts(key string) (lockout.Attempts, error) {
+	var (
+		attempts    lockout.Attempts
+		lockedUntil sql.NullTime
+	)
+	err := a.db.QueryRow("SELECT failures, locked_until FROM login_attempts WHERE attempt_key = $1", key).
+		Scan(&attempts.Failures, &lockedUntil)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return lockout.Attempts{}, nil
+	}
+
+	if err != nil {
+		return lockout.Attempts{}, fmt.Errorf("could not get login attempts: %w", err)
+	}
+
+	attempts.LockedUntil = lockedUntil.Time
+	return attempts, nil
+}
+
+func (a AuthRepository) AddFailure(key string, since time.Time) (int, error) {
+	var failures int
+	err := a.db.QueryRow(`INSERT INTO login_attempts (attempt_key, failures, last_failure)
+			VALUES ($1, 1, now())
+			ON CONFLICT (attempt_key) DO UPDATE SET
+				failures = CASE WHEN login_attempts.last_failure < $2 THEN 1 ELSE login_attempts.failures + 1 END,
+				last_failure = now()
+			RETURNING failures`, key, since).Scan(&failures)
+	if err != nil {
+		return 0, fmt.Errorf("could not register failed login attempt: %w", err)
+	}
+
+	return failures, nil
+}
+
+func (a AuthRepository) Lock(key string, until time.Time) error {
+	_, err := a.db.Exec("UPDATE login_attempts SET locked_until = $1 WHERE attempt_key = $2", until, key)
+	if err != nil {
+		return fmt.Errorf("could not lock login attempts: %w", err)
+	}
+
+	return nil
+}
+
+func (a AuthRepository) ResetAttempts(key string) error {
+	_, err := a.db.Exec("DELETE FROM login_attempts WHERE attempt_key = $1", key)
+	if err != nil {
+		return fmt.Errorf("could not reset login attempts: %w", err)
+	}
+
+	return nil
+}
+
+func (a AuthRepository) UserByEmail(email string) (int, error) {
+	var userId int
+	err := a.db.QueryRow("SELECT user_id FROM users WHERE email = $1 AND email_verified", email).
+		Scan(&userId)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, service.ErrUserNotFound
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("could not get user by email: %w", err)
+	}
+
+	return userId, nil
+}
+
+func (a AuthRepository) CreatePasswordResetToken(userId int, tokenHash string, expiresAt time.Time) error {
+	_, err := a.db.Exec(`INSERT INTO user_tokens (user_id, token_hash, purpose, expires_at)
+			VALUES ($1, $2, 'password_reset', $3)`, userId, tokenHash, expiresAt)
+	if err != nil {
+		return fmt.Errorf("could not create password reset token: %w", err)
+	}
+
+	return nil
+}
+
+func (a AuthRepository) ResetPassword(tokenHash string, passwordHash string) (bool, error) {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Println(err)
+		}
+	}()
+
+	var userId int
+	err = tx.QueryRow(`UPDATE user_tokens SET used_at = now()
+			WHERE token_hash = $1 AND purpose = 'password_reset'
+			AND used_at IS NULL AND expires_at > now()
+			RETURNING user_id`, tokenHash).Scan(&userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("could not use password reset token: %w", err)
+	}
+
+	if _, err = tx.Exec("UPDATE users SET hashed_password = $1 WHERE user_id = $2", passwordHash, userId); err != nil {
+		return false, fmt.Errorf("could not update password: %w", err)
+	}
+
+	_, err = tx.Exec(`UPDATE user_tokens SET used_at = now()
+			WHERE user_id = $1 AND purpose = 'password_reset' AND used_at IS NULL`, userId)
+	if err != nil {
+		return false, fmt.Errorf("could not invalidate password reset tokens: %w", err)
+	}
+
+	_, err = tx.Exec(`UPDATE refresh_tokens SET revoked_at = now()
+			WHERE user_id = $1 AND revoked_at IS NULL`, userId)
+	if err != nil {
+		return false, fmt.Errorf("could not revoke refresh tokens: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("could not reset password: %w", err)
+	}
+
+	return true, nil
+}
+
+func (a AuthRepository) TOTP(userId int) (service.TOTP, error) {
+	var (
+		totp        service.TOTP
+		confirmedAt sql.NullTime
+		lastStep    sql.NullInt64
+	)
+	err := a.db.QueryRow(`SELECT secret, confirmed_at, last_used_step
+			FROM user_totp
+			WHERE user_id = $1`, userId).
+		Scan(&totp.Secret, &confirmedAt, &lastStep)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return service.TOTP{}, service.ErrTOTPNotFound
+	}
+
+	if err != nil {
+		return service.TOTP{}, fmt.Errorf("could not get TOTP secret: %w", err)
+	}
+
+	totp.Confirmed = confirmedAt.Valid
+	totp.LastStep = lastStep.Int64
+	return totp, nil
+}
+
+func (a AuthRepository) SaveTOTPSecret(userId int, secret string) (bool, error) {
+	res, err := a.db.Exec(`INSERT INTO user_totp (user_id, secret)
+			VALUES ($1, $2)
+			ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret
+			WHERE user_totp.confirmed_at IS NULL`, userId, secret)
+	if err != nil {
+		return false, fmt.Errorf("could not save TOTP secret: %w", err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("could not save TOTP secret: %w", err)
+	}
+
+	return rowsAffected != 0, nil
+}
+
+func (a AuthRepository) ConfirmTOTP(userId int, step int64, recoveryCodeHashes []string) (bool, error) {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Println(err)
+		}
+	}()
+
+	res, err := tx.Exec(`UPDATE user_totp
+			SET confirmed_at = now(), last_used_step = $2
+			WHERE user_id = $1 AND confirmed_at IS NULL`, userId, step)
+	if err != nil {
+		return false, fmt.Errorf("could not confirm TOTP: %w", err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("could not confirm TOTP: %w", err)
+	}
+	if rowsAffected == 0 {
+		return false, nil
+	}
+
+	if _, err = tx.Exec("DELETE FROM recovery_codes WHERE user_id = $1", userId); err != nil {
+		return false, fmt.Errorf("could not delete recovery codes: %w", err)
+	}
+
+	_, err = tx.Exec(`INSERT INTO recovery_codes (user_id, code_hash)
+			SELECT $1, unnest($2::text[])`, userId, pq.Array(recoveryCodeHashes))
+	if err != nil {
+		return false, fmt.Errorf("could not create recovery codes: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("could not confirm TOTP: %w", err)
+	}
+
+	return true, nil
+}
+
+func (a AuthRepository) UseTOTPStep(userId int, step int64) (bool, error) {
+	res, err := a.db.Exec(`UPDATE user_totp
+			SET last_used_step = $2
+			WHERE user_id = $1 AND confirmed_at IS NOT NULL
+			AND (last_used_step IS NULL OR last_used_step < $2)`, userId, step)
+	if err != nil {
+		return false, fmt.Errorf("could not use TOTP code: %w", err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("could not use TOTP code: %w", err)
+	}
+
+	return rowsAffected != 0, nil
+}
+
+func (a AuthRepository) UseRecoveryCode(userId int, codeHash string) (bool, error) {
+	res, err := a.db.Exec(`UPDATE recovery_codes
+			SET used_at = now()
+			WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`, userId, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("could not use recovery code: %w", err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("could not use recovery code: %w", err)
+	}
+
+	return rowsAffected != 0, nil
+}
+
+func (a AuthRepository) DeleteTOTP(userId int) error {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Println(err)
+		}
+	}()
+
+	if _, err = tx.Exec("DELETE FROM recovery_codes WHERE user_id = $1", userId); err != nil {
+		return fmt.Errorf("could not delete recovery codes: %w", err)
+	}
+
+	if _, err = tx.Exec("DELETE FROM user_totp WHERE user_id = $1", userId); err != nil {
+		return fmt.Errorf("could not delete TOTP secret: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("could not disable TOTP: %w", err)
+	}
+
+	return nil
+}
+
+func (a AuthRepository) Username(userId int) (string, error) {
+	var username string
+	err := a.db.QueryRow("SELECT username FROM users WHERE user_id = $1", userId).Scan(&username)
+
+	if errors.Is(err, sql.ErrNoRows) {
 		return "", service.ErrUserNotFound
 	}
 
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("could not get username: %w", err)
 	}
 
-	return roleName, nil
+	return username, nil
+}
+
+func (a AuthRepository) CreateAPIKey(key service.APIKey) (service.APIKey, error) {
+	err := a.db.QueryRow(`INSERT INTO api_keys (name, prefix, key_hash, user_id, scopes, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING key_id, created_at`,
+		key.Name, key.Prefix, key.Hash, key.UserID, pq.Array(key.Scopes), key.ExpiresAt).
+		Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return service.APIKey{}, fmt.Errorf("could not create api key: %w", err)
+	}
+
+	return key, nil
+}
+
+func (a AuthRepository) APIKeys() ([]service.APIKey, error) {
+	rows, err := a.db.Query(`SELECT key_id, name, prefix, key_hash, user_id, scopes,
+				created_at, expires_at, last_used_at, revoked_at
+			FROM api_keys
+			ORDER BY key_id`)
+	if err != nil {
+		return nil, fmt.Errorf("could not get api keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []service.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan api key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not get api keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+func (a AuthRepository) APIKeyByPrefix(prefix string) (service.APIKey, error) {
+	row := a.db.QueryRow(`SELECT key_id, name, prefix, key_hash, user_id, scopes,
+				created_at, expires_at, last_used_at, revoked_at
+			FROM api_keys
+			WHERE prefix = $1`, prefix)
+
+	key, err := scanAPIKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return service.APIKey{}, service.ErrAPIKeyNotFound
+	}
+
+	if err != nil {
+		return service.APIKey{}, fmt.Errorf("could not get api key: %w", err)
+	}
+
+	return key, nil
+}
 
+func (a AuthRepository) RevokeAPIKey(id int) (bool, error) {
+	res, err := a.db.Exec(`UPDATE api_keys
+			SET revoked_at = COALESCE(revoked_at, now())
+			WHERE key_id = $1`, id)
+	if err != nil {
+		return false, fmt.Errorf("could not revoke api key: %w", err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("could not revoke api key: %w", err)
+	}
+
+	return rowsAffected != 0, nil
+}
+
+func (a AuthRepository) TouchAPIKey(id int) error {
+	_, err := a.db.Exec("UPDATE api_keys SET last_used_at = now() WHERE key_id = $1", id)
+	if err != nil {
+		return fmt.Errorf("could not update api key last use: %w", err)
+	}
+
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAPIKey(row scanner) (service.APIKey, error) {
+	var (
+		key                            service.APIKey
+		expiresAt, lastUsed, revokedAt sql.NullTime
+	)
+	err := row.Scan(&key.ID, &key.Name, &key.Prefix, &key.Hash, &key.UserID, pq.Array(&key.Scopes),
+		&key.CreatedAt, &expiresAt, &lastUsed, &revokedAt)
+	if err != nil {
+		return service.APIKey{}, err
+	}
+
+	key.ExpiresAt = nullTime(expiresAt)
+	key.LastUsedAt = nullTime(lastUsed)
+	key.RevokedAt = nullTime(revokedAt)
+	return key, nil
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func (a AuthRepository) IdentityUser(issuer, subject string) (int, error) {
+	var userId int
+	err := a.db.QueryRow("SELECT user_id FROM user_identities WHERE issuer = $1 AND subject = $2",
+		issuer, subject).Scan(&userId)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, service.ErrUserNotFound
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("could not get user by identity: %w", err)
+	}
+
+	return userId, nil
+}
+
+func (a AuthRepository) LinkIdentity(userId int, issuer, subject string) error {
+	_, err := a.db.Exec(`INSERT INTO user_identities (issuer, subject, user_id) VALUES ($1, $2, $3)
+			ON CONFLICT (issuer, subject) DO NOTHING`, issuer, subject, userId)
+	if err != nil {
+		return fmt.Errorf("could not link identity: %w", err)
+	}
+
+	return nil
+}
+
+func (a AuthRepository) CreateIdentityUser(identity service.Identity, username string,
+	passwordHash string) (userId int, err error) {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Println(err)
+		}
+	}()
+
+	username, err = uniqueUsername(tx, username)
+	if err != nil {
+		return 0, err
+	}
+
+	// An unverified or already registered email is not attached to the new account.
+	var email sql.NullString
+	if identity.Email != "" && identity.EmailVerified {
+		var taken bool
+		err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE email = $1)", identity.Email).Scan(&taken)
+		if err != nil {
+			return 0, fmt.Errorf("could not check email: %w", err)
+		}
+		email = sql.NullString{String: identity.Email, Valid: !taken}
+	}
+
+	err = tx.QueryRow(`INSERT INTO users (username, hashed_password, email, email_verified)
+			VALUES ($1, $2, $3, $4) RETURNING user_id`,
+		username, passwordHash, email, email.Valid).Scan(&userId)
+	if err != nil {
+		return 0, fmt.Errorf("could not create user: %w", err)
+	}
+
+	_, err = tx.Exec(`INSERT INTO user_roles (user_id, role_id)
+			SELECT $1, role_id FROM roles WHERE role_name = $2`, userId, service.UserRoleName)
+	if err != nil {
+		return 0, fmt.Errorf("could not assign role to user: %w", err)
+	}
+
+	_, err = tx.Exec("INSERT INTO user_identities (issuer, subject, user_id) VALUES ($1, $2, $3)",
+		identity.Issuer, identity.Subject, userId)
+	if err != nil {
+		return 0, fmt.Errorf("could not link identity: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("could not create user: %w", err)
+	}
+
+	return userId, nil
+}
+
+func (a AuthRepository) SyncRoles(userId int, grant []string, revoke []string) error {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Println(err)
+		}
+	}()
+
+	_, err = tx.Exec(`DELETE FROM user_roles
+			WHERE user_id = $1 AND role_id IN (SELECT role_id FROM roles WHERE role_name = ANY($2))`,
+		userId, pq.Array(revoke))
+	if err != nil {
+		return fmt.Errorf("could not revoke roles: %w", err)
+	}
+
+	_, err = tx.Exec(`INSERT INTO user_roles (user_id, role_id)
+			SELECT $1, role_id FROM roles WHERE role_name = ANY($2)
+			ON CONFLICT DO NOTHING`, userId, pq.Array(grant))
+	if err != nil {
+		return fmt.Errorf("could not grant roles: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("could not sync roles: %w", err)
+	}
+
+	return nil
+}
+
+func uniqueUsername(tx *sql.Tx, username string) (string, error) {
+	candidate := username
+	for i := 2; ; i++ {
+		var exists bool
+		err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE username = $1)", candidate).Scan(&exists)
+		if err != nil {
+			return "", fmt.Errorf("could not check username: %w", err)
+		}
+		if !exists {
+			return candidate, nil
+		}
+
+		suffix := fmt.Sprintf("_%d", i)
+		if len(username)+len(suffix) > 50 {
+			candidate = username[:50-len(suffix)] + suffix
+		} else {
+			candidate = username + suffix
+		}
+	}
 }
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/token"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrInvalidAPIKey  = errors.New("invalid api key")
+	ErrInvalidScope   = errors.New("scope is not granted to the key owner")
+)
+
+const (
+	APIKeyPermission = "apikeys:write"
+	// AMRAPIKey marks claims of requests authenticated with an API key.
+	AMRAPIKey        = "apikey"
+	apiKeyPrefix     = "ck"
+	apiKeyIDLength   = 6
+	apiKeyTouchEvery = time.Minute
+)
+
+type APIKey struct {
+	ID         int
+	Name       string
+	Prefix     string
+	Hash       string
+	UserID     int
+	Scopes     []string
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+func (a Auth) CreateAPIKey(name string, userID int, scopes []string, expiresAt *time.Time) (string, APIKey, error) {
+	access, err := a.r.Access(userID)
+	if errors.Is(err, ErrUserNotFound) {
+		return "", APIKey{}, err
+	}
+	if err != nil {
+		log.Println(err)
+		return "", APIKey{}, ErrInternalError
+	}
+
+	for _, scope := range scopes {
+		if !contains(access.Permissions, scope) {
+			return "", APIKey{}, ErrInvalidScope
+		}
+	}
+
+	prefix, err := randomString(apiKeyIDLength, hex.EncodeToString)
+	if err != nil {
+		log.Println("failed to generate api key prefix:", err)
+		return "", APIKey{}, ErrInternalError
+	}
+
+	secret, _, err := token.New()
+	if err != nil {
+		log.Println("failed to generate api key:", err)
+		return "", APIKey{}, ErrInternalError
+	}
+
+	key := apiKeyPrefix + "_" + prefix + "_" + secret
+	apiKey := APIKey{
+		Name:      name,
+		Prefix:    prefix,
+		Hash:      token.Hash(key),
+		UserID:    userID,
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+
+	apiKey, err = a.r.CreateAPIKey(apiKey)
+	if err != nil {
+		log.Println(err)
+		return "", APIKey{}, ErrInternalError
+	}
+
+	return key, apiKey, nil
+}
+
+func (a Auth) APIKeys() ([]APIKey, error) {
+	keys, err := a.r.APIKeys()
+	if err != nil {
+		log.Println(err)
+		return nil, ErrInternalError
+	}
+	return keys, nil
+}
+
+func (a Auth) RevokeAPIKey(id int) error {
+	found, err := a.r.RevokeAPIKey(id)
+	if err != nil {
+		log.Println(err)
+		return ErrInternalError
+	}
+	if !found {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func (a Auth) VerifyAPIKey(key string) (Claims, error) {
+	parts := strings.SplitN(key, "_", 3)
+	if len(parts) != 3 || parts[0] != apiKeyPrefix {
+		return Claims{}, ErrInvalidAPIKey
+	}
+
+	apiKey, err := a.r.APIKeyByPrefix(parts[1])
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return Claims{}, ErrInvalidAPIKey
+	}
+	if err != nil {
+		log.Println(err)
+		return Claims{}, ErrInternalError
+	}
+
+	if subtle.ConstantTimeCompare([]byte(apiKey.Hash), []byte(token.Hash(key))) != 1 {
+		return Claims{}, ErrInvalidAPIKey
+	}
+
+	if apiKey.RevokedAt != nil {
+		return Claims{}, ErrRevokedToken
+	}
+
+	now := time.Now()
+	if apiKey.ExpiresAt != nil && apiKey.ExpiresAt.Before(now) {
+		return Claims{}, ErrExpiredToken
+	}
+
+	if err = a.checkDisabled(apiKey.UserID); err != nil {
+		return Claims{}, err
+	}
+
+	access, err := a.r.Access(apiKey.UserID)
+	if err != nil {
+		log.Println("failed to get api key owner permissions:", err)
+		return Claims{}, ErrInternalError
+	}
+
+	perms := make([]string, 0, len(apiKey.Scopes))
+	for _, scope := range apiKey.Scopes {
+		if contains(access.Permissions, scope) {
+			perms = append(perms, scope)
+		}
+	}
+
+	if apiKey.LastUsedAt == nil || apiKey.LastUsedAt.Before(now.Add(-apiKeyTouchEvery)) {
+		if err = a.r.TouchAPIKey(apiKey.ID); err != nil {
+			log.Println("failed to update api key last use:", err)
+		}
+	}
+
+	return Claims{
+		UserID:      apiKey.UserID,
+		Roles:       []string{},
+		Permissions: perms,
+		AMR:         []string{AMRAPIKey},
+	}, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/token"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/pkg/totp"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"github.com/golang-jwt/jwt/v4"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidMFACode     = errors.New("invalid authentication code")
+	ErrTOTPNotFound       = errors.New("two-factor authentication is not set up")
+	ErrTOTPAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+)
+
+const (
+	MFARequiredRole = "admin"
+	AMRPassword     = "pwd"
+	AMROTP          = "otp"
+	AMRMFA          = "mfa"
+)
+
+const (
+	mfaTokenType       = "mfa"
+	mfaTokenExp        = 5 * time.Minute
+	totpIssuer         = "Cinema"
+	totpSkew           = 1
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+)
+
+type TOTP struct {
+	Secret    string
+	Confirmed bool
+	LastStep  int64
+}
+
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+}
+
+func (a Auth) VerifyMFA(mfaToken string, code string) (Tokens, error) {
+	claims, err := a.parseToken(mfaToken)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	if typ, _ := claims["typ"].(string); typ != mfaTokenType {
+		return Tokens{}, ErrInvalidToken
+	}
+
+	jti := claims["jti"].(string)
+	revoked, err := a.r.TokenRevoked(jti)
+	if err != nil {
+		log.Println("failed to check if token is revoked:", err)
+		return Tokens{}, ErrInternalError
+	}
+	if revoked {
+		return Tokens{}, ErrRevokedToken
+	}
+
+	userID := int(claims["user_id"].(float64))
+	err = a.limitMFA(userID, func() (bool, error) {
+		return a.verifySecondFactor(userID, code)
+	})
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	if err = a.r.RevokeToken(jti, time.Unix(int64(claims["exp"].(float64)), 0)); err != nil {
+		log.Println(err)
+		return Tokens{}, ErrInternalError
+	}
+
+	return a.issueTokens(userID, true)
+}
+
+func (a Auth) EnrollTOTP(userID int) (TOTPEnrollment, error) {
+	username, err := a.r.Username(userID)
+	if errors.Is(err, ErrUserNotFound) {
+		return TOTPEnrollment{}, err
+	}
+	if err != nil {
+		log.Println(err)
+		return TOTPEnrollment{}, ErrInternalError
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		log.Println("failed to generate TOTP secret:", err)
+		return TOTPEnrollment{}, ErrInternalError
+	}
+
+	saved, err := a.r.SaveTOTPSecret(userID, secret)
+	if err != nil {
+		log.Println(err)
+		return TOTPEnrollment{}, ErrInternalError
+	}
+	if !saved {
+		return TOTPEnrollment{}, ErrTOTPAlreadyEnabled
+	}
+
+	return TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(totpIssuer, username, secret),
+	}, nil
+}
+
+func (a Auth) ConfirmTOTP(userID int, code string) (recoveryCodes []string, err error) {
+	t, err := a.r.TOTP(userID)
+	if errors.Is(err, ErrTOTPNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		log.Println(err)
+		return nil, ErrInternalError
+	}
+
+	if t.Confirmed {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
+	var step int64
+	err = a.limitMFA(userID, func() (bool, error) {
+		var ok bool
+		step, ok = totp.Validate(t.Secret, code, time.Now(), totpSkew)
+		return ok, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryCodes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		log.Println("failed to generate recovery codes:", err)
+		return nil, ErrInternalError
+	}
+
+	confirmed, err := a.r.ConfirmTOTP(userID, step, hashes)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrInternalError
+	}
+	if !confirmed {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
+	return recoveryCodes, nil
+}
+
+func (a Auth) DisableTOTP(userID int, code string) error {
+	t, err := a.r.TOTP(userID)
+	if errors.Is(err, ErrTOTPNotFound) {
+		return err
+	}
+	if err != nil {
+		log.Println(err)
+		return ErrInternalError
+	}
+
+	if t.Confirmed {
+		err = a.limitMFA(userID, func() (bool, error) {
+			return a.verifySecondFactor(userID, code)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = a.r.DeleteTOTP(userID); err != nil {
+		log.Println(err)
+		return ErrInternalError
+	}
+
+	return nil
+}
+
+func (a Auth) limitMFA(userID int, verify func() (bool, error)) error {
+	key := mfaKey(userID)
+	retryAfter, err := a.accounts.Check(key)
+	if err != nil {
+		log.Println(err)
+		return ErrInternalError
+	}
+	if retryAfter > 0 {
+		return RetryError{Err: ErrTooManyAttempts, RetryAfter: retryAfter}
+	}
+
+	ok, err := verify()
+	if err != nil {
+		log.Println(err)
+		return ErrInternalError
+	}
+
+	if !ok {
+		if _, err = a.accounts.Fail(key); err != nil {
+			log.Println("failed to register failed authentication code:", err)
+		}
+		return ErrInvalidMFACode
+	}
+
+	if err = a.accounts.Reset(key); err != nil {
+		log.Println("failed to reset authentication code attempts:", err)
+	}
+
+	return nil
+}
+
+func (a Auth) verifySecondFactor(userID int, code string) (bool, error) {
+	t, err := a.r.TOTP(userID)
+	if errors.Is(err, ErrTOTPNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if !t.Confirmed {
+		return false, nil
+	}
+
+	code = strings.ReplaceAll(code, " ", "")
+	if step, ok := totp.Validate(t.Secret, code, time.Now(), totpSkew); ok {
+		return a.r.UseTOTPStep(userID, step)
+	}
+
+	return a.r.UseRecoveryCode(userID, token.Hash(normalizeRecoveryCode(code)))
+}
+
+func (a Auth) generateMFAToken(userID int) (string, error) {
+	jti, err := randomString(jtiLength, hex.EncodeToString)
+	if err != nil {
+		log.Println("failed to generate token id:", err)
+		return "", err
+	}
+
+	now := time.Now()
+	signedToken, err := a.keys.Sign(jwt.MapClaims{
+		"user_id": userID,
+		"jti":     jti,
+		"typ":     mfaTokenType,
+		"iat":     now.Unix(),
+		"exp":     now.Add(mfaTokenExp).Unix(),
+	})
+	if err != nil {
+		log.Println("failed to sign token:", err)
+		return "", err
+	}
+	return signedToken, nil
+}
+
+func generateRecoveryCodes() (codes []string, hashes []string, err error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, recoveryCodeLength)
+		if _, err = rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+
+		code := strings.ToLower(encoding.EncodeToString(b))
+		codes = append(codes, code[:4]+"-"+code[4:8]+"-"+code[8:12]+"-"+code[12:])
+		hashes = append(hashes, token.Hash(code))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(code, "-", ""))
+}
+
+func amr(mfa bool) []string {
+	if mfa {
+		return []string{AMRPassword, AMROTP, AMRMFA}
+	}
+	return []string{AMRPassword}
+}
+
+func mfaKey(userID int) string {
+	return "mfa:" + strconv.Itoa(userID)
+}
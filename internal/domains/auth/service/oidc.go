@@ -0,0 +1,226 @@
+package service
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/password"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/token"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/golang-jwt/jwt/v4"
+	"log"
+	"strings"
+	"time"
+)
+
+var (
+	ErrOIDCNotConfigured = errors.New("single sign-on is not configured")
+	ErrInvalidOIDCState  = errors.New("invalid or expired login state")
+)
+
+const (
+	oidcStateTokenType = "oidc_state"
+	oidcStateExp       = 10 * time.Minute
+	maxUsernameLength  = 50
+	UserRoleName       = "user"
+)
+
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+	Groups        []string
+	AMR           []string
+}
+
+type identityProvider interface {
+	AuthCodeURL(state, nonce, codeChallenge string) string
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (Identity, error)
+}
+
+func (a Auth) WithOIDC(idp identityProvider, groupRoles map[string]string) Auth {
+	a.idp = idp
+	a.groupRoles = groupRoles
+	return a
+}
+
+func (a Auth) StartOIDCLogin() (authURL string, stateToken string, err error) {
+	if a.idp == nil {
+		return "", "", ErrOIDCNotConfigured
+	}
+
+	state, _, err := token.New()
+	if err != nil {
+		log.Println("failed to generate state:", err)
+		return "", "", ErrInternalError
+	}
+
+	nonce, _, err := token.New()
+	if err != nil {
+		log.Println("failed to generate nonce:", err)
+		return "", "", ErrInternalError
+	}
+
+	verifier, _, err := token.New()
+	if err != nil {
+		log.Println("failed to generate code verifier:", err)
+		return "", "", ErrInternalError
+	}
+
+	now := time.Now()
+	stateToken, err = a.keys.Sign(jwt.MapClaims{
+		"typ":      oidcStateTokenType,
+		"state":    state,
+		"nonce":    nonce,
+		"verifier": verifier,
+		"iat":      now.Unix(),
+		"exp":      now.Add(oidcStateExp).Unix(),
+	})
+	if err != nil {
+		log.Println("failed to sign state token:", err)
+		return "", "", ErrInternalError
+	}
+
+	return a.idp.AuthCodeURL(state, nonce, codeChallenge(verifier)), stateToken, nil
+}
+
+func (a Auth) CompleteOIDCLogin(ctx context.Context, stateToken, state, code string) (Tokens, error) {
+	if a.idp == nil {
+		return Tokens{}, ErrOIDCNotConfigured
+	}
+
+	claims, err := a.parseStateToken(stateToken)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	expectedState, _ := claims["state"].(string)
+	if expectedState == "" || subtle.ConstantTimeCompare([]byte(expectedState), []byte(state)) != 1 {
+		return Tokens{}, ErrInvalidOIDCState
+	}
+
+	nonce, _ := claims["nonce"].(string)
+	verifier, _ := claims["verifier"].(string)
+
+	identity, err := a.idp.Exchange(ctx, code, verifier, nonce)
+	if err != nil {
+		log.Println("OIDC login failed:", err)
+		return Tokens{}, ErrInvalidToken
+	}
+
+	userID, err := a.oidcUser(identity)
+	if err != nil {
+		log.Println(err)
+		return Tokens{}, ErrInternalError
+	}
+
+	if err = a.syncRoles(userID, identity.Groups); err != nil {
+		log.Println(err)
+		return Tokens{}, ErrInternalError
+	}
+
+	return a.issueTokens(userID, contains(identity.AMR, AMRMFA))
+}
+
+func (a Auth) oidcUser(identity Identity) (int, error) {
+	userID, err := a.r.IdentityUser(identity.Issuer, identity.Subject)
+	if err == nil {
+		return userID, nil
+	}
+	if !errors.Is(err, ErrUserNotFound) {
+		return 0, err
+	}
+
+	if identity.Email != "" && identity.EmailVerified {
+		userID, err = a.r.UserByEmail(identity.Email)
+		if err == nil {
+			log.Printf("linking %s identity %q to user %d", identity.Issuer, identity.Subject, userID)
+			return userID, a.r.LinkIdentity(userID, identity.Issuer, identity.Subject)
+		}
+		if !errors.Is(err, ErrUserNotFound) {
+			return 0, err
+		}
+	}
+
+	random, err := randomString(32, hex.EncodeToString)
+	if err != nil {
+		return 0, err
+	}
+	passwordHash, err := password.Hash(random)
+	if err != nil {
+		return 0, err
+	}
+
+	return a.r.CreateIdentityUser(identity, oidcUsername(identity), passwordHash)
+}
+
+func (a Auth) syncRoles(userID int, groups []string) error {
+	if len(a.groupRoles) == 0 {
+		return nil
+	}
+
+	granted := map[string]bool{}
+	for _, group := range groups {
+		if role, ok := a.groupRoles[group]; ok {
+			granted[role] = true
+		}
+	}
+
+	var grant, revoke []string
+	seen := map[string]bool{}
+	for _, role := range a.groupRoles {
+		if seen[role] {
+			continue
+		}
+		seen[role] = true
+
+		if granted[role] {
+			grant = append(grant, role)
+		} else {
+			revoke = append(revoke, role)
+		}
+	}
+
+	return a.r.SyncRoles(userID, grant, revoke)
+}
+
+func (a Auth) parseStateToken(stateToken string) (jwt.MapClaims, error) {
+	parsedToken, err := jwt.Parse(stateToken, a.keys.Keyfunc)
+	if err != nil {
+		return nil, ErrInvalidOIDCState
+	}
+
+	claims, ok := parsedToken.Claims.(jwt.MapClaims)
+	if !ok || !parsedToken.Valid {
+		return nil, ErrInvalidOIDCState
+	}
+
+	if typ, _ := claims["typ"].(string); typ != oidcStateTokenType {
+		return nil, ErrInvalidOIDCState
+	}
+
+	return claims, nil
+}
+
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func oidcUsername(identity Identity) string {
+	username := identity.Username
+	if username == "" {
+		username, _, _ = strings.Cut(identity.Email, "@")
+	}
+	if username == "" {
+		username = "user"
+	}
+	if len(username) > maxUsernameLength {
+		username = username[:maxUsernameLength]
+	}
+	return username
+}
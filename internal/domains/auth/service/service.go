@@ -1,8 +1,15 @@
 package service
 
 import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/auth/keys"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/password"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/token"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/pkg/mailer"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
-	"github.com/dgrijalva/jwt-go"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
 	_ "github.com/lib/pq"
 	"log"
 	"time"
@@ -10,62 +17,451 @@ import (
 
 var (
 	ErrInvalidUsernameOrPassword = errors.New("invalid username or password")
-	ErrInvalidSigningMethod      = errors.New("invalid signing method")
 	ErrInvalidToken              = errors.New("invalid token")
 	ErrExpiredToken              = errors.New("token is expired")
+	ErrRevokedToken              = errors.New("token is revoked")
 	ErrInternalError             = errors.New("internal server error")
 	ErrUserNotFound              = errors.New("user not found")
+	ErrTokenNotFound             = errors.New("token not found")
+	ErrAccountLocked             = errors.New("account is temporarily locked")
+	ErrTooManyAttempts           = errors.New("too many login attempts")
+	ErrInvalidResetToken         = errors.New("invalid or expired password reset token")
+	ErrAccountDisabled           = errors.New("account is disabled")
 )
 
+const UnlockPermission = "users:write"
+
+const (
+	jtiLength     = 16
+	resetTokenExp = time.Hour
+)
+
+type RetryError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e RetryError) Error() string {
+	return e.Err.Error()
+}
+
+func (e RetryError) Unwrap() error {
+	return e.Err
+}
+
 type Credentials struct {
 	ID           int
 	PasswordHash string
+	MFAEnabled   bool
+	Disabled     bool
+}
+
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	MFAToken     string
+}
+
+type Access struct {
+	Roles       []string
+	Permissions []string
+}
+
+type Claims struct {
+	UserID      int
+	Roles       []string
+	Permissions []string
+	AMR         []string
+}
+
+type RefreshToken struct {
+	ID        int
+	UserID    int
+	ExpiresAt time.Time
+	Revoked   bool
+	MFA       bool
 }
 
 type repository interface {
 	GetUser(username string) (Credentials, error)
-	Permissions(userId int) (string, error)
+	UpdatePasswordHash(userId int, passwordHash string) error
+	Access(userId int) (Access, error)
+	CreateRefreshToken(userId int, tokenHash string, expiresAt time.Time, mfa bool) error
+	RefreshToken(tokenHash string) (RefreshToken, error)
+	RotateRefreshToken(id, userId int, tokenHash string, expiresAt time.Time) (rotated bool, err error)
+	RevokeRefreshToken(userId int, tokenHash string) error
+	RevokeUserRefreshTokens(userId int) error
+	RevokeToken(jti string, expiresAt time.Time) error
+	TokenRevoked(jti string) (bool, error)
+	UserByEmail(email string) (userId int, err error)
+	CreatePasswordResetToken(userId int, tokenHash string, expiresAt time.Time) error
+	ResetPassword(tokenHash string, passwordHash string) (bool, error)
+	Username(userId int) (string, error)
+	TOTP(userId int) (TOTP, error)
+	SaveTOTPSecret(userId int, secret string) (saved bool, err error)
+	ConfirmTOTP(userId int, step int64, recoveryCodeHashes []string) (confirmed bool, err error)
+	UseTOTPStep(userId int, step int64) (bool, error)
+	UseRecoveryCode(userId int, codeHash string) (bool, error)
+	DeleteTOTP(userId int) error
+	CreateAPIKey(key APIKey) (APIKey, error)
+	APIKeys() ([]APIKey, error)
+	APIKeyByPrefix(prefix string) (APIKey, error)
+	RevokeAPIKey(id int) (bool, error)
+	TouchAPIKey(id int) error
+	UserDisabled(userId int) (bool, error)
+	IdentityUser(issuer, subject string) (userId int, err error)
+	LinkIdentity(userId int, issuer, subject string) error
+	CreateIdentityUser(identity Identity, username string, passwordHash string) (userId int, err error)
+	SyncRoles(userId int, grant []string, revoke []string) error
+}
+
+type sender interface {
+	Send(msg mailer.Message) error
+}
+
+type signingKeys interface {
+	Sign(claims jwt.Claims) (string, error)
+	Keyfunc(token *jwt.Token) (interface{}, error)
+	JWKS() keys.JWKS
+}
+
+type limiter interface {
+	Check(key string) (retryAfter time.Duration, err error)
+	Fail(key string) (retryAfter time.Duration, err error)
+	Reset(key string) error
 }
 
 type Auth struct {
-	jwtSecret []byte
-	r         repository
-	exp       int
+	keys       signingKeys
+	r          repository
+	exp        time.Duration
+	refreshExp time.Duration
+	accounts   limiter
+	clients    limiter
+	m          sender
+	publicURL  string
+	idp        identityProvider
+	groupRoles map[string]string
 }
 
-func New(jwtSecret string, tokenExp int, repo repository) Auth {
+func New(k signingKeys, accessTokenExp, refreshTokenExp time.Duration, repo repository,
+	accounts, clients limiter, m sender, publicURL string) Auth {
 	return Auth{
-		jwtSecret: []byte(jwtSecret),
-		r:         repo,
-		exp:       tokenExp,
+		keys:       k,
+		r:          repo,
+		exp:        accessTokenExp,
+		refreshExp: refreshTokenExp,
+		accounts:   accounts,
+		clients:    clients,
+		m:          m,
+		publicURL:  publicURL,
 	}
 }
 
-func (a Auth) Authenticate(username string, passwordHash string) (token string, err error) {
+// dummyPasswordHash is a bcrypt hash of a random password, made with the cost
+// of password.Hash, that logins of unknown users are checked against.
+const dummyPasswordHash = "$2a$12$LUadancITnkmvJYoR/m/..03Eahndhot0p0f4V64B6tAzVv7qD7ju"
+
+func (a Auth) Authenticate(username string, passwd string, clientIP string) (Tokens, error) {
+	if err := a.checkLimits(username, clientIP); err != nil {
+		return Tokens{}, err
+	}
+
 	userCreds, err := a.r.GetUser(username)
-	if errors.Is(ErrUserNotFound, err) {
+	if errors.Is(err, ErrUserNotFound) {
+		log.Println(err)
+		// Compare against a dummy hash so that unknown usernames take as long
+		// to reject as wrong passwords and cannot be told apart by timing.
+		_, _ = password.Verify(dummyPasswordHash, passwd)
+		return Tokens{}, a.loginFailed(username, clientIP)
+	}
+	if err != nil {
+		log.Println(err)
+		return Tokens{}, ErrInternalError
+	}
+
+	needsRehash, err := password.Verify(userCreds.PasswordHash, passwd)
+	if errors.Is(err, password.ErrMismatch) {
+		return Tokens{}, a.loginFailed(username, clientIP)
+	}
+	if err != nil {
+		log.Println(err)
+		return Tokens{}, ErrInternalError
+	}
+
+	if err = a.accounts.Reset(accountKey(username)); err != nil {
+		log.Println("failed to reset login attempts:", err)
+	}
+
+	if needsRehash {
+		a.upgradePasswordHash(userCreds.ID, passwd)
+	}
+
+	if userCreds.Disabled {
+		return Tokens{}, ErrAccountDisabled
+	}
+
+	if userCreds.MFAEnabled {
+		mfaToken, err := a.generateMFAToken(userCreds.ID)
+		if err != nil {
+			return Tokens{}, ErrInternalError
+		}
+		return Tokens{MFAToken: mfaToken}, nil
+	}
+
+	return a.issueTokens(userCreds.ID, false)
+}
+
+func (a Auth) Refresh(refreshToken string) (Tokens, error) {
+	stored, err := a.r.RefreshToken(token.Hash(refreshToken))
+	if errors.Is(err, ErrTokenNotFound) {
+		return Tokens{}, ErrInvalidToken
+	}
+	if err != nil {
+		log.Println(err)
+		return Tokens{}, ErrInternalError
+	}
+
+	if stored.Revoked {
+		log.Printf("revoked refresh token reused, revoking all tokens of user %d", stored.UserID)
+		if err = a.r.RevokeUserRefreshTokens(stored.UserID); err != nil {
+			log.Println(err)
+		}
+		return Tokens{}, ErrRevokedToken
+	}
+
+	if stored.ExpiresAt.Before(time.Now()) {
+		return Tokens{}, ErrExpiredToken
+	}
+
+	if err = a.checkDisabled(stored.UserID); err != nil {
+		return Tokens{}, err
+	}
+
+	newToken, hash, err := token.New()
+	if err != nil {
+		log.Println("failed to generate refresh token:", err)
+		return Tokens{}, ErrInternalError
+	}
+
+	rotated, err := a.r.RotateRefreshToken(stored.ID, stored.UserID, hash, time.Now().Add(a.refreshExp))
+	if err != nil {
+		log.Println(err)
+		return Tokens{}, ErrInternalError
+	}
+	if !rotated {
+		return Tokens{}, ErrRevokedToken
+	}
+
+	accessToken, err := a.generateJWT(stored.UserID, amr(stored.MFA))
+	if err != nil {
+		return Tokens{}, ErrInternalError
+	}
+
+	return Tokens{AccessToken: accessToken, RefreshToken: newToken}, nil
+}
+
+func (a Auth) Logout(accessToken string, refreshToken string) error {
+	claims, err := a.parseToken(accessToken)
+	if err != nil {
+		return err
+	}
+
+	// Only access tokens can be logged out, they are the ones without a type.
+	if typ, _ := claims["typ"].(string); typ != "" {
+		return ErrInvalidToken
+	}
+
+	userID := int(claims["user_id"].(float64))
+	jti, _ := claims["jti"].(string)
+	exp := time.Unix(int64(claims["exp"].(float64)), 0)
+
+	if err = a.r.RevokeToken(jti, exp); err != nil {
+		log.Println(err)
+		return ErrInternalError
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+
+	if err = a.r.RevokeRefreshToken(userID, token.Hash(refreshToken)); err != nil {
 		log.Println(err)
-		return "", ErrInvalidUsernameOrPassword
+		return ErrInternalError
+	}
+
+	return nil
+}
+
+func (a Auth) RequestPasswordReset(email string) error {
+	userID, err := a.r.UserByEmail(email)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil
 	}
 	if err != nil {
 		log.Println(err)
-		return "", ErrInternalError
+		return ErrInternalError
+	}
+
+	resetToken, hash, err := token.New()
+	if err != nil {
+		log.Println("failed to generate password reset token:", err)
+		return ErrInternalError
 	}
 
-	if passwordHash != userCreds.PasswordHash {
+	if err = a.r.CreatePasswordResetToken(userID, hash, time.Now().Add(resetTokenExp)); err != nil {
 		log.Println(err)
-		return "", ErrInvalidUsernameOrPassword
+		return ErrInternalError
 	}
 
-	return a.generateJWT(userCreds.ID)
+	err = a.m.Send(mailer.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("A password reset was requested for your account.\n\n"+
+			"Use the token below with %s/auth/password-reset/confirm to choose a new password:\n\n%s\n\n"+
+			"The token expires in %d minutes. If you did not request a reset, ignore this email.\n",
+			a.publicURL, resetToken, int(resetTokenExp.Minutes())),
+	})
+	if err != nil {
+		log.Println("failed to send password reset email:", err)
+	}
+
+	return nil
 }
 
-func (a Auth) generateJWT(userID int) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+func (a Auth) ResetPassword(resetToken string, newPassword string) error {
+	hash, err := password.Hash(newPassword)
+	if err != nil {
+		log.Println("failed to hash password:", err)
+		return ErrInternalError
+	}
+
+	found, err := a.r.ResetPassword(token.Hash(resetToken), hash)
+	if err != nil {
+		log.Println(err)
+		return ErrInternalError
+	}
+	if !found {
+		return ErrInvalidResetToken
+	}
+
+	return nil
+}
+
+func (a Auth) Unlock(username string) error {
+	if _, err := a.r.GetUser(username); err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return ErrUserNotFound
+		}
+		log.Println(err)
+		return ErrInternalError
+	}
+
+	if err := a.accounts.Reset(accountKey(username)); err != nil {
+		log.Println(err)
+		return ErrInternalError
+	}
+
+	return nil
+}
+
+func (a Auth) checkLimits(username string, clientIP string) error {
+	retryAfter, err := a.clients.Check(clientKey(clientIP))
+	if err != nil {
+		log.Println(err)
+		return ErrInternalError
+	}
+	if retryAfter > 0 {
+		return RetryError{Err: ErrTooManyAttempts, RetryAfter: retryAfter}
+	}
+
+	retryAfter, err = a.accounts.Check(accountKey(username))
+	if err != nil {
+		log.Println(err)
+		return ErrInternalError
+	}
+	if retryAfter > 0 {
+		return RetryError{Err: ErrAccountLocked, RetryAfter: retryAfter}
+	}
+
+	return nil
+}
+
+func (a Auth) loginFailed(username string, clientIP string) error {
+	if _, err := a.clients.Fail(clientKey(clientIP)); err != nil {
+		log.Println("failed to register failed login attempt:", err)
+	}
+
+	retryAfter, err := a.accounts.Fail(accountKey(username))
+	if err != nil {
+		log.Println("failed to register failed login attempt:", err)
+	}
+	if retryAfter > 0 {
+		log.Printf("account %q locked for %s", username, retryAfter)
+	}
+
+	return ErrInvalidUsernameOrPassword
+}
+
+func (a Auth) upgradePasswordHash(userID int, passwd string) {
+	hash, err := password.Hash(passwd)
+	if err != nil {
+		log.Println("failed to hash password:", err)
+		return
+	}
+
+	if err = a.r.UpdatePasswordHash(userID, hash); err != nil {
+		log.Println("failed to upgrade legacy password hash:", err)
+	}
+}
+
+func (a Auth) issueTokens(userID int, mfa bool) (Tokens, error) {
+	if err := a.checkDisabled(userID); err != nil {
+		return Tokens{}, err
+	}
+
+	accessToken, err := a.generateJWT(userID, amr(mfa))
+	if err != nil {
+		return Tokens{}, ErrInternalError
+	}
+
+	refreshToken, hash, err := token.New()
+	if err != nil {
+		log.Println("failed to generate refresh token:", err)
+		return Tokens{}, ErrInternalError
+	}
+
+	if err = a.r.CreateRefreshToken(userID, hash, time.Now().Add(a.refreshExp), mfa); err != nil {
+		log.Println(err)
+		return Tokens{}, ErrInternalError
+	}
+
+	return Tokens{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+func (a Auth) generateJWT(userID int, amr []string) (string, error) {
+	jti, err := randomString(jtiLength, hex.EncodeToString)
+	if err != nil {
+		log.Println("failed to generate token id:", err)
+		return "", err
+	}
+
+	access, err := a.r.Access(userID)
+	if err != nil {
+		log.Println("failed to get user permissions:", err)
+		return "", err
+	}
+
+	now := time.Now()
+	signedToken, err := a.keys.Sign(jwt.MapClaims{
 		"user_id": userID,
-		"exp":     time.Now().Add(time.Hour * time.Duration(a.exp)).Unix(),
+		"jti":     jti,
+		"iat":     now.Unix(),
+		"exp":     now.Add(a.exp).Unix(),
+		"roles":   access.Roles,
+		"perms":   access.Permissions,
+		"amr":     amr,
 	})
-	signedToken, err := token.SignedString(a.jwtSecret)
 	if err != nil {
 		log.Println("failed to sign token:", err)
 		return "", err
@@ -73,28 +469,83 @@ func (a Auth) generateJWT(userID int) (string, error) {
 	return signedToken, nil
 }
 
-func (a Auth) VerifyToken(token string) (userID int, err error) {
-	parsedToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, ErrInvalidSigningMethod
-		}
-		return a.jwtSecret, nil
-	})
+func (a Auth) VerifyToken(token string) (Claims, error) {
+	claims, err := a.parseToken(token)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	if typ, _ := claims["typ"].(string); typ != "" {
+		return Claims{}, ErrInvalidToken
+	}
+
+	if a.tokenIsExpired(claims) {
+		return Claims{}, ErrExpiredToken
+	}
+
+	revoked, err := a.r.TokenRevoked(claims["jti"].(string))
+	if err != nil {
+		log.Println("failed to check if token is revoked:", err)
+		return Claims{}, ErrInternalError
+	}
+	if revoked {
+		return Claims{}, ErrRevokedToken
+	}
+
+	userID := int(claims["user_id"].(float64))
+	if err = a.checkDisabled(userID); err != nil {
+		return Claims{}, err
+	}
+
+	return Claims{
+		UserID:      userID,
+		Roles:       stringsClaim(claims, "roles"),
+		Permissions: stringsClaim(claims, "perms"),
+		AMR:         stringsClaim(claims, "amr"),
+	}, nil
+}
+
+func (a Auth) parseToken(token string) (jwt.MapClaims, error) {
+	parsedToken, err := jwt.Parse(token, a.keys.Keyfunc)
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, ErrExpiredToken
+	}
 	if err != nil {
 		log.Println("failed to parse token:", err)
-		return 0, ErrInvalidToken
+		return nil, ErrInvalidToken
 	}
 
 	claims, ok := parsedToken.Claims.(jwt.MapClaims)
-	if ok && parsedToken.Valid {
-		if a.tokenIsExpired(claims) {
-			return 0, ErrExpiredToken
-		}
-		userID := int(claims["user_id"].(float64))
-		return userID, nil
+	if !ok || !parsedToken.Valid {
+		return nil, ErrInvalidToken
 	}
 
-	return 0, ErrInvalidToken
+	if _, ok = claims["user_id"].(float64); !ok {
+		return nil, ErrInvalidToken
+	}
+	if _, ok = claims["exp"].(float64); !ok {
+		return nil, ErrInvalidToken
+	}
+	if jti, ok := claims["jti"].(string); !ok || jti == "" {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+func (a Auth) checkDisabled(userID int) error {
+	disabled, err := a.r.UserDisabled(userID)
+	if errors.Is(err, ErrUserNotFound) {
+		return ErrInvalidToken
+	}
+	if err != nil {
+		log.Println("failed to check if user is disabled:", err)
+		return ErrInternalError
+	}
+	if disabled {
+		return ErrAccountDisabled
+	}
+	return nil
 }
 
 func (a Auth) tokenIsExpired(claims jwt.MapClaims) bool {
@@ -103,16 +554,33 @@ func (a Auth) tokenIsExpired(claims jwt.MapClaims) bool {
 	return exp.Before(now)
 }
 
-func (a Auth) UserPermissions(id int) (string, error) {
-	perms, err := a.r.Permissions(id)
-	if errors.Is(err, ErrUserNotFound) {
-		log.Println("failed to get user permissions:", ErrUserNotFound)
+func (a Auth) JWKS() keys.JWKS {
+	return a.keys.JWKS()
+}
+
+func accountKey(username string) string {
+	return "account:" + username
+}
+
+func clientKey(ip string) string {
+	return "ip:" + ip
+}
+
+func randomString(n int, encode func([]byte) string) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
-	if err != nil {
-		log.Println("failed to get user permissions:", err)
-		return "", ErrInternalError
-	}
+	return encode(b), nil
+}
 
-	return perms, nil
+func stringsClaim(claims jwt.MapClaims, name string) []string {
+	values, _ := claims[name].([]interface{})
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if str, ok := v.(string); ok {
+			result = append(result, str)
+		}
+	}
+	return result
 }
@@ -1,108 +1,987 @@
 package service
 
 import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/auth/keys"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/auth/lockout"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/password"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/token"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/pkg/mailer"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/pkg/totp"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
-	"github.com/dgrijalva/jwt-go"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
 	"testing"
 	"time"
 )
 
 type mockRepository struct {
-	creds Credentials
-	err   error
+	creds         Credentials
+	err           error
+	updatedHash   string
+	refreshTokens map[string]*RefreshToken
+	revoked       map[string]bool
+	emails        map[string]int
+	resetTokens   map[string]int
+	totp          *TOTP
+	recoveryCodes map[string]bool
+	apiKeys       []APIKey
+	identities    map[string]int
+	usernames     map[int]string
+	grantedRoles  []string
+	revokedRoles  []string
+	disabled      map[int]bool
 }
 
-func (m mockRepository) Permissions(userId int) (string, error) {
-	return "", nil
+func newMockRepository() *mockRepository {
+	return &mockRepository{
+		refreshTokens: map[string]*RefreshToken{},
+		revoked:       map[string]bool{},
+		emails:        map[string]int{},
+		resetTokens:   map[string]int{},
+		identities:    map[string]int{},
+		usernames:     map[int]string{},
+		disabled:      map[int]bool{},
+	}
 }
 
-func (m mockRepository) GetUser(username string) (Credentials, error) {
-	return m.creds, m.err
+func (m *mockRepository) UserByEmail(email string) (int, error) {
+	userId, ok := m.emails[email]
+	if !ok {
+		return 0, ErrUserNotFound
+	}
+	return userId, nil
+}
+
+func (m *mockRepository) CreatePasswordResetToken(userId int, tokenHash string, expiresAt time.Time) error {
+	m.resetTokens[tokenHash] = userId
+	return nil
+}
+
+func (m *mockRepository) ResetPassword(tokenHash string, passwordHash string) (bool, error) {
+	userId, ok := m.resetTokens[tokenHash]
+	if !ok {
+		return false, nil
+	}
+	delete(m.resetTokens, tokenHash)
+	m.updatedHash = passwordHash
+	return true, m.RevokeUserRefreshTokens(userId)
+}
+
+func (m *mockRepository) CreateRefreshToken(userId int, tokenHash string, expiresAt time.Time, mfa bool) error {
+	m.refreshTokens[tokenHash] = &RefreshToken{
+		ID:        len(m.refreshTokens) + 1,
+		UserID:    userId,
+		ExpiresAt: expiresAt,
+		MFA:       mfa,
+	}
+	return nil
+}
+
+func (m *mockRepository) RefreshToken(tokenHash string) (RefreshToken, error) {
+	token, ok := m.refreshTokens[tokenHash]
+	if !ok {
+		return RefreshToken{}, ErrTokenNotFound
+	}
+	return *token, nil
+}
+
+func (m *mockRepository) RotateRefreshToken(id, userId int, tokenHash string, expiresAt time.Time) (bool, error) {
+	var mfa bool
+	for _, token := range m.refreshTokens {
+		if token.ID == id {
+			if token.Revoked {
+				return false, nil
+			}
+			token.Revoked = true
+			mfa = token.MFA
+		}
+	}
+	return true, m.CreateRefreshToken(userId, tokenHash, expiresAt, mfa)
+}
+
+func (m *mockRepository) RevokeRefreshToken(userId int, tokenHash string) error {
+	if token, ok := m.refreshTokens[tokenHash]; ok && token.UserID == userId {
+		token.Revoked = true
+	}
+	return nil
+}
+
+func (m *mockRepository) RevokeUserRefreshTokens(userId int) error {
+	for _, token := range m.refreshTokens {
+		if token.UserID == userId {
+			token.Revoked = true
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) RevokeToken(jti string, expiresAt time.Time) error {
+	m.revoked[jti] = true
+	return nil
+}
+
+func (m *mockRepository) TokenRevoked(jti string) (bool, error) {
+	return m.revoked[jti], nil
+}
+
+func (m *mockRepository) UpdatePasswordHash(userId int, passwordHash string) error {
+	m.updatedHash = passwordHash
+	return nil
+}
+
+func (m *mockRepository) Access(userId int) (Access, error) {
+	return Access{Roles: []string{"admin"}, Permissions: []string{"movies:write"}}, nil
+}
+
+func (m *mockRepository) GetUser(username string) (Credentials, error) {
+	creds := m.creds
+	creds.MFAEnabled = m.totp != nil && m.totp.Confirmed
+	creds.Disabled = m.disabled[creds.ID]
+	return creds, m.err
+}
+
+func (m *mockRepository) Username(userId int) (string, error) {
+	return "existing_user", nil
+}
+
+func (m *mockRepository) TOTP(userId int) (TOTP, error) {
+	if m.totp == nil {
+		return TOTP{}, ErrTOTPNotFound
+	}
+	return *m.totp, nil
+}
+
+func (m *mockRepository) SaveTOTPSecret(userId int, secret string) (bool, error) {
+	if m.totp != nil && m.totp.Confirmed {
+		return false, nil
+	}
+	m.totp = &TOTP{Secret: secret}
+	return true, nil
+}
+
+func (m *mockRepository) ConfirmTOTP(userId int, step int64, recoveryCodeHashes []string) (bool, error) {
+	m.totp.Confirmed = true
+	m.totp.LastStep = step
+	m.recoveryCodes = map[string]bool{}
+	for _, hash := range recoveryCodeHashes {
+		m.recoveryCodes[hash] = true
+	}
+	return true, nil
+}
+
+func (m *mockRepository) UseTOTPStep(userId int, step int64) (bool, error) {
+	if step <= m.totp.LastStep {
+		return false, nil
+	}
+	m.totp.LastStep = step
+	return true, nil
+}
+
+func (m *mockRepository) UseRecoveryCode(userId int, codeHash string) (bool, error) {
+	if !m.recoveryCodes[codeHash] {
+		return false, nil
+	}
+	delete(m.recoveryCodes, codeHash)
+	return true, nil
+}
+
+func (m *mockRepository) CreateAPIKey(key APIKey) (APIKey, error) {
+	key.ID = len(m.apiKeys) + 1
+	key.CreatedAt = time.Now()
+	m.apiKeys = append(m.apiKeys, key)
+	return key, nil
+}
+
+func (m *mockRepository) APIKeys() ([]APIKey, error) {
+	return m.apiKeys, nil
+}
+
+func (m *mockRepository) APIKeyByPrefix(prefix string) (APIKey, error) {
+	for _, key := range m.apiKeys {
+		if key.Prefix == prefix {
+			return key, nil
+		}
+	}
+	return APIKey{}, ErrAPIKeyNotFound
+}
+
+func (m *mockRepository) RevokeAPIKey(id int) (bool, error) {
+	for i := range m.apiKeys {
+		if m.apiKeys[i].ID == id {
+			now := time.Now()
+			m.apiKeys[i].RevokedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockRepository) TouchAPIKey(id int) error {
+	for i := range m.apiKeys {
+		if m.apiKeys[i].ID == id {
+			now := time.Now()
+			m.apiKeys[i].LastUsedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) DeleteTOTP(userId int) error {
+	m.totp = nil
+	m.recoveryCodes = nil
+	return nil
+}
+
+func (m *mockRepository) IdentityUser(issuer, subject string) (int, error) {
+	userId, ok := m.identities[issuer+"|"+subject]
+	if !ok {
+		return 0, ErrUserNotFound
+	}
+	return userId, nil
+}
+
+func (m *mockRepository) LinkIdentity(userId int, issuer, subject string) error {
+	m.identities[issuer+"|"+subject] = userId
+	return nil
+}
+
+func (m *mockRepository) CreateIdentityUser(identity Identity, username string, passwordHash string) (int, error) {
+	userId := 100 + len(m.usernames)
+	m.usernames[userId] = username
+	m.identities[identity.Issuer+"|"+identity.Subject] = userId
+	return userId, nil
+}
+
+func (m *mockRepository) SyncRoles(userId int, grant []string, revoke []string) error {
+	m.grantedRoles = grant
+	m.revokedRoles = revoke
+	return nil
+}
+
+func (m *mockRepository) UserDisabled(userId int) (bool, error) {
+	return m.disabled[userId], nil
+}
+
+func newAuth(repo *mockRepository, refreshExp time.Duration) Auth {
+	return New(keys.NewHMAC("test", []byte("secret-key")), time.Hour, refreshExp, repo,
+		newLimiter(), newLimiter(), mailer.NewMemory(), "http://localhost:8080")
+}
+
+func newLimiter() lockout.Limiter {
+	return lockout.New(lockout.NewMemoryStore(), lockout.Policy{
+		MaxFailures: 3,
+		BaseDelay:   time.Minute,
+		MaxDelay:    time.Hour,
+		Window:      time.Hour,
+	})
 }
 
 func TestAuthenticate(t *testing.T) {
-	repo := mockRepository{}
+	repo := newMockRepository()
 
-	hasher := sha256.New()
-	hasher.Write([]byte("password"))
-	hashedPassword := hex.EncodeToString(hasher.Sum(nil))
+	hashedPassword, err := password.Hash("password")
+	assert.NoError(t, err)
 
 	repo.creds = Credentials{ID: 1, PasswordHash: hashedPassword}
 
 	t.Run("Valid auth", func(t *testing.T) {
 		repo.err = nil
-		auth := New("secret-key", 24, repo)
-		token, err := auth.Authenticate("existing_user", hashedPassword)
+		auth := newAuth(repo, 24*time.Hour)
+		tokens, err := auth.Authenticate("existing_user", "password", "127.0.0.1")
 		assert.Nil(t, err)
-		assert.NotEmpty(t, token)
+		assert.NotEmpty(t, tokens.AccessToken)
+		assert.NotEmpty(t, tokens.RefreshToken)
+		assert.Empty(t, repo.updatedHash, "bcrypt hash should not be upgraded")
 	})
 
 	t.Run("Invalid username", func(t *testing.T) {
 		repo.err = ErrUserNotFound
-		auth := New("secret-key", 24, repo)
-		token, err := auth.Authenticate("non_existing_user", hashedPassword)
+		auth := newAuth(repo, 24*time.Hour)
+		tokens, err := auth.Authenticate("non_existing_user", "password", "127.0.0.1")
 		assert.Equal(t, ErrInvalidUsernameOrPassword, err)
-		assert.Empty(t, token)
+		assert.Empty(t, tokens)
+	})
+
+	t.Run("Dummy hash costs as much as a real one", func(t *testing.T) {
+		_, err := password.Verify(dummyPasswordHash, "password")
+		assert.ErrorIs(t, err, password.ErrMismatch)
+
+		dummyCost, err := bcrypt.Cost([]byte(dummyPasswordHash))
+		require.NoError(t, err)
+		hashCost, err := bcrypt.Cost([]byte(hashedPassword))
+		require.NoError(t, err)
+		assert.Equal(t, hashCost, dummyCost)
 	})
 
 	t.Run("Invalid password", func(t *testing.T) {
-		repo.err = ErrUserNotFound
-		auth := New("secret-key", 24, repo)
-		token, err := auth.Authenticate("existing_user", "invalid_password")
+		repo.err = nil
+		auth := newAuth(repo, 24*time.Hour)
+		tokens, err := auth.Authenticate("existing_user", "invalid_password", "127.0.0.1")
 		assert.Equal(t, ErrInvalidUsernameOrPassword, err)
-		assert.Empty(t, token)
+		assert.Empty(t, tokens)
+	})
+
+	t.Run("Hashed password is not accepted as password", func(t *testing.T) {
+		repo.err = nil
+		auth := newAuth(repo, 24*time.Hour)
+		tokens, err := auth.Authenticate("existing_user", hashedPassword, "127.0.0.1")
+		assert.Equal(t, ErrInvalidUsernameOrPassword, err)
+		assert.Empty(t, tokens)
+	})
+
+	t.Run("Disabled account", func(t *testing.T) {
+		repo.err = nil
+		repo.disabled[1] = true
+		defer delete(repo.disabled, 1)
+
+		auth := newAuth(repo, 24*time.Hour)
+		tokens, err := auth.Authenticate("existing_user", "password", "127.0.0.1")
+		assert.Equal(t, ErrAccountDisabled, err)
+		assert.Empty(t, tokens)
+	})
+}
+
+func TestAuthenticateLegacyHash(t *testing.T) {
+	hasher := sha256.New()
+	hasher.Write([]byte("password"))
+	legacyHash := strings.ToUpper(hex.EncodeToString(hasher.Sum(nil)))
+
+	repo := newMockRepository()
+	repo.creds = Credentials{ID: 1, PasswordHash: legacyHash}
+	auth := newAuth(repo, 24*time.Hour)
+
+	t.Run("invalid password is not upgraded", func(t *testing.T) {
+		tokens, err := auth.Authenticate("existing_user", "invalid_password", "127.0.0.1")
+		assert.Equal(t, ErrInvalidUsernameOrPassword, err)
+		assert.Empty(t, tokens)
+		assert.Empty(t, repo.updatedHash)
+	})
+
+	t.Run("valid password upgrades hash", func(t *testing.T) {
+		tokens, err := auth.Authenticate("existing_user", "password", "127.0.0.1")
+		assert.NoError(t, err)
+		assert.NotEmpty(t, tokens.AccessToken)
+
+		needsRehash, err := password.Verify(repo.updatedHash, "password")
+		assert.NoError(t, err)
+		assert.False(t, needsRehash)
+	})
+}
+
+func TestAuthenticateLockout(t *testing.T) {
+	repo := newMockRepository()
+	hashedPassword, err := password.Hash("password")
+	assert.NoError(t, err)
+	repo.creds = Credentials{ID: 1, PasswordHash: hashedPassword}
+
+	t.Run("account is locked after too many failures", func(t *testing.T) {
+		auth := newAuth(repo, 24*time.Hour)
+		for i := 0; i < 3; i++ {
+			_, err := auth.Authenticate("existing_user", "invalid_password", fmt.Sprintf("10.0.0.%d", i))
+			assert.ErrorIs(t, err, ErrInvalidUsernameOrPassword)
+		}
+
+		_, err := auth.Authenticate("existing_user", "password", "10.0.0.10")
+		assert.ErrorIs(t, err, ErrAccountLocked)
+
+		var retryErr RetryError
+		assert.True(t, errors.As(err, &retryErr))
+		assert.Greater(t, retryErr.RetryAfter, time.Duration(0))
+
+		_, err = auth.Authenticate("other_user", "password", "10.0.0.10")
+		assert.NoError(t, err)
+	})
+
+	t.Run("client is blocked after too many failures", func(t *testing.T) {
+		auth := newAuth(repo, 24*time.Hour)
+		for i := 0; i < 3; i++ {
+			_, err := auth.Authenticate(fmt.Sprintf("user%d", i), "invalid_password", "10.0.0.1")
+			assert.ErrorIs(t, err, ErrInvalidUsernameOrPassword)
+		}
+
+		_, err := auth.Authenticate("existing_user", "password", "10.0.0.1")
+		assert.ErrorIs(t, err, ErrTooManyAttempts)
+
+		_, err = auth.Authenticate("existing_user", "password", "10.0.0.2")
+		assert.NoError(t, err)
+	})
+
+	t.Run("successful login resets account failures", func(t *testing.T) {
+		auth := newAuth(repo, 24*time.Hour)
+		for i := 0; i < 2; i++ {
+			_, err := auth.Authenticate("existing_user", "invalid_password", fmt.Sprintf("10.0.0.%d", i))
+			assert.ErrorIs(t, err, ErrInvalidUsernameOrPassword)
+		}
+
+		_, err := auth.Authenticate("existing_user", "password", "10.0.0.5")
+		assert.NoError(t, err)
+
+		_, err = auth.Authenticate("existing_user", "invalid_password", "10.0.0.6")
+		assert.ErrorIs(t, err, ErrInvalidUsernameOrPassword)
+		_, err = auth.Authenticate("existing_user", "password", "10.0.0.7")
+		assert.NoError(t, err)
+	})
+
+	t.Run("unlock", func(t *testing.T) {
+		auth := newAuth(repo, 24*time.Hour)
+		for i := 0; i < 3; i++ {
+			_, _ = auth.Authenticate("existing_user", "invalid_password", fmt.Sprintf("10.0.0.%d", i))
+		}
+
+		assert.NoError(t, auth.Unlock("existing_user"))
+
+		_, err := auth.Authenticate("existing_user", "password", "10.0.0.10")
+		assert.NoError(t, err)
+	})
+}
+
+func TestPasswordReset(t *testing.T) {
+	repo := newMockRepository()
+	hashedPassword, err := password.Hash("password")
+	require.NoError(t, err)
+	repo.creds = Credentials{ID: 1, PasswordHash: hashedPassword}
+	repo.emails["user@example.com"] = 1
+
+	m := mailer.NewMemory()
+	auth := newAuth(repo, 24*time.Hour)
+	auth.m = m
+
+	tokens, err := auth.Authenticate("existing_user", "password", "127.0.0.1")
+	require.NoError(t, err)
+
+	t.Run("unknown email is not revealed", func(t *testing.T) {
+		err := auth.RequestPasswordReset("unknown@example.com")
+		assert.NoError(t, err)
+		assert.Empty(t, m.Messages())
+	})
+
+	require.NoError(t, auth.RequestPasswordReset("user@example.com"))
+	messages := m.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, "user@example.com", messages[0].To)
+
+	var resetToken string
+	for hash := range repo.resetTokens {
+		for _, line := range strings.Split(messages[0].Body, "\n") {
+			if token.Hash(line) == hash {
+				resetToken = line
+			}
+		}
+	}
+	require.NotEmpty(t, resetToken, "reset token should be sent by email")
+
+	t.Run("invalid token", func(t *testing.T) {
+		err := auth.ResetPassword("invalid", "new_password")
+		assert.ErrorIs(t, err, ErrInvalidResetToken)
+	})
+
+	t.Run("password is reset", func(t *testing.T) {
+		err := auth.ResetPassword(resetToken, "new_password")
+		assert.NoError(t, err)
+
+		_, err = password.Verify(repo.updatedHash, "new_password")
+		assert.NoError(t, err)
+
+		_, err = auth.Refresh(tokens.RefreshToken)
+		assert.ErrorIs(t, err, ErrRevokedToken, "refresh tokens should be revoked")
+	})
+
+	t.Run("token is single use", func(t *testing.T) {
+		err := auth.ResetPassword(resetToken, "other_password")
+		assert.ErrorIs(t, err, ErrInvalidResetToken)
 	})
 }
 
 func createTokenString(secret []byte, userID int, tokenExp int) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"user_id": userID,
+		"jti":     "test-jti",
 		"exp":     time.Now().Add(time.Hour * time.Duration(tokenExp)).Unix(),
 	})
+	token.Header["kid"] = "test"
 
 	return token.SignedString(secret)
 }
 
 func TestVerifyToken(t *testing.T) {
-	repo := mockRepository{}
+	repo := newMockRepository()
 
 	repo.creds = Credentials{}
-	auth := New("secret-key", 24, repo)
+	auth := newAuth(repo, 24*time.Hour)
 
 	t.Run("valid token", func(t *testing.T) {
 		token, _ := createTokenString([]byte("secret-key"), 1, 24)
-		userID, err := auth.VerifyToken(token)
+		claims, err := auth.VerifyToken(token)
 
 		assert.Nil(t, err, "unexpected error occurred: %w", err)
-		assert.Equal(t, 1, userID)
+		assert.Equal(t, 1, claims.UserID)
 	})
 
 	t.Run("invalid token", func(t *testing.T) {
 		invalidToken := "invalid_token"
-		userID, err := auth.VerifyToken(invalidToken)
+		claims, err := auth.VerifyToken(invalidToken)
 
 		assert.Equal(t, ErrInvalidToken, err)
-		assert.Equal(t, 0, userID,
+		assert.Equal(t, 0, claims.UserID,
 			"user id should be empty when token is invalid")
 	})
 
 	t.Run("invalid signing method", func(t *testing.T) {
 		invalidToken, _ := createTokenString([]byte("invalid-secret-key"), 1, 24)
-		userID, err := auth.VerifyToken(invalidToken)
+		claims, err := auth.VerifyToken(invalidToken)
 
 		assert.Equal(t, ErrInvalidToken, err)
-		assert.Equal(t, 0, userID,
+		assert.Equal(t, 0, claims.UserID,
 			"user id should be empty when token was signed by invalid method")
 	})
 
+	t.Run("token without id", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"user_id": 1,
+			"exp":     time.Now().Add(time.Hour).Unix(),
+		})
+		token.Header["kid"] = "test"
+		signedToken, _ := token.SignedString([]byte("secret-key"))
+		claims, err := auth.VerifyToken(signedToken)
+
+		assert.Equal(t, ErrInvalidToken, err)
+		assert.Equal(t, 0, claims.UserID)
+	})
+
+	t.Run("revoked token", func(t *testing.T) {
+		repo.revoked["test-jti"] = true
+		defer delete(repo.revoked, "test-jti")
+
+		token, _ := createTokenString([]byte("secret-key"), 1, 24)
+		claims, err := auth.VerifyToken(token)
+
+		assert.Equal(t, ErrRevokedToken, err)
+		assert.Equal(t, 0, claims.UserID)
+	})
+
+	t.Run("disabled user", func(t *testing.T) {
+		repo.disabled[1] = true
+		defer delete(repo.disabled, 1)
+
+		token, _ := createTokenString([]byte("secret-key"), 1, 24)
+		claims, err := auth.VerifyToken(token)
+
+		assert.Equal(t, ErrAccountDisabled, err)
+		assert.Equal(t, 0, claims.UserID)
+	})
+
 	t.Run("expired token", func(t *testing.T) {
 		auth.exp = 0
 		token, _ := createTokenString([]byte("secret-key"), 1, 0)
-		userID, err := auth.VerifyToken(token)
+		claims, err := auth.VerifyToken(token)
 
 		assert.Equal(t, ErrExpiredToken, err)
-		assert.Empty(t, userID, "user id should be empty when token is expired")
+		assert.Empty(t, claims.UserID, "user id should be empty when token is expired")
+	})
+}
+
+func TestRefresh(t *testing.T) {
+	repo := newMockRepository()
+	hashedPassword, err := password.Hash("password")
+	assert.NoError(t, err)
+	repo.creds = Credentials{ID: 1, PasswordHash: hashedPassword}
+
+	auth := newAuth(repo, 24*time.Hour)
+
+	t.Run("refresh token is rotated", func(t *testing.T) {
+		tokens, err := auth.Authenticate("existing_user", "password", "127.0.0.1")
+		assert.NoError(t, err)
+
+		refreshed, err := auth.Refresh(tokens.RefreshToken)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, refreshed.AccessToken)
+		assert.NotEqual(t, tokens.RefreshToken, refreshed.RefreshToken)
+
+		claims, err := auth.VerifyToken(refreshed.AccessToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, claims.UserID)
+		assert.Equal(t, []string{"admin"}, claims.Roles)
+		assert.Equal(t, []string{"movies:write"}, claims.Permissions)
+	})
+
+	t.Run("disabled user can not refresh", func(t *testing.T) {
+		tokens, err := auth.Authenticate("existing_user", "password", "127.0.0.1")
+		require.NoError(t, err)
+
+		repo.disabled[1] = true
+		defer delete(repo.disabled, 1)
+
+		_, err = auth.Refresh(tokens.RefreshToken)
+		assert.ErrorIs(t, err, ErrAccountDisabled)
+	})
+
+	t.Run("reused refresh token revokes all user tokens", func(t *testing.T) {
+		tokens, err := auth.Authenticate("existing_user", "password", "127.0.0.1")
+		assert.NoError(t, err)
+
+		refreshed, err := auth.Refresh(tokens.RefreshToken)
+		assert.NoError(t, err)
+
+		_, err = auth.Refresh(tokens.RefreshToken)
+		assert.ErrorIs(t, err, ErrRevokedToken)
+
+		_, err = auth.Refresh(refreshed.RefreshToken)
+		assert.ErrorIs(t, err, ErrRevokedToken)
+	})
+
+	t.Run("unknown refresh token", func(t *testing.T) {
+		_, err := auth.Refresh("unknown")
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("expired refresh token", func(t *testing.T) {
+		auth := newAuth(repo, -time.Hour)
+		tokens, err := auth.Authenticate("existing_user", "password", "127.0.0.1")
+		assert.NoError(t, err)
+
+		_, err = auth.Refresh(tokens.RefreshToken)
+		assert.ErrorIs(t, err, ErrExpiredToken)
+	})
+}
+
+func TestLogout(t *testing.T) {
+	repo := newMockRepository()
+	hashedPassword, err := password.Hash("password")
+	assert.NoError(t, err)
+	repo.creds = Credentials{ID: 1, PasswordHash: hashedPassword}
+
+	auth := newAuth(repo, 24*time.Hour)
+
+	tokens, err := auth.Authenticate("existing_user", "password", "127.0.0.1")
+	assert.NoError(t, err)
+
+	err = auth.Logout(tokens.AccessToken, tokens.RefreshToken)
+	assert.NoError(t, err)
+
+	_, err = auth.VerifyToken(tokens.AccessToken)
+	assert.ErrorIs(t, err, ErrRevokedToken)
+
+	_, err = auth.Refresh(tokens.RefreshToken)
+	assert.ErrorIs(t, err, ErrRevokedToken)
+
+	mfaToken, err := auth.generateMFAToken(1)
+	require.NoError(t, err)
+	err = auth.Logout(mfaToken, "")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	stateToken, err := auth.keys.Sign(jwt.MapClaims{
+		"typ": oidcStateTokenType,
+		"exp": time.Now().Add(time.Minute).Unix(),
+	})
+	require.NoError(t, err)
+	err = auth.Logout(stateToken, "")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestMFA(t *testing.T) {
+	repo := newMockRepository()
+	hashedPassword, err := password.Hash("password")
+	require.NoError(t, err)
+	repo.creds = Credentials{ID: 1, PasswordHash: hashedPassword}
+	auth := newAuth(repo, 24*time.Hour)
+
+	enrollment, err := auth.EnrollTOTP(1)
+	require.NoError(t, err)
+	assert.Contains(t, enrollment.URI, "secret="+enrollment.Secret)
+
+	t.Run("confirm with invalid code", func(t *testing.T) {
+		_, err := auth.ConfirmTOTP(1, "000000")
+		assert.ErrorIs(t, err, ErrInvalidMFACode)
+	})
+
+	code, err := totp.Code(enrollment.Secret, totp.Step(time.Now()))
+	require.NoError(t, err)
+	recoveryCodes, err := auth.ConfirmTOTP(1, code)
+	require.NoError(t, err)
+	assert.Len(t, recoveryCodes, 10)
+
+	t.Run("enrolling again fails", func(t *testing.T) {
+		_, err := auth.EnrollTOTP(1)
+		assert.ErrorIs(t, err, ErrTOTPAlreadyEnabled)
+	})
+
+	login := func(t *testing.T) string {
+		tokens, err := auth.Authenticate("existing_user", "password", "127.0.0.1")
+		require.NoError(t, err)
+		assert.Empty(t, tokens.AccessToken)
+		assert.Empty(t, tokens.RefreshToken)
+		require.NotEmpty(t, tokens.MFAToken)
+		return tokens.MFAToken
+	}
+
+	t.Run("challenge token is not an access token", func(t *testing.T) {
+		_, err := auth.VerifyToken(login(t))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("used code is rejected", func(t *testing.T) {
+		_, err := auth.VerifyMFA(login(t), code)
+		assert.ErrorIs(t, err, ErrInvalidMFACode)
+	})
+
+	t.Run("access token is not a challenge token", func(t *testing.T) {
+		nextCode, err := totp.Code(enrollment.Secret, totp.Step(time.Now())+1)
+		require.NoError(t, err)
+
+		repo.totp.Confirmed = false
+		tokens, err := auth.Authenticate("existing_user", "password", "127.0.0.1")
+		repo.totp.Confirmed = true
+		require.NoError(t, err)
+
+		_, err = auth.VerifyMFA(tokens.AccessToken, nextCode)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("valid code completes login", func(t *testing.T) {
+		mfaToken := login(t)
+		nextCode, err := totp.Code(enrollment.Secret, totp.Step(time.Now())+1)
+		require.NoError(t, err)
+
+		tokens, err := auth.VerifyMFA(mfaToken, nextCode)
+		require.NoError(t, err)
+
+		claims, err := auth.VerifyToken(tokens.AccessToken)
+		require.NoError(t, err)
+		assert.Contains(t, claims.AMR, AMRMFA)
+
+		refreshed, err := auth.Refresh(tokens.RefreshToken)
+		require.NoError(t, err)
+		claims, err = auth.VerifyToken(refreshed.AccessToken)
+		require.NoError(t, err)
+		assert.Contains(t, claims.AMR, AMRMFA, "refreshed token should keep MFA")
+
+		_, err = auth.VerifyMFA(mfaToken, recoveryCodes[0])
+		assert.ErrorIs(t, err, ErrRevokedToken, "challenge token should be single use")
+	})
+
+	t.Run("recovery code is single use", func(t *testing.T) {
+		_, err := auth.VerifyMFA(login(t), strings.ToUpper(recoveryCodes[1]))
+		assert.NoError(t, err)
+
+		_, err = auth.VerifyMFA(login(t), recoveryCodes[1])
+		assert.ErrorIs(t, err, ErrInvalidMFACode)
+	})
+
+	t.Run("password login has no MFA", func(t *testing.T) {
+		claims, err := auth.VerifyToken(func() string {
+			repo.totp.Confirmed = false
+			defer func() { repo.totp.Confirmed = true }()
+			tokens, err := auth.Authenticate("existing_user", "password", "127.0.0.1")
+			require.NoError(t, err)
+			return tokens.AccessToken
+		}())
+		require.NoError(t, err)
+		assert.Equal(t, []string{AMRPassword}, claims.AMR)
+	})
+
+	t.Run("too many invalid codes", func(t *testing.T) {
+		require.NoError(t, auth.accounts.Reset(mfaKey(1)))
+		mfaToken := login(t)
+		for i := 0; i < 3; i++ {
+			_, err := auth.VerifyMFA(mfaToken, "000000")
+			assert.ErrorIs(t, err, ErrInvalidMFACode)
+		}
+
+		_, err := auth.VerifyMFA(mfaToken, recoveryCodes[2])
+		assert.ErrorIs(t, err, ErrTooManyAttempts)
+		require.NoError(t, auth.accounts.Reset(mfaKey(1)))
+	})
+
+	t.Run("disable", func(t *testing.T) {
+		err := auth.DisableTOTP(1, "000000")
+		assert.ErrorIs(t, err, ErrInvalidMFACode)
+
+		err = auth.DisableTOTP(1, recoveryCodes[3])
+		assert.NoError(t, err)
+
+		tokens, err := auth.Authenticate("existing_user", "password", "127.0.0.1")
+		require.NoError(t, err)
+		assert.NotEmpty(t, tokens.AccessToken)
+	})
+}
+
+func TestAPIKeys(t *testing.T) {
+	repo := newMockRepository()
+	auth := newAuth(repo, 24*time.Hour)
+
+	t.Run("scope not granted to owner", func(t *testing.T) {
+		_, _, err := auth.CreateAPIKey("kiosk", 1, []string{"halls:write"}, nil)
+		assert.ErrorIs(t, err, ErrInvalidScope)
+	})
+
+	key, created, err := auth.CreateAPIKey("kiosk", 1, []string{"movies:write"}, nil)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, "ck_"+created.Prefix+"_"))
+	assert.NotEqual(t, key, created.Hash, "key should be stored hashed")
+
+	t.Run("valid key", func(t *testing.T) {
+		claims, err := auth.VerifyAPIKey(key)
+		require.NoError(t, err)
+		assert.Equal(t, 1, claims.UserID)
+		assert.Equal(t, []string{"movies:write"}, claims.Permissions)
+		assert.Equal(t, []string{AMRAPIKey}, claims.AMR)
+		assert.NotNil(t, repo.apiKeys[0].LastUsedAt)
+	})
+
+	t.Run("wrong secret", func(t *testing.T) {
+		_, err := auth.VerifyAPIKey("ck_" + created.Prefix + "_wrong")
+		assert.ErrorIs(t, err, ErrInvalidAPIKey)
+	})
+
+	t.Run("malformed key", func(t *testing.T) {
+		_, err := auth.VerifyAPIKey("not-a-key")
+		assert.ErrorIs(t, err, ErrInvalidAPIKey)
+	})
+
+	t.Run("expired key", func(t *testing.T) {
+		expiresAt := time.Now().Add(time.Hour)
+		expiredKey, _, err := auth.CreateAPIKey("partner", 1, nil, &expiresAt)
+		require.NoError(t, err)
+
+		past := time.Now().Add(-time.Minute)
+		repo.apiKeys[1].ExpiresAt = &past
+
+		_, err = auth.VerifyAPIKey(expiredKey)
+		assert.ErrorIs(t, err, ErrExpiredToken)
+	})
+
+	t.Run("revoked key", func(t *testing.T) {
+		require.NoError(t, auth.RevokeAPIKey(created.ID))
+
+		_, err := auth.VerifyAPIKey(key)
+		assert.ErrorIs(t, err, ErrRevokedToken)
+	})
+
+	t.Run("revoke unknown key", func(t *testing.T) {
+		err := auth.RevokeAPIKey(100)
+		assert.ErrorIs(t, err, ErrAPIKeyNotFound)
+	})
+}
+
+type mockIdentityProvider struct {
+	identity      Identity
+	err           error
+	codeChallenge string
+}
+
+func (m *mockIdentityProvider) AuthCodeURL(state, nonce, codeChallenge string) string {
+	m.codeChallenge = codeChallenge
+	return "https://idp.example.com/authorize?state=" + state
+}
+
+func (m *mockIdentityProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (Identity, error) {
+	if codeChallenge(codeVerifier) != m.codeChallenge {
+		return Identity{}, errors.New("invalid code verifier")
+	}
+	return m.identity, m.err
+}
+
+func TestOIDCLogin(t *testing.T) {
+	repo := newMockRepository()
+	repo.emails["linked@example.com"] = 7
+	idp := &mockIdentityProvider{}
+	auth := newAuth(repo, 24*time.Hour).WithOIDC(idp, map[string]string{"cinema-admins": "admin"})
+
+	login := func(t *testing.T) (Tokens, error) {
+		authURL, stateToken, err := auth.StartOIDCLogin()
+		require.NoError(t, err)
+		state := strings.TrimPrefix(authURL, "https://idp.example.com/authorize?state=")
+		return auth.CompleteOIDCLogin(context.Background(), stateToken, state, "code")
+	}
+
+	t.Run("provision new user", func(t *testing.T) {
+		idp.identity = Identity{Issuer: "https://idp.example.com", Subject: "new", Username: "jane",
+			Groups: []string{"cinema-admins"}}
+
+		tokens, err := login(t)
+		require.NoError(t, err)
+
+		claims, err := auth.VerifyToken(tokens.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, 100, claims.UserID)
+		assert.Equal(t, "jane", repo.usernames[100])
+		assert.Equal(t, []string{"admin"}, repo.grantedRoles)
+		assert.Empty(t, repo.revokedRoles)
+	})
+
+	t.Run("existing identity", func(t *testing.T) {
+		idp.identity = Identity{Issuer: "https://idp.example.com", Subject: "new", Username: "jane"}
+
+		tokens, err := login(t)
+		require.NoError(t, err)
+
+		claims, err := auth.VerifyToken(tokens.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, 100, claims.UserID)
+		assert.Len(t, repo.usernames, 1)
+		assert.Equal(t, []string{"admin"}, repo.revokedRoles)
+	})
+
+	t.Run("link by verified email", func(t *testing.T) {
+		idp.identity = Identity{Issuer: "https://idp.example.com", Subject: "linked",
+			Email: "linked@example.com", EmailVerified: true, AMR: []string{"pwd", "mfa"}}
+
+		tokens, err := login(t)
+		require.NoError(t, err)
+
+		claims, err := auth.VerifyToken(tokens.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, 7, claims.UserID)
+		assert.Contains(t, claims.AMR, AMRMFA)
+		assert.Equal(t, 7, repo.identities["https://idp.example.com|linked"])
+	})
+
+	t.Run("unverified email is not linked", func(t *testing.T) {
+		idp.identity = Identity{Issuer: "https://idp.example.com", Subject: "other",
+			Email: "linked@example.com"}
+
+		tokens, err := login(t)
+		require.NoError(t, err)
+
+		claims, err := auth.VerifyToken(tokens.AccessToken)
+		require.NoError(t, err)
+		assert.NotEqual(t, 7, claims.UserID)
+		assert.Equal(t, "linked", repo.usernames[claims.UserID])
+	})
+
+	t.Run("state mismatch", func(t *testing.T) {
+		_, stateToken, err := auth.StartOIDCLogin()
+		require.NoError(t, err)
+
+		_, err = auth.CompleteOIDCLogin(context.Background(), stateToken, "forged", "code")
+		assert.ErrorIs(t, err, ErrInvalidOIDCState)
+	})
+
+	t.Run("access token as state", func(t *testing.T) {
+		tokens, err := auth.issueTokens(1, false)
+		require.NoError(t, err)
+
+		_, err = auth.CompleteOIDCLogin(context.Background(), tokens.AccessToken, "state", "code")
+		assert.ErrorIs(t, err, ErrInvalidOIDCState)
+	})
+
+	t.Run("provider error", func(t *testing.T) {
+		idp.err = errors.New("invalid_grant")
+		defer func() { idp.err = nil }()
+
+		_, err := login(t)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		_, _, err := newAuth(repo, 24*time.Hour).StartOIDCLogin()
+		assert.ErrorIs(t, err, ErrOIDCNotConfigured)
 	})
 }
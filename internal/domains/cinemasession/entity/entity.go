@@ -44,3 +44,9 @@ func (c *CinemaSession) setStatus() {
 		c.Status = StatusScheduled
 	}
 }
+
+type SeatHold struct {
+	SessionId int
+	Seats     []int
+	ExpiresAt time.Time
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/apiutils"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/cinemasession/service"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+type holdRequest struct {
+	Seats []int `json:"seats"`
+}
+
+type seatHold struct {
+	SessionId int    `json:"sessionId"`
+	Seats     []int  `json:"seats"`
+	ExpiresAt string `json:"expiresAt"`
+}
+
+func (h HttpHandler) holdSeatsHandler(w http.ResponseWriter, r *http.Request) {
+	sessionId, err := apiutils.IntPathParam(r, "sessionId")
+	if err != nil {
+		log.Println(err)
+		http.Error(w, ErrInvalidSessionId.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req holdRequest
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Println(err)
+		http.Error(w, ErrReadRequestFail.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+
+	hold, err := h.s.HoldSeats(sessionId, userID, req.Seats)
+	if errors.Is(err, service.ErrInvalidSeats) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if errors.Is(err, service.ErrCinemaSessionsNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if errors.Is(err, service.ErrSeatsUnavailable) || errors.Is(err, service.ErrTooManySeats) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	apiutils.WriteResponse(w, seatHold{
+		SessionId: hold.SessionId,
+		Seats:     hold.Seats,
+		ExpiresAt: hold.ExpiresAt.Format(time.RFC3339),
+	}, http.StatusCreated)
+}
+
+func (h HttpHandler) releaseHoldsHandler(w http.ResponseWriter, r *http.Request) {
+	sessionId, err := apiutils.IntPathParam(r, "sessionId")
+	if err != nil {
+		log.Println(err)
+		http.Error(w, ErrInvalidSessionId.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+
+	if err = h.s.ReleaseHolds(sessionId, userID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
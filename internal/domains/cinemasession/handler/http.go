@@ -30,9 +30,11 @@ type Service interface {
 	AllSessions(date string, offset, limit int) ([]entity.CinemaSession, error)
 	SessionsForHall(hallId int, date string) ([]entity.CinemaSession, error)
 	CreateSession(movieId, hallId int, startTime string, price float32) (int, error)
-	DeleteSession(id int) error
+	DeleteSession(id int, refund bool) error
 	UpdateSession(id, movieId, hallId int, startTime string, price float32) error
 	AvailableSeats(sessionId int) ([]int, error)
+	HoldSeats(sessionId, userId int, seats []int) (entity.SeatHold, error)
+	ReleaseHolds(sessionId, userId int) error
 }
 
 type AccessChecker interface {
@@ -71,10 +73,12 @@ func (h HttpHandler) SetRoutes(router *mux.Router, a AccessChecker) {
 	userRouter.HandleFunc("/", h.getAllSessionsHandler).Methods("GET")
 	userRouter.HandleFunc("/{hallId}", h.getSessionsHandler).Methods("GET")
 	userRouter.HandleFunc("/{sessionId}/seats", h.availableSeatsHandler).Methods("GET")
+	userRouter.HandleFunc("/{sessionId}/holds", h.holdSeatsHandler).Methods("POST")
+	userRouter.HandleFunc("/{sessionId}/holds", h.releaseHoldsHandler).Methods("DELETE")
 
 	adminRouter := router.PathPrefix("/cinema-sessions").Subrouter()
 	adminRouter.Use(a.Authenticate)
-	adminRouter.Use(a.CheckPerms(service.AdminRole))
+	adminRouter.Use(a.CheckPerms(service.WritePermission))
 
 	adminRouter.HandleFunc("/{sessionId}", h.updateSessionHandler).Methods("PUT")
 	adminRouter.HandleFunc("/{sessionId}", h.deleteSessionHandler).Methods("DELETE")
@@ -241,12 +245,17 @@ func (h HttpHandler) deleteSessionHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = h.s.DeleteSession(sessionId)
+	err = h.s.DeleteSession(sessionId, hasPermission(r, service.RefundPermission))
 	if errors.Is(service.ErrCinemaSessionsNotFound, err) {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 
+	if errors.Is(err, service.ErrSessionHasTickets) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -338,3 +347,14 @@ func entitiesToDTO(sessions []entity.CinemaSession) []session {
 	}
 	return DTOSessions
 }
+
+// hasPermission reports whether the caller has been granted the permission.
+func hasPermission(r *http.Request, permission string) bool {
+	perms, _ := r.Context().Value("permissions").([]string)
+	for _, p := range perms {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -3,6 +3,7 @@ package handler
 import (
 	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/cinemasession/entity"
 	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/cinemasession/service"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -43,7 +44,7 @@ func (m *mockService) SessionsForHall(hallId int, date string) ([]entity.CinemaS
 	return m.sessions, m.err
 }
 
-func (m *mockService) DeleteSession(id int) error {
+func (m *mockService) DeleteSession(id int, refund bool) error {
 	return m.err
 }
 
@@ -51,6 +52,15 @@ func (m *mockService) CreateSession(movieId, hallId int, startTime string, price
 	return m.sessionId, m.err
 }
 
+func (m *mockService) HoldSeats(sessionId, userId int, seats []int) (entity.SeatHold, error) {
+	expiresAt := time.Date(2024, 5, 18, 20, 10, 0, 0, time.UTC)
+	return entity.SeatHold{SessionId: sessionId, Seats: seats, ExpiresAt: expiresAt}, m.err
+}
+
+func (m *mockService) ReleaseHolds(sessionId, userId int) error {
+	return m.err
+}
+
 func TestGetSessionsHandler(t *testing.T) {
 	s := mockService{}
 	t.Run("successful sessions get", func(t *testing.T) {
@@ -281,23 +291,25 @@ func TestCreateSessionHandler(t *testing.T) {
 		err = json.Unmarshal(response.Body.Bytes(), &responseBody)
 		require.NoError(t, err, "failed to parse response body")
 
-		assert.Contains(t, responseBody, "session_id")
-		assert.NotZero(t, responseBody["session_id"])
+		assert.Contains(t, responseBody, "sessionId")
+		assert.NotZero(t, responseBody["sessionId"])
 	})
 
-	t.Run("invalid hall id", func(t *testing.T) {
-		hallId := "0"
+	t.Run("hall not found", func(t *testing.T) {
+		s.err = service.ErrHallNotFound
 
-		req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("cinema-sessions/%s", hallId), nil)
-		req = mux.SetURLVars(req, map[string]string{"hallId": hallId})
+		request := fmt.Sprintf(`{"movieId": %d, "hallId": %d, "startTime": "%s", "price": %f}`, 1, 100,
+			"2024-05-18 20:00:00 +04", 10.5)
+
+		req, err := http.NewRequest(http.MethodPost, "cinema-sessions/", strings.NewReader(request))
 		require.NoError(t, err, "failed to create test request")
 
 		response := httptest.NewRecorder()
 		handler := HttpHandler{s: &s}.createSessionHandler
 		handler(response, req)
 
-		assert.Equal(t, http.StatusBadRequest, response.Code)
-		assert.Equal(t, fmt.Sprintf("%s\n", ErrInvalidHallId), response.Body.String())
+		assert.Equal(t, http.StatusNotFound, response.Code)
+		assert.Equal(t, fmt.Sprintf("%s\n", service.ErrHallNotFound), response.Body.String())
 	})
 
 	t.Run("failed to read request body", func(t *testing.T) {
@@ -406,6 +418,23 @@ func TestDeleteSessionHandler(t *testing.T) {
 		assert.Equal(t, http.StatusNotFound, response.Code)
 	})
 
+	t.Run("session has sold tickets", func(t *testing.T) {
+		sessionID := 4
+		s.sessionId = sessionID
+		s.err = service.ErrSessionHasTickets
+
+		req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("/cinema-sessions/%d", sessionID), nil)
+		req = mux.SetURLVars(req, map[string]string{"sessionId": strconv.Itoa(sessionID)})
+		require.NoError(t, err, "failed to create test request")
+
+		response := httptest.NewRecorder()
+		handler := HttpHandler{s: &s}.deleteSessionHandler
+		handler(response, req)
+
+		assert.Equal(t, fmt.Sprintf("%v\n", service.ErrSessionHasTickets), response.Body.String())
+		assert.Equal(t, http.StatusConflict, response.Code)
+	})
+
 	t.Run("repository error", func(t *testing.T) {
 		sessionID := 3
 		s.sessionId = sessionID
@@ -423,3 +452,50 @@ func TestDeleteSessionHandler(t *testing.T) {
 		assert.Equal(t, http.StatusInternalServerError, response.Code)
 	})
 }
+
+func TestHoldSeatsHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		sessionId string
+		body      string
+		err       error
+		code      int
+	}{
+		{name: "seats held", sessionId: "1", body: `{"seats": [3, 4]}`, code: http.StatusCreated},
+		{name: "invalid session id", sessionId: "abc", body: `{"seats": [3]}`, code: http.StatusBadRequest},
+		{name: "invalid body", sessionId: "1", body: `{"seats": "3"}`, code: http.StatusBadRequest},
+		{name: "invalid seats", sessionId: "1", body: `{"seats": []}`, err: service.ErrInvalidSeats,
+			code: http.StatusBadRequest},
+		{name: "session not found", sessionId: "1", body: `{"seats": [3]}`, err: service.ErrCinemaSessionsNotFound,
+			code: http.StatusNotFound},
+		{name: "seats unavailable", sessionId: "1", body: `{"seats": [3]}`, err: service.ErrSeatsUnavailable,
+			code: http.StatusConflict},
+		{name: "too many seats", sessionId: "1", body: `{"seats": [3]}`, err: service.ErrTooManySeats,
+			code: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/cinema-sessions/"+tt.sessionId+"/holds",
+				strings.NewReader(tt.body))
+			req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+			req = mux.SetURLVars(req, map[string]string{"sessionId": tt.sessionId})
+
+			response := httptest.NewRecorder()
+			HttpHandler{s: &mockService{err: tt.err}}.holdSeatsHandler(response, req)
+
+			assert.Equal(t, tt.code, response.Code)
+		})
+	}
+
+	t.Run("response body", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/cinema-sessions/1/holds", strings.NewReader(`{"seats": [3]}`))
+		req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+		req = mux.SetURLVars(req, map[string]string{"sessionId": "1"})
+
+		response := httptest.NewRecorder()
+		HttpHandler{s: &mockService{}}.holdSeatsHandler(response, req)
+
+		assert.JSONEq(t, `{"sessionId":1,"seats":[3],"expiresAt":"2024-05-18T20:10:00Z"}`, response.Body.String())
+	})
+}
@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/cinemasession/service"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"log"
+	"time"
+)
+
+// HoldSeats holds the seats for the user unless that leaves the user with
+// more than maxSeats seats held in the session. It returns the earliest expiry
+// of the held seats, seats the user already held keep theirs.
+func (s *SessionsRepository) HoldSeats(sessionId, userId int, seats []int, expiresAt time.Time,
+	maxSeats int) (time.Time, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Println(err)
+		}
+	}()
+
+	var capacity int
+	err = tx.QueryRow(`SELECT h.capacity
+						FROM cinema_sessions s
+						JOIN halls h ON h.hall_id = s.hall_id
+						WHERE s.session_id = $1 AND s.cancelled_at IS NULL`, sessionId).Scan(&capacity)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, service.ErrCinemaSessionsNotFound
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get hall capacity: %w", err)
+	}
+
+	for _, seat := range seats {
+		if seat > capacity {
+			return time.Time{}, service.ErrInvalidSeats
+		}
+	}
+
+	// Holds of the same user and session are serialized, so concurrent
+	// requests cannot together exceed maxSeats.
+	if _, err = tx.Exec("SELECT pg_advisory_xact_lock($1, $2)", sessionId, userId); err != nil {
+		return time.Time{}, fmt.Errorf("failed to lock seat holds: %w", err)
+	}
+
+	var others int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM seat_holds
+						WHERE session_id = $1 AND user_id = $2 AND expires_at > now()
+							AND seat_number <> ALL($3)`, sessionId, userId, pq.Array(seats)).Scan(&others)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to count held seats: %w", err)
+	}
+	if others+len(seats) > maxSeats {
+		return time.Time{}, service.ErrTooManySeats
+	}
+
+	var sold int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM tickets
+						WHERE session_id = $1 AND seat_number = ANY($2) AND status <> 'cancelled'`,
+		sessionId, pq.Array(seats)).Scan(&sold)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to check sold seats: %w", err)
+	}
+	if sold > 0 {
+		return time.Time{}, service.ErrSeatsUnavailable
+	}
+
+	// Seats still held by the same user keep their expiry, so a hold cannot
+	// be extended by holding the seats again. Expired holds are taken over.
+	// Seats still held by someone else are skipped and make the whole hold
+	// fail.
+	rows, err := tx.Query(`INSERT INTO seat_holds (session_id, seat_number, user_id, expires_at)
+						SELECT $1, seat, $2, $3 FROM unnest($4::int[]) AS seat
+						ON CONFLICT (session_id, seat_number) DO UPDATE
+							SET user_id = EXCLUDED.user_id,
+								expires_at = CASE WHEN seat_holds.expires_at > now()
+									THEN seat_holds.expires_at ELSE EXCLUDED.expires_at END
+							WHERE seat_holds.user_id = EXCLUDED.user_id OR seat_holds.expires_at <= now()
+						RETURNING expires_at`, sessionId, userId, expiresAt, pq.Array(seats))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to hold seats: %w", err)
+	}
+	defer rows.Close()
+
+	held := 0
+	heldUntil := expiresAt
+	for rows.Next() {
+		var seatExpiresAt time.Time
+		if err = rows.Scan(&seatExpiresAt); err != nil {
+			return time.Time{}, fmt.Errorf("failed to hold seats: %w", err)
+		}
+		if seatExpiresAt.Before(heldUntil) {
+			heldUntil = seatExpiresAt
+		}
+		held++
+	}
+	if err = rows.Err(); err != nil {
+		return time.Time{}, fmt.Errorf("failed to hold seats: %w", err)
+	}
+	if held != len(seats) {
+		return time.Time{}, service.ErrSeatsUnavailable
+	}
+
+	if err = tx.Commit(); err != nil {
+		return time.Time{}, fmt.Errorf("failed to hold seats: %w", err)
+	}
+
+	return heldUntil, nil
+}
+
+func (s *SessionsRepository) ReleaseHolds(sessionId, userId int) (int, error) {
+	res, err := s.db.Exec("DELETE FROM seat_holds WHERE session_id = $1 AND user_id = $2", sessionId, userId)
+	if err != nil {
+		return 0, fmt.Errorf("failed to release seat holds: %w", err)
+	}
+
+	released, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to release seat holds: %w", err)
+	}
+
+	return int(released), nil
+}
+
+func (s *SessionsRepository) ReleaseExpiredHolds() (int, error) {
+	res, err := s.db.Exec("DELETE FROM seat_holds WHERE expires_at <= now()")
+	if err != nil {
+		return 0, fmt.Errorf("failed to release expired seat holds: %w", err)
+	}
+
+	released, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to release expired seat holds: %w", err)
+	}
+
+	return int(released), nil
+}
@@ -4,6 +4,7 @@ import (
 	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/cinemasession/entity"
 	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/cinemasession/service"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"strconv"
@@ -31,7 +32,7 @@ type CinemaSession struct {
 func (s *SessionsRepository) SessionsForHall(hallId int, date string) ([]entity.CinemaSession, error) {
 	rows, err := s.db.Query(`SELECT session_id, movie_id, hall_id, start_time, end_time, price
 		FROM cinema_sessions
-		WHERE hall_id = $1 AND date_trunc('day', start_time) = $2
+		WHERE hall_id = $1 AND date_trunc('day', start_time) = $2 AND cancelled_at IS NULL
 		ORDER BY start_time`, hallId, date)
 	if err != nil {
 		log.Println(err)
@@ -57,7 +58,7 @@ func (s *SessionsRepository) SessionsForHall(hallId int, date string) ([]entity.
 func (s *SessionsRepository) AllSessions(date string, offset, limit int) ([]entity.CinemaSession, error) {
 	rows, err := s.db.Query(`SELECT session_id, movie_id, hall_id, start_time, end_time, price
 		FROM cinema_sessions
-		WHERE start_time >= $1
+		WHERE start_time >= $1 AND cancelled_at IS NULL
 		ORDER BY hall_id, start_time
 		OFFSET $2
 		LIMIT $3`, date, offset, limit)
@@ -98,7 +99,7 @@ func (s *SessionsRepository) CreateSession(movieId, hallId int, startTime, endTi
 func (s *SessionsRepository) HallIsBusy(sessionId, hallId int, startTime, endTime string) (bool, error) {
 	row := s.db.QueryRow(`SELECT session_id
 		FROM cinema_sessions
-		WHERE hall_id = $1 AND session_id != $2 AND (start_time BETWEEN $3 AND $4
+		WHERE hall_id = $1 AND session_id != $2 AND cancelled_at IS NULL AND (start_time BETWEEN $3 AND $4
 		OR (start_time <= $3 AND end_time > $3))`, hallId, sessionId, startTime, endTime)
 
 	var sessionExistId int
@@ -136,15 +137,71 @@ func (s *SessionsRepository) SessionEndTime(id int, startTime string) (string, e
 	return endTime, nil
 }
 
-func (s *SessionsRepository) DeleteSession(id int) (bool, error) {
-	res, err := s.db.Exec("DELETE FROM cinema_sessions WHERE session_id = $1", id)
+// DeleteSession removes a session nobody bought tickets for. Sessions with
+// sold tickets are cancelled instead: the tickets are cancelled and a pending
+// refund is created for each of them.
+func (s *SessionsRepository) DeleteSession(id int, refund bool) (bool, error) {
+	tx, err := s.db.Begin()
 	if err != nil {
-		return false, fmt.Errorf("failed to delete cinema session: %w", err)
+		return false, fmt.Errorf("could not begin transaction: %w", err)
 	}
-	rowsAffected, err := res.RowsAffected()
-	if rowsAffected == 0 {
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Println(err)
+		}
+	}()
+
+	var price float32
+	err = tx.QueryRow("SELECT price FROM cinema_sessions WHERE session_id = $1 AND cancelled_at IS NULL FOR UPDATE",
+		id).Scan(&price)
+	if errors.Is(err, sql.ErrNoRows) {
 		return false, nil
 	}
+	if err != nil {
+		return false, fmt.Errorf("failed to delete cinema session: %w", err)
+	}
+
+	var sold int
+	if err = tx.QueryRow("SELECT COUNT(*) FROM tickets WHERE session_id = $1", id).Scan(&sold); err != nil {
+		return false, fmt.Errorf("failed to count session tickets: %w", err)
+	}
+
+	if sold > 0 && !refund {
+		return true, service.ErrSessionHasTickets
+	}
+
+	if sold == 0 {
+		if _, err = tx.Exec("DELETE FROM cinema_sessions WHERE session_id = $1", id); err != nil {
+			return false, fmt.Errorf("failed to delete cinema session: %w", err)
+		}
+	} else {
+		if _, err = tx.Exec("UPDATE cinema_sessions SET cancelled_at = now() WHERE session_id = $1", id); err != nil {
+			return false, fmt.Errorf("failed to cancel cinema session: %w", err)
+		}
+
+		_, err = tx.Exec(`INSERT INTO refunds (ticket_id, user_id, amount, reason)
+						SELECT ticket_id, user_id, COALESCE(price, $2), 'session cancelled'
+						FROM tickets
+						WHERE session_id = $1 AND status = 'active'`, id, price)
+		if err != nil {
+			return false, fmt.Errorf("failed to create refunds: %w", err)
+		}
+
+		_, err = tx.Exec(`UPDATE tickets SET status = 'cancelled', cancelled_at = now()
+						WHERE session_id = $1 AND status = 'active'`, id)
+		if err != nil {
+			return false, fmt.Errorf("failed to cancel tickets: %w", err)
+		}
+
+		if _, err = tx.Exec("DELETE FROM seat_holds WHERE session_id = $1", id); err != nil {
+			return false, fmt.Errorf("failed to release seat holds: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to delete cinema session: %w", err)
+	}
+
 	return true, nil
 }
 
@@ -170,7 +227,12 @@ func (s *SessionsRepository) AvailableSeats(sessionId int) ([]int, error) {
 				EXCEPT (
 					SELECT seat_number
 					FROM tickets
-					WHERE session_id = $1
+					WHERE session_id = $1 AND status <> 'cancelled'
+				)
+				EXCEPT (
+					SELECT seat_number
+					FROM seat_holds
+					WHERE session_id = $1 AND expires_at > now()
 				)`, sessionId)
 	if err != nil {
 		log.Println(err)
@@ -209,7 +271,7 @@ func (s *SessionsRepository) AvailableSeats(sessionId int) ([]int, error) {
 
 func (s *SessionsRepository) SessionExists(id int) (bool, error) {
 	var count int
-	err := s.db.QueryRow("SELECT COUNT(*) FROM cinema_sessions WHERE session_id = $1", id).Scan(&count)
+	err := s.db.QueryRow("SELECT COUNT(*) FROM cinema_sessions WHERE session_id = $1 AND cancelled_at IS NULL", id).Scan(&count)
 	if err != nil {
 		log.Println(err)
 		return false, fmt.Errorf("failed to check if session exists %w", err)
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/cinemasession/entity"
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"time"
+)
+
+var (
+	ErrInvalidSeats     = errors.New("seat numbers must be unique and within the hall's range")
+	ErrSeatsUnavailable = errors.New("some of the seats are already sold or held")
+	ErrTooManySeats     = errors.New("at most 10 seats of a session can be held at once")
+)
+
+const (
+	DefaultHoldTTL = 10 * time.Minute
+	// maxHeldSeats caps the seats a user holds in a session, it matches the
+	// largest order.
+	maxHeldSeats = 10
+)
+
+// WithHoldTTL sets for how long seats stay held for a customer before they
+// are released again.
+func (s Service) WithHoldTTL(ttl time.Duration) Service {
+	s.holdTTL = ttl
+	return s
+}
+
+// HoldSeats reserves the seats for the user until they are bought or the hold
+// expires. Either all seats are held or none. Seats the user already holds
+// keep their original expiry, so the returned hold expires with the earliest
+// of them.
+func (s Service) HoldSeats(sessionId, userId int, seats []int) (entity.SeatHold, error) {
+	if len(seats) == 0 {
+		return entity.SeatHold{}, ErrInvalidSeats
+	}
+	if len(seats) > maxHeldSeats {
+		return entity.SeatHold{}, ErrTooManySeats
+	}
+
+	sorted := append([]int(nil), seats...)
+	sort.Ints(sorted)
+	for i, seat := range sorted {
+		if seat <= 0 || i > 0 && sorted[i-1] == seat {
+			return entity.SeatHold{}, ErrInvalidSeats
+		}
+	}
+
+	expiresAt, err := s.r.HoldSeats(sessionId, userId, sorted, time.Now().Add(s.holdTTL), maxHeldSeats)
+	if errors.Is(err, ErrCinemaSessionsNotFound) || errors.Is(err, ErrInvalidSeats) ||
+		errors.Is(err, ErrSeatsUnavailable) || errors.Is(err, ErrTooManySeats) {
+		return entity.SeatHold{}, err
+	}
+	if err != nil {
+		log.Println(err)
+		return entity.SeatHold{}, ErrInternalError
+	}
+
+	return entity.SeatHold{SessionId: sessionId, Seats: sorted, ExpiresAt: expiresAt}, nil
+}
+
+func (s Service) ReleaseHolds(sessionId, userId int) error {
+	if _, err := s.r.ReleaseHolds(sessionId, userId); err != nil {
+		log.Println(err)
+		return ErrInternalError
+	}
+	return nil
+}
+
+// RunHoldReaper deletes expired holds every interval until ctx is done.
+func (s Service) RunHoldReaper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			released, err := s.r.ReleaseExpiredHolds()
+			if err != nil {
+				log.Println("failed to release expired seat holds:", err)
+				continue
+			}
+			if released > 0 {
+				log.Printf("released %d expired seat holds", released)
+			}
+		}
+	}
+}
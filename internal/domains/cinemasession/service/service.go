@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"sort"
+	"time"
 )
 
 var (
@@ -15,15 +16,20 @@ var (
 	ErrHallNotFound           = errors.New("hall was not found")
 	ErrMovieNotFound          = errors.New("movie was not found")
 	ErrNoAvailableSeats       = errors.New("no available seats found for the cinema session")
+	ErrSessionHasTickets      = errors.New("cinema session has sold tickets")
 )
 
-const AdminRole = "admin"
+const WritePermission = "sessions:write"
+
+// RefundPermission is required to delete a session with sold tickets, which
+// cancels and refunds them.
+const RefundPermission = "tickets:refund"
 
 type repository interface {
 	SessionsForHall(hallId int, date string) ([]entity.CinemaSession, error)
 	AllSessions(date string, offset, limit int) ([]entity.CinemaSession, error)
 	CreateSession(movieId, hallId int, startTime, endTime string, price float32) (int, error)
-	DeleteSession(id int) (found bool, err error)
+	DeleteSession(id int, refund bool) (found bool, err error)
 	SessionExists(id int) (bool, error)
 	HallExists(id int) (bool, error)
 	MovieExists(id int) (bool, error)
@@ -31,14 +37,18 @@ type repository interface {
 	HallIsBusy(sessionId, hallId int, startTime, endTime string) (bool, error)
 	UpdateSession(id, movieId, hallId int, startTime, endTime string, price float32) error
 	AvailableSeats(sessionId int) ([]int, error)
+	HoldSeats(sessionId, userId int, seats []int, expiresAt time.Time, maxSeats int) (time.Time, error)
+	ReleaseHolds(sessionId, userId int) (int, error)
+	ReleaseExpiredHolds() (int, error)
 }
 
 type Service struct {
-	r repository
+	r       repository
+	holdTTL time.Duration
 }
 
 func New(r repository) Service {
-	return Service{r: r}
+	return Service{r: r, holdTTL: DefaultHoldTTL}
 }
 
 func (s Service) AllSessions(date string, offset, limit int) ([]entity.CinemaSession, error) {
@@ -107,9 +117,16 @@ func (s Service) CreateSession(movieId, hallId int, startTime string, price floa
 	return id, nil
 }
 
-func (s Service) DeleteSession(id int) error {
-	found, err := s.r.DeleteSession(id)
+// DeleteSession deletes a session without sold tickets. A session with sold
+// tickets is cancelled instead and its tickets are refunded, but only if
+// refund is set, otherwise ErrSessionHasTickets is returned.
+func (s Service) DeleteSession(id int, refund bool) error {
+	found, err := s.r.DeleteSession(id, refund)
+	if errors.Is(err, ErrSessionHasTickets) {
+		return err
+	}
 	if err != nil {
+		log.Println(err)
 		return ErrInternalError
 	}
 	if !found {
@@ -2,9 +2,12 @@ package service
 
 import (
 	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/cinemasession/entity"
+	"context"
 	"errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"testing"
+	"time"
 )
 
 type mockRepo struct {
@@ -16,6 +19,32 @@ type mockRepo struct {
 	seats         []int
 	id            int
 	err           error
+	heldSeats     []int
+	holdExpiry    time.Time
+	reaped        chan struct{}
+}
+
+func (m *mockRepo) HoldSeats(sessionId, userId int, seats []int, expiresAt time.Time, maxSeats int) (time.Time, error) {
+	if len(m.heldSeats)+len(seats) > maxSeats {
+		return time.Time{}, ErrTooManySeats
+	}
+	m.heldSeats = seats
+	if m.holdExpiry.IsZero() {
+		m.holdExpiry = expiresAt
+	}
+	return m.holdExpiry, m.err
+}
+
+func (m *mockRepo) ReleaseHolds(sessionId, userId int) (int, error) {
+	return len(m.heldSeats), m.err
+}
+
+func (m *mockRepo) ReleaseExpiredHolds() (int, error) {
+	select {
+	case m.reaped <- struct{}{}:
+	default:
+	}
+	return 1, m.err
 }
 
 func (m *mockRepo) AvailableSeats(sessionId int) ([]int, error) {
@@ -38,7 +67,7 @@ func (m *mockRepo) CreateSession(movieId, hallId int, startTime, endTime string,
 	return m.id, m.err
 }
 
-func (m *mockRepo) DeleteSession(id int) (bool, error) {
+func (m *mockRepo) DeleteSession(id int, refund bool) (bool, error) {
 	return m.sessionExists, m.err
 }
 
@@ -198,7 +227,7 @@ func TestDeleteSession(t *testing.T) {
 		repo.sessionExists = true
 
 		s := New(&repo)
-		err := s.DeleteSession(1)
+		err := s.DeleteSession(1, true)
 		assert.NoError(t, err)
 	})
 
@@ -206,16 +235,25 @@ func TestDeleteSession(t *testing.T) {
 		repo.sessionExists = false
 
 		s := New(&repo)
-		err := s.DeleteSession(1)
+		err := s.DeleteSession(1, true)
 		assert.ErrorIs(t, err, ErrCinemaSessionsNotFound)
 	})
 
+	t.Run("session has sold tickets", func(t *testing.T) {
+		repo.sessionExists = true
+		repo.err = ErrSessionHasTickets
+
+		s := New(&repo)
+		err := s.DeleteSession(1, false)
+		assert.ErrorIs(t, err, ErrSessionHasTickets)
+	})
+
 	t.Run("repository error", func(t *testing.T) {
 		repo.sessionExists = true
 		repo.err = errors.New("something went wrong")
 
 		s := New(&repo)
-		err := s.DeleteSession(1)
+		err := s.DeleteSession(1, true)
 		assert.ErrorIs(t, err, ErrInternalError)
 	})
 }
@@ -329,3 +367,68 @@ func TestAvailableSeats(t *testing.T) {
 		assert.Zero(t, len(seats))
 	})
 }
+
+func TestHoldSeats(t *testing.T) {
+	repo := mockRepo{}
+	s := New(&repo).WithHoldTTL(5 * time.Minute)
+
+	t.Run("successful hold", func(t *testing.T) {
+		hold, err := s.HoldSeats(1, 2, []int{4, 3})
+		require.NoError(t, err)
+		assert.Equal(t, []int{3, 4}, hold.Seats)
+		assert.Equal(t, []int{3, 4}, repo.heldSeats)
+		assert.WithinDuration(t, time.Now().Add(5*time.Minute), hold.ExpiresAt, time.Second)
+		assert.Equal(t, hold.ExpiresAt, repo.holdExpiry)
+	})
+
+	t.Run("existing hold keeps its expiry", func(t *testing.T) {
+		expiresAt := repo.holdExpiry
+		repo.heldSeats = nil
+		hold, err := s.HoldSeats(1, 2, []int{3, 4})
+		require.NoError(t, err)
+		assert.Equal(t, expiresAt, hold.ExpiresAt)
+	})
+
+	t.Run("too many seats", func(t *testing.T) {
+		_, err := s.HoldSeats(1, 2, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11})
+		assert.ErrorIs(t, err, ErrTooManySeats)
+
+		repo.heldSeats = []int{1, 2, 3, 4, 5, 6, 7, 8, 9}
+		_, err = s.HoldSeats(1, 2, []int{10, 11})
+		assert.ErrorIs(t, err, ErrTooManySeats)
+		repo.heldSeats = nil
+	})
+
+	t.Run("invalid seats", func(t *testing.T) {
+		for _, seats := range [][]int{nil, {1, 1}, {0}, {-2, 3}} {
+			_, err := s.HoldSeats(1, 2, seats)
+			assert.ErrorIs(t, err, ErrInvalidSeats)
+		}
+	})
+
+	t.Run("seats unavailable", func(t *testing.T) {
+		repo.err = ErrSeatsUnavailable
+		_, err := s.HoldSeats(1, 2, []int{1})
+		assert.ErrorIs(t, err, ErrSeatsUnavailable)
+	})
+
+	t.Run("repository error", func(t *testing.T) {
+		repo.err = errors.New("something went wrong")
+		_, err := s.HoldSeats(1, 2, []int{1})
+		assert.ErrorIs(t, err, ErrInternalError)
+	})
+}
+
+func TestRunHoldReaper(t *testing.T) {
+	repo := mockRepo{reaped: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go New(&repo).RunHoldReaper(ctx, 10*time.Millisecond)
+
+	select {
+	case <-repo.reaped:
+	case <-time.After(time.Second):
+		t.Fatal("expired holds were not released")
+	}
+}
@@ -15,16 +15,17 @@ var (
 )
 
 type cinemaHall struct {
-	ID       int    `json:"id"`
-	Name     string `json:"name"`
-	Capacity int    `json:"capacity"`
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Capacity    int    `json:"capacity"`
+	SeatsPerRow int    `json:"seatsPerRow,omitempty"`
 }
 
 type Service interface {
 	Halls() ([]service.Hall, error)
 	HallById(id int) (service.Hall, error)
-	CreateHall(name string, capacity int) (hallId int, err error)
-	UpdateHall(id int, name string, capacity int) (err error)
+	CreateHall(name string, capacity, seatsPerRow int) (hallId int, err error)
+	UpdateHall(id int, name string, capacity, seatsPerRow int) (err error)
 	DeleteHall(id int) error
 }
 
@@ -52,7 +53,7 @@ func (h HttpHandler) SetRoutes(router *mux.Router, a AccessChecker) {
 
 	adminRouter := router.PathPrefix("/halls").Subrouter()
 	adminRouter.Use(a.Authenticate)
-	adminRouter.Use(a.CheckPerms(service.AdminRole))
+	adminRouter.Use(a.CheckPerms(service.WritePermission))
 
 	adminRouter.HandleFunc("/", h.createHallHandler).Methods(http.MethodPost)
 	adminRouter.HandleFunc("/{hallId}", h.updateHallHandler).Methods(http.MethodPut)
@@ -71,8 +72,9 @@ func (h HttpHandler) getHallsHandler(w http.ResponseWriter, _ *http.Request) {
 
 func (h HttpHandler) createHallHandler(w http.ResponseWriter, r *http.Request) {
 	type hallInfo struct {
-		Name     string `json:"name"`
-		Capacity int    `json:"capacity"`
+		Name        string `json:"name"`
+		Capacity    int    `json:"capacity"`
+		SeatsPerRow int    `json:"seatsPerRow"`
 	}
 
 	var hall hallInfo
@@ -83,7 +85,12 @@ func (h HttpHandler) createHallHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id, err := h.s.CreateHall(hall.Name, hall.Capacity)
+	id, err := h.s.CreateHall(hall.Name, hall.Capacity, hall.SeatsPerRow)
+	if errors.Is(err, service.ErrInvalidRows) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -121,8 +128,9 @@ func (h HttpHandler) updateHallHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	type hallInfo struct {
-		Name     string `json:"name"`
-		Capacity int    `json:"capacity"`
+		Name        string `json:"name"`
+		Capacity    int    `json:"capacity"`
+		SeatsPerRow int    `json:"seatsPerRow"`
 	}
 
 	var hall hallInfo
@@ -133,7 +141,12 @@ func (h HttpHandler) updateHallHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.s.UpdateHall(hallID, hall.Name, hall.Capacity)
+	err = h.s.UpdateHall(hallID, hall.Name, hall.Capacity, hall.SeatsPerRow)
+	if errors.Is(err, service.ErrInvalidRows) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	if errors.Is(err, service.ErrHallNotFound) {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
@@ -160,6 +173,11 @@ func (h HttpHandler) deleteHallHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if errors.Is(err, service.ErrHallHasTickets) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -178,8 +196,9 @@ func entitiesToDTO(halls []service.Hall) []cinemaHall {
 
 func entityToDTO(hall service.Hall) cinemaHall {
 	return cinemaHall{
-		ID:       hall.Id,
-		Name:     hall.Name,
-		Capacity: hall.Capacity,
+		ID:          hall.Id,
+		Name:        hall.Name,
+		Capacity:    hall.Capacity,
+		SeatsPerRow: hall.SeatsPerRow,
 	}
 }
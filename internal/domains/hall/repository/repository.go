@@ -9,9 +9,10 @@ import (
 )
 
 type hall struct {
-	Id       int
-	Name     string
-	Capacity int
+	Id          int
+	Name        string
+	Capacity    int
+	SeatsPerRow int
 }
 
 type HallRepository struct {
@@ -23,7 +24,7 @@ func New(db *sql.DB) *HallRepository {
 }
 
 func (h *HallRepository) Halls() ([]service.Hall, error) {
-	rows, err := h.db.Query(`SELECT hall_id, hall_name, capacity FROM halls`)
+	rows, err := h.db.Query(`SELECT hall_id, hall_name, capacity, seats_per_row FROM halls`)
 	if err != nil {
 		log.Println(err)
 		return nil, err
@@ -38,22 +39,22 @@ func (h *HallRepository) Halls() ([]service.Hall, error) {
 	var cinemaHalls []service.Hall
 	for rows.Next() {
 		var hall hall
-		if err = rows.Scan(&hall.Id, &hall.Name, &hall.Capacity); err != nil {
+		if err = rows.Scan(&hall.Id, &hall.Name, &hall.Capacity, &hall.SeatsPerRow); err != nil {
 			log.Println(err)
 			return nil, fmt.Errorf("failed to get hall: %w", err)
 		}
-		cinemaHalls = append(cinemaHalls, service.NewHallEntity(hall.Id, hall.Name, hall.Capacity))
+		cinemaHalls = append(cinemaHalls, service.NewHallEntity(hall.Id, hall.Name, hall.Capacity, hall.SeatsPerRow))
 	}
 
 	return cinemaHalls, nil
 }
 
 func (h *HallRepository) HallById(id int) (service.Hall, error) {
-	row := h.db.QueryRow(`SELECT hall_id, hall_name, capacity 
+	row := h.db.QueryRow(`SELECT hall_id, hall_name, capacity, seats_per_row
 						FROM halls 
 						WHERE hall_id = $1`, id)
 	var hall hall
-	err := row.Scan(&hall.Id, &hall.Name, &hall.Capacity)
+	err := row.Scan(&hall.Id, &hall.Name, &hall.Capacity, &hall.SeatsPerRow)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			log.Println(err)
@@ -63,14 +64,14 @@ func (h *HallRepository) HallById(id int) (service.Hall, error) {
 		return service.Hall{}, fmt.Errorf("could not get hall by id: %w", err)
 	}
 
-	return service.NewHallEntity(hall.Id, hall.Name, hall.Capacity), nil
+	return service.NewHallEntity(hall.Id, hall.Name, hall.Capacity, hall.SeatsPerRow), nil
 }
 
-func (h *HallRepository) CreateHall(name string, capacity int) (hallId int, err error) {
+func (h *HallRepository) CreateHall(name string, capacity, seatsPerRow int) (hallId int, err error) {
 	var id int
-	err = h.db.QueryRow(`INSERT INTO halls (hall_name, capacity)
-						VALUES ($1, $2)
-						RETURNING hall_id`, name, capacity).Scan(&id)
+	err = h.db.QueryRow(`INSERT INTO halls (hall_name, capacity, seats_per_row)
+						VALUES ($1, $2, $3)
+						RETURNING hall_id`, name, capacity, seatsPerRow).Scan(&id)
 	if err != nil {
 		log.Println(err)
 		return 0, err
@@ -79,10 +80,10 @@ func (h *HallRepository) CreateHall(name string, capacity int) (hallId int, err
 	return id, nil
 }
 
-func (h *HallRepository) UpdateHall(id int, name string, capacity int) (bool, error) {
+func (h *HallRepository) UpdateHall(id int, name string, capacity, seatsPerRow int) (bool, error) {
 	res, err := h.db.Exec(`UPDATE halls
-						SET hall_name = $1, capacity = $2
-						WHERE hall_id = $3`, name, capacity, id)
+						SET hall_name = $1, capacity = $2, seats_per_row = $3
+						WHERE hall_id = $4`, name, capacity, seatsPerRow, id)
 	if err != nil {
 		log.Println(err)
 		return false, fmt.Errorf("failed to update hall: %w", err)
@@ -96,16 +97,50 @@ func (h *HallRepository) UpdateHall(id int, name string, capacity int) (bool, er
 	return true, nil
 }
 
+// DeleteHall refuses to delete a hall whose sessions have sold tickets, which
+// would otherwise be removed by the cascade without a refund. The sessions are
+// locked so no ticket can be sold for them while the hall is deleted.
 func (h *HallRepository) DeleteHall(id int) (bool, error) {
-	res, err := h.db.Exec(`DELETE FROM halls WHERE hall_id = $1`, id)
+	tx, err := h.db.Begin()
 	if err != nil {
-		log.Println(err)
-		return false, fmt.Errorf("failed to delete hall: %w", err)
+		return false, fmt.Errorf("could not begin transaction: %w", err)
 	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Println(err)
+		}
+	}()
 
-	rowsAffected, err := res.RowsAffected()
-	if rowsAffected == 0 {
+	err = tx.QueryRow(`SELECT hall_id FROM halls WHERE hall_id = $1 FOR UPDATE`, id).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
 		return false, nil
 	}
+	if err != nil {
+		return false, fmt.Errorf("failed to delete hall: %w", err)
+	}
+
+	if _, err = tx.Exec(`SELECT 1 FROM cinema_sessions WHERE hall_id = $1 FOR UPDATE`, id); err != nil {
+		return false, fmt.Errorf("failed to delete hall: %w", err)
+	}
+
+	var sold bool
+	err = tx.QueryRow(`SELECT EXISTS (
+							SELECT 1 FROM tickets t
+							JOIN cinema_sessions s ON s.session_id = t.session_id
+							WHERE s.hall_id = $1 AND t.status <> 'cancelled')`, id).Scan(&sold)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete hall: %w", err)
+	}
+	if sold {
+		return false, service.ErrHallHasTickets
+	}
+
+	if _, err = tx.Exec(`DELETE FROM halls WHERE hall_id = $1`, id); err != nil {
+		return false, fmt.Errorf("failed to delete hall: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to delete hall: %w", err)
+	}
 	return true, nil
 }
@@ -5,29 +5,37 @@ import "errors"
 var (
 	ErrHallNotFound  = errors.New("hall not found")
 	ErrInternalError = errors.New("internal server error")
+	ErrInvalidRows   = errors.New("seats per row must not be negative")
+	// ErrHallHasTickets is returned when deleting a hall would delete sold
+	// tickets. Their sessions must be deleted first, which refunds them.
+	ErrHallHasTickets = errors.New("hall has sessions with sold tickets")
 )
 
-const AdminRole = "admin"
+const WritePermission = "halls:write"
 
+// Hall is a cinema hall. Seats are numbered row by row, SeatsPerRow is 0 when
+// the layout of the hall is unknown.
 type Hall struct {
-	Id       int
-	Name     string
-	Capacity int
+	Id          int
+	Name        string
+	Capacity    int
+	SeatsPerRow int
 }
 
-func NewHallEntity(id int, name string, capacity int) Hall {
+func NewHallEntity(id int, name string, capacity, seatsPerRow int) Hall {
 	return Hall{
-		Id:       id,
-		Name:     name,
-		Capacity: capacity,
+		Id:          id,
+		Name:        name,
+		Capacity:    capacity,
+		SeatsPerRow: seatsPerRow,
 	}
 }
 
 type repository interface {
 	Halls() ([]Hall, error)
 	HallById(id int) (Hall, error)
-	CreateHall(name string, capacity int) (hallId int, err error)
-	UpdateHall(id int, name string, capacity int) (found bool, err error)
+	CreateHall(name string, capacity, seatsPerRow int) (hallId int, err error)
+	UpdateHall(id int, name string, capacity, seatsPerRow int) (found bool, err error)
 	DeleteHall(id int) (bool, error)
 }
 
@@ -58,16 +66,24 @@ func (s Service) HallById(id int) (Hall, error) {
 	return hall, nil
 }
 
-func (s Service) CreateHall(name string, capacity int) (hallId int, err error) {
-	id, err := s.r.CreateHall(name, capacity)
+func (s Service) CreateHall(name string, capacity, seatsPerRow int) (hallId int, err error) {
+	if seatsPerRow < 0 {
+		return 0, ErrInvalidRows
+	}
+
+	id, err := s.r.CreateHall(name, capacity, seatsPerRow)
 	if err != nil {
 		return 0, ErrInternalError
 	}
 	return id, nil
 }
 
-func (s Service) UpdateHall(id int, name string, capacity int) error {
-	found, err := s.r.UpdateHall(id, name, capacity)
+func (s Service) UpdateHall(id int, name string, capacity, seatsPerRow int) error {
+	if seatsPerRow < 0 {
+		return ErrInvalidRows
+	}
+
+	found, err := s.r.UpdateHall(id, name, capacity, seatsPerRow)
 	if err != nil {
 		return ErrInternalError
 	}
@@ -79,6 +95,9 @@ func (s Service) UpdateHall(id int, name string, capacity int) error {
 
 func (s Service) DeleteHall(id int) error {
 	found, err := s.r.DeleteHall(id)
+	if errors.Is(err, ErrHallHasTickets) {
+		return err
+	}
 	if err != nil {
 		return ErrInternalError
 	}
@@ -29,11 +29,11 @@ func (m *mockRepository) HallById(id int) (Hall, error) {
 	}
 }
 
-func (m *mockRepository) CreateHall(name string, capacity int) (int, error) {
+func (m *mockRepository) CreateHall(name string, capacity, seatsPerRow int) (int, error) {
 	return m.id, m.err
 }
 
-func (m *mockRepository) UpdateHall(id int, name string, capacity int) (bool, error) {
+func (m *mockRepository) UpdateHall(id int, name string, capacity, seatsPerRow int) (bool, error) {
 	return m.hallExists, m.err
 }
 
@@ -88,7 +88,7 @@ func TestCreateHall(t *testing.T) {
 	t.Run("successful hall creation", func(t *testing.T) {
 		repo.id = 3
 		s := New(&repo)
-		id, err := s.CreateHall("Hall 3", 200)
+		id, err := s.CreateHall("Hall 3", 200, 20)
 		assert.NoError(t, err)
 		assert.Equal(t, 3, id)
 	})
@@ -96,10 +96,16 @@ func TestCreateHall(t *testing.T) {
 	t.Run("repository error", func(t *testing.T) {
 		repo.err = errors.New("something went wrong")
 		s := New(&repo)
-		id, err := s.CreateHall("Hall 3", 200)
+		id, err := s.CreateHall("Hall 3", 200, 20)
 		assert.ErrorIs(t, err, ErrInternalError)
 		assert.Zero(t, id)
 	})
+
+	t.Run("negative seats per row", func(t *testing.T) {
+		s := New(&mockRepository{})
+		_, err := s.CreateHall("Hall 3", 200, -1)
+		assert.ErrorIs(t, err, ErrInvalidRows)
+	})
 }
 
 func TestUpdateHall(t *testing.T) {
@@ -107,14 +113,14 @@ func TestUpdateHall(t *testing.T) {
 	t.Run("successful hall update", func(t *testing.T) {
 		repo.hallExists = true
 		s := New(&repo)
-		err := s.UpdateHall(1, "Hall 3", 200)
+		err := s.UpdateHall(1, "Hall 3", 200, 20)
 		assert.NoError(t, err)
 	})
 
 	t.Run("hall does not exist", func(t *testing.T) {
 		repo.hallExists = false
 		s := New(&repo)
-		err := s.UpdateHall(1, "Hall 3", 200)
+		err := s.UpdateHall(1, "Hall 3", 200, 20)
 		assert.ErrorIs(t, err, ErrHallNotFound)
 	})
 }
@@ -135,6 +141,14 @@ func TestDeleteHall(t *testing.T) {
 		assert.ErrorIs(t, err, ErrHallNotFound)
 	})
 
+	t.Run("hall has sold tickets", func(t *testing.T) {
+		repo.hallExists = false
+		repo.err = ErrHallHasTickets
+		s := New(&repo)
+		err := s.DeleteHall(1)
+		assert.ErrorIs(t, err, ErrHallHasTickets)
+	})
+
 	t.Run("repository error", func(t *testing.T) {
 		repo.hallExists = true
 		repo.err = errors.New("something went wrong")
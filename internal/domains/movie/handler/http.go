@@ -57,7 +57,7 @@ func (h HttpHandler) SetRoutes(router *mux.Router, a AccessChecker) {
 
 	adminRouter := router.PathPrefix("/movies").Subrouter()
 	adminRouter.Use(a.Authenticate)
-	adminRouter.Use(a.CheckPerms(service.AdminRole))
+	adminRouter.Use(a.CheckPerms(service.WritePermission))
 
 	adminRouter.HandleFunc("/", h.createMovieHandler).Methods(http.MethodPost)
 	adminRouter.HandleFunc("/{movieId}", h.updateMovieHandler).Methods(http.MethodPut)
@@ -169,6 +169,11 @@ func (h HttpHandler) deleteMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if errors.Is(err, service.ErrMovieHasTickets) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -29,7 +29,7 @@ func (m MovieRepository) Movies(date string) ([]service.Movie, error) {
 	rows, err := m.db.Query(`SELECT DISTINCT m.*
 							FROM movies m
 							JOIN cinema_sessions cs ON m.movie_id = cs.movie_id
-							WHERE date_trunc('day', start_time) = $1`, date)
+							WHERE date_trunc('day', start_time) = $1 AND cs.cancelled_at IS NULL`, date)
 	if err != nil {
 		log.Println(err)
 		return nil, err
@@ -98,18 +98,51 @@ func (m MovieRepository) UpdateMovie(id int, title, genre, releaseDate string, d
 	return true, nil
 }
 
+// DeleteMovie refuses to delete a movie whose sessions have sold tickets, which
+// would otherwise be removed by the cascade without a refund. The sessions are
+// locked so no ticket can be sold for them while the movie is deleted.
 func (m MovieRepository) DeleteMovie(id int) (bool, error) {
-	res, err := m.db.Exec(`DELETE FROM movies WHERE movie_id = $1`, id)
+	tx, err := m.db.Begin()
 	if err != nil {
-		log.Println(err)
-		return false, fmt.Errorf("failed to delete movie: %w", err)
+		return false, fmt.Errorf("could not begin transaction: %w", err)
 	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Println(err)
+		}
+	}()
 
-	rowsAffected, err := res.RowsAffected()
-	if rowsAffected == 0 {
+	err = tx.QueryRow(`SELECT movie_id FROM movies WHERE movie_id = $1 FOR UPDATE`, id).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
 		return false, nil
 	}
+	if err != nil {
+		return false, fmt.Errorf("failed to delete movie: %w", err)
+	}
+
+	if _, err = tx.Exec(`SELECT 1 FROM cinema_sessions WHERE movie_id = $1 FOR UPDATE`, id); err != nil {
+		return false, fmt.Errorf("failed to delete movie: %w", err)
+	}
+
+	var sold bool
+	err = tx.QueryRow(`SELECT EXISTS (
+							SELECT 1 FROM tickets t
+							JOIN cinema_sessions s ON s.session_id = t.session_id
+							WHERE s.movie_id = $1 AND t.status <> 'cancelled')`, id).Scan(&sold)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete movie: %w", err)
+	}
+	if sold {
+		return false, service.ErrMovieHasTickets
+	}
+
+	if _, err = tx.Exec(`DELETE FROM movies WHERE movie_id = $1`, id); err != nil {
+		return false, fmt.Errorf("failed to delete movie: %w", err)
+	}
 
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to delete movie: %w", err)
+	}
 	return true, nil
 }
 
@@ -118,7 +151,7 @@ func (m MovieRepository) WatchedMovies(userId int) ([]service.Movie, error) {
 							FROM movies m
 							JOIN cinema_sessions cs ON m.movie_id = cs.movie_id
 							JOIN tickets t ON cs.session_id = t.session_id
-							WHERE t.user_id = $1;
+							WHERE t.user_id = $1 AND t.status <> 'cancelled';
 							`, userId)
 
 	if err != nil {
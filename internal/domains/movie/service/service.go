@@ -9,11 +9,14 @@ var (
 	ErrMoviesNotFound = errors.New("movies not found")
 	ErrInternalError  = errors.New("internal server error")
 	ErrUserNotFound   = errors.New("user not found")
+	// ErrMovieHasTickets is returned when deleting a movie would delete sold
+	// tickets. Their sessions must be deleted first, which refunds them.
+	ErrMovieHasTickets = errors.New("movie has sessions with sold tickets")
 )
 
 const (
-	AdminRole  = "admin"
-	dateLayout = "2006-01-02"
+	WritePermission = "movies:write"
+	dateLayout      = "2006-01-02"
 )
 
 type Movie struct {
@@ -94,6 +97,9 @@ func (s Service) UpdateMovie(id int, title, genre, releaseDate string, duration
 
 func (s Service) DeleteMovie(id int) error {
 	found, err := s.r.DeleteMovie(id)
+	if errors.Is(err, ErrMovieHasTickets) {
+		return err
+	}
 	if err != nil {
 		return ErrInternalError
 	}
@@ -171,6 +171,14 @@ func TestDeleteMovie(t *testing.T) {
 		err := s.DeleteMovie(3)
 		assert.ErrorIs(t, err, ErrMoviesNotFound)
 	})
+
+	t.Run("movie has sold tickets", func(t *testing.T) {
+		repo.movieExists = false
+		repo.err = ErrMovieHasTickets
+		s := New(repo)
+		err := s.DeleteMovie(1)
+		assert.ErrorIs(t, err, ErrMovieHasTickets)
+	})
 }
 
 func TestWatchedMovies(t *testing.T) {
@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/apiutils"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/payment/service"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"time"
+)
+
+var (
+	ErrReadRequestFail        = errors.New("failed to read request body")
+	ErrNoToken                = errors.New("missing payment token")
+	ErrInvalidPaymentMethodId = errors.New("invalid payment method id")
+)
+
+type paymentMethod struct {
+	ID        int       `json:"id"`
+	Brand     string    `json:"brand"`
+	Last4     string    `json:"last4"`
+	ExpMonth  int       `json:"expMonth"`
+	ExpYear   int       `json:"expYear"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type Service interface {
+	PaymentMethods(userId int) ([]service.PaymentMethod, error)
+	AddPaymentMethod(ctx context.Context, userId int, token string) (service.PaymentMethod, error)
+	DeletePaymentMethod(ctx context.Context, userId, id int) error
+}
+
+type AccessChecker interface {
+	Authenticate(next http.Handler) http.Handler
+}
+
+type HttpHandler struct {
+	s Service
+}
+
+func New(s Service) HttpHandler {
+	return HttpHandler{
+		s: s,
+	}
+}
+
+func (h HttpHandler) SetRoutes(router *mux.Router, a AccessChecker) {
+	userRouter := router.PathPrefix("/users/me/payment-methods").Subrouter()
+	userRouter.Use(a.Authenticate)
+
+	userRouter.HandleFunc("/", h.getPaymentMethodsHandler).Methods(http.MethodGet)
+	userRouter.HandleFunc("/", h.addPaymentMethodHandler).Methods(http.MethodPost)
+	userRouter.HandleFunc("/{methodId}", h.deletePaymentMethodHandler).Methods(http.MethodDelete)
+}
+
+func (h HttpHandler) getPaymentMethodsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	methods, err := h.s.PaymentMethods(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]paymentMethod, 0, len(methods))
+	for _, m := range methods {
+		resp = append(resp, methodToDTO(m))
+	}
+
+	apiutils.WriteResponse(w, resp, http.StatusOK)
+}
+
+func (h HttpHandler) addPaymentMethodHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, ErrReadRequestFail.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Token == "" {
+		http.Error(w, ErrNoToken.Error(), http.StatusBadRequest)
+		return
+	}
+
+	m, err := h.s.AddPaymentMethod(r.Context(), userID, req.Token)
+	if errors.Is(err, service.ErrInvalidPaymentToken) || errors.Is(err, service.ErrCardExpired) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if errors.Is(err, service.ErrPaymentMethodExists) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	apiutils.WriteResponse(w, methodToDTO(m), http.StatusCreated)
+}
+
+func (h HttpHandler) deletePaymentMethodHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	methodId, err := apiutils.IntPathParam(r, "methodId")
+	if err != nil {
+		http.Error(w, ErrInvalidPaymentMethodId.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.s.DeletePaymentMethod(r.Context(), userID, methodId)
+	if errors.Is(err, service.ErrPaymentMethodNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func methodToDTO(m service.PaymentMethod) paymentMethod {
+	return paymentMethod{
+		ID:        m.ID,
+		Brand:     m.Brand,
+		Last4:     m.Last4,
+		ExpMonth:  m.ExpMonth,
+		ExpYear:   m.ExpYear,
+		CreatedAt: m.CreatedAt,
+	}
+}
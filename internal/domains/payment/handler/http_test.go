@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/payment/service"
+	"context"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockService struct {
+	err error
+}
+
+func (m mockService) PaymentMethods(userId int) ([]service.PaymentMethod, error) {
+	return []service.PaymentMethod{{ID: 1, UserID: userId, Token: "tok_secret", Brand: "visa", Last4: "4242",
+		ExpMonth: 12, ExpYear: 2030, CreatedAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}}, m.err
+}
+
+func (m mockService) AddPaymentMethod(ctx context.Context, userId int, token string) (service.PaymentMethod, error) {
+	return service.PaymentMethod{ID: 2, UserID: userId, Token: token, Brand: "visa", Last4: "4242",
+		ExpMonth: 12, ExpYear: 2030}, m.err
+}
+
+func (m mockService) DeletePaymentMethod(ctx context.Context, userId, id int) error {
+	return m.err
+}
+
+func withUser(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), "userID", 1))
+}
+
+func TestGetPaymentMethodsHandler(t *testing.T) {
+	req := withUser(httptest.NewRequest(http.MethodGet, "/users/me/payment-methods/", nil))
+
+	response := httptest.NewRecorder()
+	HttpHandler{s: mockService{}}.getPaymentMethodsHandler(response, req)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `[{"id":1,"brand":"visa","last4":"4242","expMonth":12,"expYear":2030,
+		"createdAt":"2026-01-01T00:00:00Z"}]`, response.Body.String())
+	assert.NotContains(t, response.Body.String(), "tok_secret", "provider token must not be exposed")
+}
+
+func TestAddPaymentMethodHandler(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		err  error
+		code int
+	}{
+		{name: "method added", body: `{"token": "tok_123"}`, code: http.StatusCreated},
+		{name: "invalid json", body: `invalid`, code: http.StatusBadRequest},
+		{name: "missing token", body: `{}`, code: http.StatusBadRequest},
+		{name: "card number instead of token", body: `{"number": "4242424242424242"}`, code: http.StatusBadRequest},
+		{name: "invalid token", body: `{"token": "tok_123"}`, err: service.ErrInvalidPaymentToken,
+			code: http.StatusUnprocessableEntity},
+		{name: "expired card", body: `{"token": "tok_123"}`, err: service.ErrCardExpired,
+			code: http.StatusUnprocessableEntity},
+		{name: "already saved", body: `{"token": "tok_123"}`, err: service.ErrPaymentMethodExists,
+			code: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := withUser(httptest.NewRequest(http.MethodPost, "/users/me/payment-methods/",
+				strings.NewReader(tt.body)))
+
+			response := httptest.NewRecorder()
+			HttpHandler{s: mockService{err: tt.err}}.addPaymentMethodHandler(response, req)
+
+			assert.Equal(t, tt.code, response.Code)
+		})
+	}
+}
+
+func TestDeletePaymentMethodHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		methodId string
+		err      error
+		code     int
+	}{
+		{name: "method deleted", methodId: "1", code: http.StatusNoContent},
+		{name: "invalid id", methodId: "abc", code: http.StatusBadRequest},
+		{name: "not found", methodId: "1", err: service.ErrPaymentMethodNotFound, code: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := withUser(httptest.NewRequest(http.MethodDelete, "/users/me/payment-methods/"+tt.methodId, nil))
+			req = mux.SetURLVars(req, map[string]string{"methodId": tt.methodId})
+
+			response := httptest.NewRecorder()
+			HttpHandler{s: mockService{err: tt.err}}.deletePaymentMethodHandler(response, req)
+
+			assert.Equal(t, tt.code, response.Code)
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/payment/service"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+)
+
+const uniqueViolation = "23505"
+
+type PaymentRepository struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) PaymentRepository {
+	return PaymentRepository{db: db}
+}
+
+func (p PaymentRepository) PaymentMethods(userId int) ([]service.PaymentMethod, error) {
+	rows, err := p.db.Query(`SELECT method_id, user_id, provider_token, brand, last4, exp_month, exp_year, created_at
+			FROM payment_methods
+			WHERE user_id = $1
+			ORDER BY method_id`, userId)
+	if err != nil {
+		return nil, fmt.Errorf("could not get payment methods: %w", err)
+	}
+	defer rows.Close()
+
+	methods := make([]service.PaymentMethod, 0)
+	for rows.Next() {
+		var m service.PaymentMethod
+		err = rows.Scan(&m.ID, &m.UserID, &m.Token, &m.Brand, &m.Last4, &m.ExpMonth, &m.ExpYear, &m.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan payment method: %w", err)
+		}
+		methods = append(methods, m)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not get payment methods: %w", err)
+	}
+
+	return methods, nil
+}
+
+func (p PaymentRepository) CreatePaymentMethod(m service.PaymentMethod) (service.PaymentMethod, error) {
+	err := p.db.QueryRow(`INSERT INTO payment_methods (user_id, provider_token, brand, last4, exp_month, exp_year)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING method_id, created_at`,
+		m.UserID, m.Token, m.Brand, m.Last4, m.ExpMonth, m.ExpYear).Scan(&m.ID, &m.CreatedAt)
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return service.PaymentMethod{}, service.ErrPaymentMethodExists
+	}
+
+	if err != nil {
+		return service.PaymentMethod{}, fmt.Errorf("could not create payment method: %w", err)
+	}
+
+	return m, nil
+}
+
+func (p PaymentRepository) DeletePaymentMethod(userId, id int) (string, error) {
+	var token string
+	err := p.db.QueryRow(`DELETE FROM payment_methods WHERE method_id = $1 AND user_id = $2
+			RETURNING provider_token`, id, userId).Scan(&token)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", service.ErrPaymentMethodNotFound
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("could not delete payment method: %w", err)
+	}
+
+	return token, nil
+}
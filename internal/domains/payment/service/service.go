@@ -0,0 +1,112 @@
+package service
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/pkg/payment"
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+var (
+	ErrInternalError         = errors.New("internal server error")
+	ErrPaymentMethodNotFound = errors.New("payment method was not found")
+	ErrPaymentMethodExists   = errors.New("payment method is already saved")
+	ErrInvalidPaymentToken   = errors.New("invalid payment token")
+	ErrCardExpired           = errors.New("card is expired")
+)
+
+type PaymentMethod struct {
+	ID        int
+	UserID    int
+	Token     string
+	Brand     string
+	Last4     string
+	ExpMonth  int
+	ExpYear   int
+	CreatedAt time.Time
+}
+
+type repository interface {
+	PaymentMethods(userId int) ([]PaymentMethod, error)
+	CreatePaymentMethod(method PaymentMethod) (PaymentMethod, error)
+	DeletePaymentMethod(userId, id int) (token string, err error)
+}
+
+// PaymentProvider stores the card data. The service only ever sees the
+// provider token and the details needed to show the card to its owner.
+type PaymentProvider interface {
+	PaymentMethod(ctx context.Context, token string) (payment.Method, error)
+	Detach(ctx context.Context, token string) error
+}
+
+type Service struct {
+	r repository
+	p PaymentProvider
+}
+
+func New(r repository, p PaymentProvider) Service {
+	return Service{
+		r: r,
+		p: p,
+	}
+}
+
+func (s Service) PaymentMethods(userId int) ([]PaymentMethod, error) {
+	methods, err := s.r.PaymentMethods(userId)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrInternalError
+	}
+	return methods, nil
+}
+
+func (s Service) AddPaymentMethod(ctx context.Context, userId int, token string) (PaymentMethod, error) {
+	method, err := s.p.PaymentMethod(ctx, token)
+	if errors.Is(err, payment.ErrInvalidToken) {
+		return PaymentMethod{}, ErrInvalidPaymentToken
+	}
+	if err != nil {
+		log.Println("failed to get payment method from provider:", err)
+		return PaymentMethod{}, ErrInternalError
+	}
+
+	if method.Expired(time.Now()) {
+		return PaymentMethod{}, ErrCardExpired
+	}
+
+	created, err := s.r.CreatePaymentMethod(PaymentMethod{
+		UserID:   userId,
+		Token:    method.Token,
+		Brand:    method.Brand,
+		Last4:    method.Last4,
+		ExpMonth: method.ExpMonth,
+		ExpYear:  method.ExpYear,
+	})
+	if errors.Is(err, ErrPaymentMethodExists) {
+		return PaymentMethod{}, err
+	}
+	if err != nil {
+		log.Println(err)
+		return PaymentMethod{}, ErrInternalError
+	}
+
+	return created, nil
+}
+
+func (s Service) DeletePaymentMethod(ctx context.Context, userId, id int) error {
+	token, err := s.r.DeletePaymentMethod(userId, id)
+	if errors.Is(err, ErrPaymentMethodNotFound) {
+		return err
+	}
+	if err != nil {
+		log.Println(err)
+		return ErrInternalError
+	}
+
+	if err = s.p.Detach(ctx, token); err != nil {
+		log.Printf("failed to detach payment method %d from provider: %v", id, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/pkg/payment"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+type mockRepository struct {
+	methods []PaymentMethod
+	err     error
+}
+
+func (m *mockRepository) PaymentMethods(userId int) ([]PaymentMethod, error) {
+	var methods []PaymentMethod
+	for _, method := range m.methods {
+		if method.UserID == userId {
+			methods = append(methods, method)
+		}
+	}
+	return methods, m.err
+}
+
+func (m *mockRepository) CreatePaymentMethod(method PaymentMethod) (PaymentMethod, error) {
+	if m.err != nil {
+		return PaymentMethod{}, m.err
+	}
+	for _, existing := range m.methods {
+		if existing.Token == method.Token {
+			return PaymentMethod{}, ErrPaymentMethodExists
+		}
+	}
+	method.ID = len(m.methods) + 1
+	method.CreatedAt = time.Now()
+	m.methods = append(m.methods, method)
+	return method, nil
+}
+
+func (m *mockRepository) DeletePaymentMethod(userId, id int) (string, error) {
+	for i, method := range m.methods {
+		if method.ID == id && method.UserID == userId {
+			m.methods = append(m.methods[:i], m.methods[i+1:]...)
+			return method.Token, nil
+		}
+	}
+	return "", ErrPaymentMethodNotFound
+}
+
+func TestPaymentMethods(t *testing.T) {
+	provider := payment.NewFake()
+	repo := &mockRepository{}
+	s := New(repo, provider)
+	ctx := context.Background()
+	expYear := time.Now().Year() + 2
+
+	token, err := provider.Tokenize("4242424242424242", 12, expYear)
+	require.NoError(t, err)
+
+	var added PaymentMethod
+	t.Run("add payment method", func(t *testing.T) {
+		added, err = s.AddPaymentMethod(ctx, 1, token)
+		require.NoError(t, err)
+
+		assert.Equal(t, "visa", added.Brand)
+		assert.Equal(t, "4242", added.Last4)
+		assert.Equal(t, 12, added.ExpMonth)
+		assert.Equal(t, expYear, added.ExpYear)
+		assert.Equal(t, token, added.Token)
+	})
+
+	t.Run("same token twice", func(t *testing.T) {
+		_, err := s.AddPaymentMethod(ctx, 1, token)
+		assert.ErrorIs(t, err, ErrPaymentMethodExists)
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		_, err := s.AddPaymentMethod(ctx, 1, "tok_unknown")
+		assert.ErrorIs(t, err, ErrInvalidPaymentToken)
+	})
+
+	t.Run("expired card", func(t *testing.T) {
+		expired, err := provider.Tokenize("5555555555554444", 1, 2020)
+		require.NoError(t, err)
+
+		_, err = s.AddPaymentMethod(ctx, 1, expired)
+		assert.ErrorIs(t, err, ErrCardExpired)
+	})
+
+	t.Run("list payment methods", func(t *testing.T) {
+		methods, err := s.PaymentMethods(1)
+		require.NoError(t, err)
+		assert.Len(t, methods, 1)
+
+		methods, err = s.PaymentMethods(2)
+		require.NoError(t, err)
+		assert.Empty(t, methods)
+	})
+
+	t.Run("delete method of another user", func(t *testing.T) {
+		err := s.DeletePaymentMethod(ctx, 2, added.ID)
+		assert.ErrorIs(t, err, ErrPaymentMethodNotFound)
+	})
+
+	t.Run("delete payment method", func(t *testing.T) {
+		require.NoError(t, s.DeletePaymentMethod(ctx, 1, added.ID))
+
+		_, err := provider.PaymentMethod(ctx, token)
+		assert.ErrorIs(t, err, payment.ErrInvalidToken, "card should be detached from the provider")
+	})
+
+	t.Run("repository error", func(t *testing.T) {
+		repo.err = errors.New("something went wrong")
+		defer func() { repo.err = nil }()
+
+		_, err := s.PaymentMethods(1)
+		assert.ErrorIs(t, err, ErrInternalError)
+	})
+}
@@ -0,0 +1,252 @@
+package handler
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/apiutils"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/role/service"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+var (
+	ErrReadRequestFail  = errors.New("failed to read request body")
+	ErrInvalidRoleId    = errors.New("invalid role id")
+	ErrInvalidUserId    = errors.New("invalid user id")
+	ErrNoRoleName       = errors.New("missing role name")
+	ErrInvalidRoleName  = errors.New("invalid role name")
+	ErrNoPermissionName = errors.New("missing permission name")
+)
+
+const maxRoleNameLength = 50
+
+type role struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+type Service interface {
+	Roles() ([]service.Role, error)
+	Permissions() ([]string, error)
+	CreateRole(name string, permissions []string) (roleId int, err error)
+	DeleteRole(id int) error
+	GrantPermission(roleId int, permission string) error
+	RevokePermission(roleId int, permission string) error
+	AssignRole(userId, roleId int) error
+	UnassignRole(userId, roleId int) error
+}
+
+type AccessChecker interface {
+	Authenticate(next http.Handler) http.Handler
+	CheckPerms(perms ...string) mux.MiddlewareFunc
+}
+
+type HttpHandler struct {
+	s Service
+}
+
+func New(s Service) HttpHandler {
+	return HttpHandler{
+		s: s,
+	}
+}
+
+func (h HttpHandler) SetRoutes(router *mux.Router, a AccessChecker) {
+	rolesRouter := router.PathPrefix("/roles").Subrouter()
+	rolesRouter.Use(a.Authenticate)
+	rolesRouter.Use(a.CheckPerms(service.WritePermission))
+
+	rolesRouter.HandleFunc("/", h.getRolesHandler).Methods(http.MethodGet)
+	rolesRouter.HandleFunc("/", h.createRoleHandler).Methods(http.MethodPost)
+	rolesRouter.HandleFunc("/{roleId}", h.deleteRoleHandler).Methods(http.MethodDelete)
+	rolesRouter.HandleFunc("/{roleId}/permissions/{permission}", h.grantPermissionHandler).Methods(http.MethodPut)
+	rolesRouter.HandleFunc("/{roleId}/permissions/{permission}", h.revokePermissionHandler).Methods(http.MethodDelete)
+
+	permsRouter := router.PathPrefix("/permissions").Subrouter()
+	permsRouter.Use(a.Authenticate)
+	permsRouter.Use(a.CheckPerms(service.WritePermission))
+
+	permsRouter.HandleFunc("/", h.getPermissionsHandler).Methods(http.MethodGet)
+
+	usersRouter := router.PathPrefix("/users").Subrouter()
+	usersRouter.Use(a.Authenticate)
+	usersRouter.Use(a.CheckPerms(service.WritePermission))
+
+	usersRouter.HandleFunc("/{userId}/roles/{roleId}", h.assignRoleHandler).Methods(http.MethodPut)
+	usersRouter.HandleFunc("/{userId}/roles/{roleId}", h.unassignRoleHandler).Methods(http.MethodDelete)
+}
+
+func (h HttpHandler) getRolesHandler(w http.ResponseWriter, _ *http.Request) {
+	roles, err := h.s.Roles()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	apiutils.WriteResponse(w, entitiesToDTO(roles), http.StatusOK)
+}
+
+func (h HttpHandler) getPermissionsHandler(w http.ResponseWriter, _ *http.Request) {
+	perms, err := h.s.Permissions()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if perms == nil {
+		perms = []string{}
+	}
+
+	apiutils.WriteResponse(w, perms, http.StatusOK)
+}
+
+func (h HttpHandler) createRoleHandler(w http.ResponseWriter, r *http.Request) {
+	type roleInfo struct {
+		Name        string   `json:"name"`
+		Permissions []string `json:"permissions"`
+	}
+
+	var info roleInfo
+	if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
+		http.Error(w, ErrReadRequestFail.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if info.Name == "" {
+		http.Error(w, ErrNoRoleName.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(info.Name) > maxRoleNameLength {
+		http.Error(w, ErrInvalidRoleName.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, err := h.s.CreateRole(info.Name, info.Permissions)
+	if errors.Is(err, service.ErrRoleExists) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	if errors.Is(err, service.ErrPermissionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	apiutils.WriteResponse(w, map[string]int{"roleId": id}, http.StatusCreated)
+}
+
+func (h HttpHandler) deleteRoleHandler(w http.ResponseWriter, r *http.Request) {
+	roleId, err := apiutils.IntPathParam(r, "roleId")
+	if err != nil {
+		http.Error(w, ErrInvalidRoleId.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.s.DeleteRole(roleId)
+	if errors.Is(err, service.ErrRoleNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h HttpHandler) grantPermissionHandler(w http.ResponseWriter, r *http.Request) {
+	h.changePermission(w, r, h.s.GrantPermission, http.StatusOK)
+}
+
+func (h HttpHandler) revokePermissionHandler(w http.ResponseWriter, r *http.Request) {
+	h.changePermission(w, r, h.s.RevokePermission, http.StatusNoContent)
+}
+
+func (h HttpHandler) changePermission(w http.ResponseWriter, r *http.Request,
+	change func(roleId int, permission string) error, successCode int) {
+	roleId, err := apiutils.IntPathParam(r, "roleId")
+	if err != nil {
+		http.Error(w, ErrInvalidRoleId.Error(), http.StatusBadRequest)
+		return
+	}
+
+	permission := mux.Vars(r)["permission"]
+	if permission == "" {
+		http.Error(w, ErrNoPermissionName.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = change(roleId, permission)
+	if errors.Is(err, service.ErrRoleNotFound) || errors.Is(err, service.ErrPermissionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(successCode)
+}
+
+func (h HttpHandler) assignRoleHandler(w http.ResponseWriter, r *http.Request) {
+	h.changeUserRole(w, r, h.s.AssignRole, http.StatusOK)
+}
+
+func (h HttpHandler) unassignRoleHandler(w http.ResponseWriter, r *http.Request) {
+	h.changeUserRole(w, r, h.s.UnassignRole, http.StatusNoContent)
+}
+
+func (h HttpHandler) changeUserRole(w http.ResponseWriter, r *http.Request,
+	change func(userId, roleId int) error, successCode int) {
+	userId, err := apiutils.IntPathParam(r, "userId")
+	if err != nil {
+		http.Error(w, ErrInvalidUserId.Error(), http.StatusBadRequest)
+		return
+	}
+
+	roleId, err := apiutils.IntPathParam(r, "roleId")
+	if err != nil {
+		http.Error(w, ErrInvalidRoleId.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = change(userId, roleId)
+	if errors.Is(err, service.ErrUserNotFound) || errors.Is(err, service.ErrRoleNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(successCode)
+}
+
+func entitiesToDTO(roles []service.Role) []role {
+	DTORoles := []role{}
+	for _, r := range roles {
+		perms := r.Permissions
+		if perms == nil {
+			perms = []string{}
+		}
+		DTORoles = append(DTORoles, role{
+			ID:          r.Id,
+			Name:        r.Name,
+			Permissions: perms,
+		})
+	}
+	return DTORoles
+}
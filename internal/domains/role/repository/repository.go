@@ -0,0 +1,218 @@
+package repository
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/role/service"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"log"
+)
+
+const uniqueViolation = "23505"
+
+type RoleRepository struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) *RoleRepository {
+	return &RoleRepository{db: db}
+}
+
+func (r *RoleRepository) Roles() ([]service.Role, error) {
+	rows, err := r.db.Query(`SELECT r.role_id, r.role_name,
+				COALESCE(array_agg(p.permission_name ORDER BY p.permission_name)
+					FILTER (WHERE p.permission_name IS NOT NULL), '{}')
+			FROM roles r
+			LEFT JOIN role_permissions rp ON rp.role_id = r.role_id
+			LEFT JOIN permissions p ON p.permission_id = rp.permission_id
+			GROUP BY r.role_id, r.role_name
+			ORDER BY r.role_id`)
+	if err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to get roles: %w", err)
+	}
+
+	defer func() {
+		if err = rows.Close(); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	var roles []service.Role
+	for rows.Next() {
+		var role service.Role
+		if err = rows.Scan(&role.Id, &role.Name, pq.Array(&role.Permissions)); err != nil {
+			log.Println(err)
+			return nil, fmt.Errorf("failed to get role: %w", err)
+		}
+		roles = append(roles, role)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("error while iterating over roles: %w", err)
+	}
+
+	return roles, nil
+}
+
+func (r *RoleRepository) Permissions() ([]string, error) {
+	rows, err := r.db.Query("SELECT permission_name FROM permissions ORDER BY permission_name")
+	if err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("failed to get permissions: %w", err)
+	}
+
+	defer func() {
+		if err = rows.Close(); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	var perms []string
+	for rows.Next() {
+		var perm string
+		if err = rows.Scan(&perm); err != nil {
+			log.Println(err)
+			return nil, fmt.Errorf("failed to get permission: %w", err)
+		}
+		perms = append(perms, perm)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Println(err)
+		return nil, fmt.Errorf("error while iterating over permissions: %w", err)
+	}
+
+	return perms, nil
+}
+
+func (r *RoleRepository) CreateRole(name string, permissions []string) (roleId int, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Println(err)
+		}
+	}()
+
+	err = tx.QueryRow("INSERT INTO roles (role_name) VALUES ($1) RETURNING role_id", name).Scan(&roleId)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return 0, fmt.Errorf("%w: %q", service.ErrRoleExists, name)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("could not create role: %w", err)
+	}
+
+	_, err = tx.Exec(`INSERT INTO role_permissions (role_id, permission_id)
+			SELECT $1, permission_id FROM permissions WHERE permission_name = ANY($2)`,
+		roleId, pq.Array(permissions))
+	if err != nil {
+		return 0, fmt.Errorf("could not grant permissions to role: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("could not create role: %w", err)
+	}
+
+	return roleId, nil
+}
+
+func (r *RoleRepository) DeleteRole(id int) (bool, error) {
+	res, err := r.db.Exec("DELETE FROM roles WHERE role_id = $1", id)
+	if err != nil {
+		log.Println(err)
+		return false, fmt.Errorf("failed to delete role: %w", err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete role: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+func (r *RoleRepository) RoleExists(id int) (bool, error) {
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM roles WHERE role_id = $1", id).Scan(&count)
+	if err != nil {
+		log.Println(err)
+		return false, fmt.Errorf("failed to check if role exists %w", err)
+	}
+
+	return count > 0, nil
+}
+
+func (r *RoleRepository) PermissionExists(name string) (bool, error) {
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM permissions WHERE permission_name = $1", name).Scan(&count)
+	if err != nil {
+		log.Println(err)
+		return false, fmt.Errorf("failed to check if permission exists %w", err)
+	}
+
+	return count > 0, nil
+}
+
+func (r *RoleRepository) UserExists(id int) (bool, error) {
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM users WHERE user_id = $1", id).Scan(&count)
+	if err != nil {
+		log.Println(err)
+		return false, fmt.Errorf("failed to check if user exists %w", err)
+	}
+
+	return count > 0, nil
+}
+
+func (r *RoleRepository) GrantPermission(roleId int, permission string) error {
+	_, err := r.db.Exec(`INSERT INTO role_permissions (role_id, permission_id)
+			SELECT $1, permission_id FROM permissions WHERE permission_name = $2
+			ON CONFLICT DO NOTHING`, roleId, permission)
+	if err != nil {
+		log.Println(err)
+		return fmt.Errorf("failed to grant permission: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RoleRepository) RevokePermission(roleId int, permission string) error {
+	_, err := r.db.Exec(`DELETE FROM role_permissions
+			WHERE role_id = $1 AND permission_id = (
+				SELECT permission_id FROM permissions WHERE permission_name = $2
+			)`, roleId, permission)
+	if err != nil {
+		log.Println(err)
+		return fmt.Errorf("failed to revoke permission: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RoleRepository) AssignRole(userId, roleId int) error {
+	_, err := r.db.Exec(`INSERT INTO user_roles (user_id, role_id)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING`, userId, roleId)
+	if err != nil {
+		log.Println(err)
+		return fmt.Errorf("failed to assign role: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RoleRepository) UnassignRole(userId, roleId int) error {
+	_, err := r.db.Exec("DELETE FROM user_roles WHERE user_id = $1 AND role_id = $2", userId, roleId)
+	if err != nil {
+		log.Println(err)
+		return fmt.Errorf("failed to unassign role: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"errors"
+	"log"
+)
+
+var (
+	ErrInternalError      = errors.New("internal server error")
+	ErrRoleNotFound       = errors.New("role was not found")
+	ErrRoleExists         = errors.New("role already exists")
+	ErrPermissionNotFound = errors.New("permission was not found")
+	ErrUserNotFound       = errors.New("user was not found")
+)
+
+const WritePermission = "roles:write"
+
+type Role struct {
+	Id          int
+	Name        string
+	Permissions []string
+}
+
+type repository interface {
+	Roles() ([]Role, error)
+	Permissions() ([]string, error)
+	CreateRole(name string, permissions []string) (roleId int, err error)
+	DeleteRole(id int) (bool, error)
+	RoleExists(id int) (bool, error)
+	PermissionExists(name string) (bool, error)
+	UserExists(id int) (bool, error)
+	GrantPermission(roleId int, permission string) error
+	RevokePermission(roleId int, permission string) error
+	AssignRole(userId, roleId int) error
+	UnassignRole(userId, roleId int) error
+}
+
+type Service struct {
+	r repository
+}
+
+func New(r repository) Service {
+	return Service{r: r}
+}
+
+func (s Service) Roles() ([]Role, error) {
+	roles, err := s.r.Roles()
+	if err != nil {
+		log.Println(err)
+		return nil, ErrInternalError
+	}
+	return roles, nil
+}
+
+func (s Service) Permissions() ([]string, error) {
+	perms, err := s.r.Permissions()
+	if err != nil {
+		log.Println(err)
+		return nil, ErrInternalError
+	}
+	return perms, nil
+}
+
+func (s Service) CreateRole(name string, permissions []string) (int, error) {
+	for _, perm := range permissions {
+		if err := s.permissionExists(perm); err != nil {
+			return 0, err
+		}
+	}
+
+	id, err := s.r.CreateRole(name, permissions)
+	if errors.Is(err, ErrRoleExists) {
+		return 0, err
+	}
+	if err != nil {
+		log.Println(err)
+		return 0, ErrInternalError
+	}
+
+	return id, nil
+}
+
+func (s Service) DeleteRole(id int) error {
+	found, err := s.r.DeleteRole(id)
+	if err != nil {
+		log.Println(err)
+		return ErrInternalError
+	}
+	if !found {
+		return ErrRoleNotFound
+	}
+	return nil
+}
+
+func (s Service) GrantPermission(roleId int, permission string) error {
+	if err := s.roleExists(roleId); err != nil {
+		return err
+	}
+	if err := s.permissionExists(permission); err != nil {
+		return err
+	}
+
+	if err := s.r.GrantPermission(roleId, permission); err != nil {
+		log.Println(err)
+		return ErrInternalError
+	}
+	return nil
+}
+
+func (s Service) RevokePermission(roleId int, permission string) error {
+	if err := s.roleExists(roleId); err != nil {
+		return err
+	}
+	if err := s.permissionExists(permission); err != nil {
+		return err
+	}
+
+	if err := s.r.RevokePermission(roleId, permission); err != nil {
+		log.Println(err)
+		return ErrInternalError
+	}
+	return nil
+}
+
+func (s Service) AssignRole(userId, roleId int) error {
+	if err := s.userExists(userId); err != nil {
+		return err
+	}
+	if err := s.roleExists(roleId); err != nil {
+		return err
+	}
+
+	if err := s.r.AssignRole(userId, roleId); err != nil {
+		log.Println(err)
+		return ErrInternalError
+	}
+	return nil
+}
+
+func (s Service) UnassignRole(userId, roleId int) error {
+	if err := s.userExists(userId); err != nil {
+		return err
+	}
+	if err := s.roleExists(roleId); err != nil {
+		return err
+	}
+
+	if err := s.r.UnassignRole(userId, roleId); err != nil {
+		log.Println(err)
+		return ErrInternalError
+	}
+	return nil
+}
+
+func (s Service) roleExists(id int) error {
+	ok, err := s.r.RoleExists(id)
+	if err != nil {
+		log.Println(err)
+		return ErrInternalError
+	}
+	if !ok {
+		return ErrRoleNotFound
+	}
+	return nil
+}
+
+func (s Service) permissionExists(name string) error {
+	ok, err := s.r.PermissionExists(name)
+	if err != nil {
+		log.Println(err)
+		return ErrInternalError
+	}
+	if !ok {
+		return ErrPermissionNotFound
+	}
+	return nil
+}
+
+func (s Service) userExists(id int) error {
+	ok, err := s.r.UserExists(id)
+	if err != nil {
+		log.Println(err)
+		return ErrInternalError
+	}
+	if !ok {
+		return ErrUserNotFound
+	}
+	return nil
+}
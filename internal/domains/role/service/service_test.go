@@ -0,0 +1,196 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockRepository struct {
+	roles       map[int]Role
+	permissions []string
+	users       map[int][]int
+	err         error
+}
+
+func newMockRepository() *mockRepository {
+	return &mockRepository{
+		roles:       map[int]Role{1: {Id: 1, Name: "admin", Permissions: []string{"movies:write"}}},
+		permissions: []string{"movies:write", "halls:write"},
+		users:       map[int][]int{1: {1}},
+	}
+}
+
+func (m *mockRepository) Roles() ([]Role, error) {
+	var roles []Role
+	for _, r := range m.roles {
+		roles = append(roles, r)
+	}
+	return roles, m.err
+}
+
+func (m *mockRepository) Permissions() ([]string, error) {
+	return m.permissions, m.err
+}
+
+func (m *mockRepository) CreateRole(name string, permissions []string) (int, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+	for _, r := range m.roles {
+		if r.Name == name {
+			return 0, fmt.Errorf("%w: %q", ErrRoleExists, name)
+		}
+	}
+	id := len(m.roles) + 1
+	m.roles[id] = Role{Id: id, Name: name, Permissions: permissions}
+	return id, nil
+}
+
+func (m *mockRepository) DeleteRole(id int) (bool, error) {
+	_, ok := m.roles[id]
+	delete(m.roles, id)
+	return ok, m.err
+}
+
+func (m *mockRepository) RoleExists(id int) (bool, error) {
+	_, ok := m.roles[id]
+	return ok, m.err
+}
+
+func (m *mockRepository) PermissionExists(name string) (bool, error) {
+	for _, p := range m.permissions {
+		if p == name {
+			return true, m.err
+		}
+	}
+	return false, m.err
+}
+
+func (m *mockRepository) UserExists(id int) (bool, error) {
+	_, ok := m.users[id]
+	return ok, m.err
+}
+
+func (m *mockRepository) GrantPermission(roleId int, permission string) error {
+	role := m.roles[roleId]
+	role.Permissions = append(role.Permissions, permission)
+	m.roles[roleId] = role
+	return m.err
+}
+
+func (m *mockRepository) RevokePermission(roleId int, permission string) error {
+	role := m.roles[roleId]
+	var perms []string
+	for _, p := range role.Permissions {
+		if p != permission {
+			perms = append(perms, p)
+		}
+	}
+	role.Permissions = perms
+	m.roles[roleId] = role
+	return m.err
+}
+
+func (m *mockRepository) AssignRole(userId, roleId int) error {
+	m.users[userId] = append(m.users[userId], roleId)
+	return m.err
+}
+
+func (m *mockRepository) UnassignRole(userId, roleId int) error {
+	m.users[userId] = nil
+	return m.err
+}
+
+func TestCreateRole(t *testing.T) {
+	t.Run("successful role creation", func(t *testing.T) {
+		repo := newMockRepository()
+		s := New(repo)
+		id, err := s.CreateRole("manager", []string{"halls:write"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"halls:write"}, repo.roles[id].Permissions)
+	})
+
+	t.Run("role exists", func(t *testing.T) {
+		s := New(newMockRepository())
+		_, err := s.CreateRole("admin", nil)
+		assert.ErrorIs(t, err, ErrRoleExists)
+	})
+
+	t.Run("unknown permission", func(t *testing.T) {
+		repo := newMockRepository()
+		s := New(repo)
+		_, err := s.CreateRole("manager", []string{"unknown:write"})
+		assert.ErrorIs(t, err, ErrPermissionNotFound)
+		assert.Len(t, repo.roles, 1)
+	})
+
+	t.Run("repository error", func(t *testing.T) {
+		repo := newMockRepository()
+		repo.err = errors.New("something went wrong")
+		s := New(repo)
+		_, err := s.CreateRole("manager", nil)
+		assert.ErrorIs(t, err, ErrInternalError)
+	})
+}
+
+func TestDeleteRole(t *testing.T) {
+	s := New(newMockRepository())
+	assert.NoError(t, s.DeleteRole(1))
+	assert.ErrorIs(t, s.DeleteRole(1), ErrRoleNotFound)
+}
+
+func TestGrantPermission(t *testing.T) {
+	t.Run("successful grant", func(t *testing.T) {
+		repo := newMockRepository()
+		s := New(repo)
+		assert.NoError(t, s.GrantPermission(1, "halls:write"))
+		assert.Contains(t, repo.roles[1].Permissions, "halls:write")
+	})
+
+	t.Run("role not found", func(t *testing.T) {
+		s := New(newMockRepository())
+		assert.ErrorIs(t, s.GrantPermission(2, "halls:write"), ErrRoleNotFound)
+	})
+
+	t.Run("permission not found", func(t *testing.T) {
+		s := New(newMockRepository())
+		assert.ErrorIs(t, s.GrantPermission(1, "unknown:write"), ErrPermissionNotFound)
+	})
+}
+
+func TestRevokePermission(t *testing.T) {
+	repo := newMockRepository()
+	s := New(repo)
+	assert.NoError(t, s.RevokePermission(1, "movies:write"))
+	assert.Empty(t, repo.roles[1].Permissions)
+}
+
+func TestAssignRole(t *testing.T) {
+	t.Run("successful assignment", func(t *testing.T) {
+		repo := newMockRepository()
+		repo.users[2] = nil
+		s := New(repo)
+		assert.NoError(t, s.AssignRole(2, 1))
+		assert.Equal(t, []int{1}, repo.users[2])
+	})
+
+	t.Run("user not found", func(t *testing.T) {
+		s := New(newMockRepository())
+		assert.ErrorIs(t, s.AssignRole(5, 1), ErrUserNotFound)
+	})
+
+	t.Run("role not found", func(t *testing.T) {
+		s := New(newMockRepository())
+		assert.ErrorIs(t, s.AssignRole(1, 5), ErrRoleNotFound)
+	})
+}
+
+func TestUnassignRole(t *testing.T) {
+	repo := newMockRepository()
+	s := New(repo)
+	assert.NoError(t, s.UnassignRole(1, 1))
+	assert.Empty(t, repo.users[1])
+}
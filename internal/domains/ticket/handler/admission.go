@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/apiutils"
+	ticketServ "bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/ticket/service"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+type ticketCode struct {
+	Code string `json:"code"`
+}
+
+func (h HttpHandler) validateTicket(w http.ResponseWriter, r *http.Request) {
+	var c ticketCode
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		http.Error(w, ErrReadRequestFail.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t, err := h.s.ValidateTicket(c.Code)
+	if errors.Is(err, ticketServ.ErrInvalidTicketCode) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if errors.Is(err, ticketServ.ErrTicketCancelled) || errors.Is(err, ticketServ.ErrTicketAdmitted) ||
+		errors.Is(err, ticketServ.ErrAdmissionClosed) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	apiutils.WriteResponse(w, ticketDetails(t), http.StatusOK)
+}
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/apiutils"
+	ticketServ "bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/ticket/service"
+	"errors"
+	"net/http"
+)
+
+func (h HttpHandler) getTicketPDF(w http.ResponseWriter, r *http.Request) {
+	ticketId, err := apiutils.IntPathParam(r, "ticketId")
+	if err != nil {
+		http.Error(w, ErrInvalidTicketId.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userId := r.Context().Value("userID").(int)
+	if canReadAnyTicket(r) {
+		userId = ticketServ.AnyUser
+	}
+
+	url, err := h.s.TicketURL(r.Context(), ticketId, userId)
+	if errors.Is(err, ticketServ.ErrTicketNotFound) || errors.Is(err, ticketServ.ErrTicketFileNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if errors.Is(err, ticketServ.ErrTicketCancelled) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	apiutils.WriteResponse(w, map[string]string{"ticketPath": url}, http.StatusOK)
+}
@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/apiutils"
+	ticketServ "bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/ticket/service"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/mail"
+	"strconv"
+)
+
+const maxEmailLength = 50
+
+var (
+	ErrInvalidEmail  = errors.New("invalid email")
+	ErrNoLookupCode  = errors.New("missing lookup code")
+	ErrInvalidTicket = errors.New("session id and seat number must be positive")
+)
+
+type guestTicket struct {
+	Email      string `json:"email"`
+	SessionId  int    `json:"sessionId"`
+	SeatNumber int    `json:"seatNumber"`
+}
+
+type lookupCode struct {
+	LookupCode string `json:"lookupCode"`
+}
+
+type ticketInfo struct {
+	Id         int     `json:"ticketId"`
+	MovieName  string  `json:"movieName"`
+	Date       string  `json:"date"`
+	StartTime  string  `json:"startTime"`
+	Duration   int     `json:"duration"`
+	HallId     int     `json:"hallId"`
+	SeatNumber int     `json:"seatNumber"`
+	Price      float64 `json:"price"`
+}
+
+type guestTicketInfo struct {
+	ticketInfo
+	TicketPath string `json:"ticketPath,omitempty"`
+}
+
+func ticketToDTO(t ticketServ.Ticket) ticketInfo {
+	return ticketInfo{
+		Id:         t.Id,
+		MovieName:  t.MovieName,
+		Date:       t.Date,
+		StartTime:  t.StartTime,
+		Duration:   t.Duration,
+		HallId:     t.HallId,
+		SeatNumber: t.SeatNumber,
+		Price:      t.Price,
+	}
+}
+
+func (h HttpHandler) createGuestTicket(w http.ResponseWriter, r *http.Request) {
+	var t guestTicket
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		http.Error(w, ErrReadRequestFail.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := t.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ticketPath, code, err := h.s.BuyGuestTicket(r.Context(), t.Email, apiutils.ClientIP(r), t.SessionId,
+		t.SeatNumber)
+	var retryErr ticketServ.RetryError
+	if errors.As(err, &retryErr) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryErr.RetryAfter.Seconds()))))
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+
+	if errors.Is(err, ticketServ.ErrCinemaSessionsNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if errors.Is(err, ticketServ.ErrInvalidSeat) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if errors.Is(err, ticketServ.ErrTicketExists) || errors.Is(err, ticketServ.ErrSeatHeld) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := map[string]string{"lookupCode": code}
+	if ticketPath != "" {
+		resp["ticketPath"] = ticketPath
+	}
+	apiutils.WriteResponse(w, resp, http.StatusCreated)
+}
+
+func (h HttpHandler) lookupGuestTickets(w http.ResponseWriter, r *http.Request) {
+	code, ok := readLookupCode(w, r)
+	if !ok {
+		return
+	}
+
+	tickets, err := h.s.GuestTickets(r.Context(), code)
+	if errors.Is(err, ticketServ.ErrInvalidLookupCode) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]guestTicketInfo, 0, len(tickets))
+	for _, t := range tickets {
+		resp = append(resp, guestTicketInfo{ticketInfo: ticketToDTO(t.Ticket), TicketPath: t.TicketPath})
+	}
+
+	apiutils.WriteResponse(w, resp, http.StatusOK)
+}
+
+func (h HttpHandler) claimTickets(w http.ResponseWriter, r *http.Request) {
+	code, ok := readLookupCode(w, r)
+	if !ok {
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+
+	claimed, err := h.s.ClaimTickets(userID, code)
+	if errors.Is(err, ticketServ.ErrInvalidLookupCode) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	apiutils.WriteResponse(w, map[string]int{"claimed": claimed}, http.StatusOK)
+}
+
+func readLookupCode(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var c lookupCode
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		http.Error(w, ErrReadRequestFail.Error(), http.StatusBadRequest)
+		return "", false
+	}
+
+	if c.LookupCode == "" {
+		http.Error(w, ErrNoLookupCode.Error(), http.StatusBadRequest)
+		return "", false
+	}
+
+	return c.LookupCode, true
+}
+
+func (t guestTicket) validate() error {
+	addr, err := mail.ParseAddress(t.Email)
+	if err != nil || addr.Address != t.Email || len(t.Email) > maxEmailLength {
+		return ErrInvalidEmail
+	}
+
+	if t.SessionId <= 0 || t.SeatNumber <= 0 {
+		return ErrInvalidTicket
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/apiutils"
+	ticketServ "bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/ticket/service"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultLimit = 10
+	maxLimit     = 100
+)
+
+var (
+	ErrInvalidOffset = errors.New("invalid offset parameter")
+	ErrInvalidLimit  = errors.New("invalid limit parameter")
+	ErrInvalidUserId = errors.New("invalid user id")
+	ErrForbidden     = errors.New("insufficient permissions")
+)
+
+type ticketDetails struct {
+	Id         int       `json:"ticketId"`
+	UserId     int       `json:"userId"`
+	SessionId  int       `json:"sessionId"`
+	MovieTitle string    `json:"movieTitle"`
+	HallName   string    `json:"hallName"`
+	StartTime  time.Time `json:"startTime"`
+	SeatNumber int       `json:"seatNumber"`
+	Price      float64   `json:"price"`
+	Status     string    `json:"status"`
+}
+
+type ticketList struct {
+	Tickets []ticketDetails `json:"tickets"`
+	Total   int             `json:"total"`
+	Offset  int             `json:"offset"`
+	Limit   int             `json:"limit"`
+}
+
+func (h HttpHandler) getTickets(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := ticketServ.TicketFilter{
+		UserId: r.Context().Value("userID").(int),
+		Period: query.Get("period"),
+		Limit:  defaultLimit,
+	}
+
+	var err error
+	if userId := query.Get("userId"); userId != "" {
+		if !canReadAnyTicket(r) {
+			http.Error(w, ErrForbidden.Error(), http.StatusForbidden)
+			return
+		}
+		if filter.UserId, err = strconv.Atoi(userId); err != nil || filter.UserId <= 0 {
+			http.Error(w, ErrInvalidUserId.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if offset := query.Get("offset"); offset != "" {
+		if filter.Offset, err = strconv.Atoi(offset); err != nil || filter.Offset < 0 {
+			http.Error(w, ErrInvalidOffset.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit <= 0 || filter.Limit > maxLimit {
+			http.Error(w, ErrInvalidLimit.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	tickets, total, err := h.s.UserTickets(filter)
+	if errors.Is(err, ticketServ.ErrInvalidPeriod) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	list := ticketList{Tickets: make([]ticketDetails, 0, len(tickets)), Total: total, Offset: filter.Offset,
+		Limit: filter.Limit}
+	for _, t := range tickets {
+		list.Tickets = append(list.Tickets, ticketDetails(t))
+	}
+
+	apiutils.WriteResponse(w, list, http.StatusOK)
+}
+
+func (h HttpHandler) getTicket(w http.ResponseWriter, r *http.Request) {
+	ticketId, err := apiutils.IntPathParam(r, "ticketId")
+	if err != nil {
+		http.Error(w, ErrInvalidTicketId.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userId := r.Context().Value("userID").(int)
+	if canReadAnyTicket(r) {
+		userId = ticketServ.AnyUser
+	}
+
+	t, err := h.s.TicketDetails(ticketId, userId)
+	if errors.Is(err, ticketServ.ErrTicketNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	apiutils.WriteResponse(w, ticketDetails(t), http.StatusOK)
+}
+
+// canReadAnyTicket reports whether the caller may see tickets of other users.
+func canReadAnyTicket(r *http.Request) bool {
+	return hasPermission(r, ticketServ.ReadPermission)
+}
+
+// hasPermission reports whether the caller has been granted the permission.
+func hasPermission(r *http.Request, permission string) bool {
+	perms, _ := r.Context().Value("permissions").([]string)
+	for _, p := range perms {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
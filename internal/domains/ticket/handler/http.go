@@ -12,14 +12,26 @@ import (
 
 var (
 	ErrReadRequestFail = errors.New("failed to read request body")
+	ErrInvalidTicketId = errors.New("invalid ticket id")
 )
 
 type service interface {
 	BuyTicket(ctx context.Context, sessionId, userId, seatNum int) (string, error)
+	BuyGuestTicket(ctx context.Context, email, clientIP string, sessionId, seatNum int) (ticketPath string,
+		lookupCode string, err error)
+	GuestTickets(ctx context.Context, lookupCode string) ([]ticketServ.GuestTicket, error)
+	ClaimTickets(userId int, lookupCode string) (int, error)
+	BuyOrder(ctx context.Context, sessionId, userId int, seats []int) (ticketServ.Order, string, error)
+	CancelTicket(userId, ticketId int) (ticketServ.Refund, error)
+	UserTickets(filter ticketServ.TicketFilter) ([]ticketServ.TicketDetails, int, error)
+	TicketDetails(ticketId, userId int) (ticketServ.TicketDetails, error)
+	TicketURL(ctx context.Context, ticketId, userId int) (string, error)
+	ValidateTicket(code string) (ticketServ.TicketDetails, error)
 }
 
 type accessChecker interface {
 	Authenticate(next http.Handler) http.Handler
+	CheckPerms(perms ...string) mux.MiddlewareFunc
 }
 
 func New(s service) HttpHandler {
@@ -38,9 +50,24 @@ type ticket struct {
 }
 
 func (h HttpHandler) SetRoutes(router *mux.Router, a accessChecker) {
+	guest := router.PathPrefix("/tickets/guest").Subrouter()
+	guest.HandleFunc("/", h.createGuestTicket).Methods(http.MethodPost)
+	guest.HandleFunc("/lookup", h.lookupGuestTickets).Methods(http.MethodPost)
+
+	staff := router.PathPrefix("/tickets").Subrouter()
+	staff.Use(a.Authenticate)
+	staff.Use(a.CheckPerms(ticketServ.ValidatePermission))
+	staff.HandleFunc("/validate", h.validateTicket).Methods(http.MethodPost)
+
 	s := router.PathPrefix("/tickets").Subrouter()
 	s.Use(a.Authenticate)
+	s.HandleFunc("/", h.getTickets).Methods(http.MethodGet)
 	s.HandleFunc("/", h.createTicket).Methods(http.MethodPost)
+	s.HandleFunc("/claim", h.claimTickets).Methods(http.MethodPost)
+	s.HandleFunc("/orders", h.createOrder).Methods(http.MethodPost)
+	s.HandleFunc("/{ticketId}", h.getTicket).Methods(http.MethodGet)
+	s.HandleFunc("/{ticketId}/pdf", h.getTicketPDF).Methods(http.MethodGet)
+	s.HandleFunc("/{ticketId}", h.cancelTicket).Methods(http.MethodDelete)
 }
 
 func (h HttpHandler) createTicket(w http.ResponseWriter, r *http.Request) {
@@ -61,7 +88,12 @@ func (h HttpHandler) createTicket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if errors.Is(err, ticketServ.ErrTicketExists) {
+	if errors.Is(err, ticketServ.ErrInvalidSeat) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if errors.Is(err, ticketServ.ErrTicketExists) || errors.Is(err, ticketServ.ErrSeatHeld) {
 		http.Error(w, err.Error(), http.StatusConflict)
 		return
 	}
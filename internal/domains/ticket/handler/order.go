@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/apiutils"
+	ticketServ "bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/ticket/service"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+type orderRequest struct {
+	SessionId int   `json:"sessionId"`
+	Seats     []int `json:"seats"`
+}
+
+type orderItem struct {
+	TicketId   int     `json:"ticketId"`
+	SeatNumber int     `json:"seatNumber"`
+	Price      float64 `json:"price"`
+}
+
+type order struct {
+	Id         int         `json:"orderId"`
+	SessionId  int         `json:"sessionId"`
+	Items      []orderItem `json:"items"`
+	TotalPrice float64     `json:"totalPrice"`
+	TicketPath string      `json:"ticketPath"`
+}
+
+func (h HttpHandler) createOrder(w http.ResponseWriter, r *http.Request) {
+	var req orderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, ErrReadRequestFail.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+
+	o, ticketPath, err := h.s.BuyOrder(r.Context(), req.SessionId, userID, req.Seats)
+	if errors.Is(err, ticketServ.ErrInvalidOrder) || errors.Is(err, ticketServ.ErrInvalidSeat) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if errors.Is(err, ticketServ.ErrCinemaSessionsNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if errors.Is(err, ticketServ.ErrTicketExists) || errors.Is(err, ticketServ.ErrSeatHeld) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := order{
+		Id:         o.Id,
+		SessionId:  o.SessionId,
+		Items:      make([]orderItem, 0, len(o.Tickets)),
+		TotalPrice: o.TotalPrice,
+		TicketPath: ticketPath,
+	}
+	for _, t := range o.Tickets {
+		resp.Items = append(resp.Items, orderItem{TicketId: t.Id, SeatNumber: t.SeatNumber, Price: t.Price})
+	}
+
+	apiutils.WriteResponse(w, resp, http.StatusCreated)
+}
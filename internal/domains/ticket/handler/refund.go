@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/apiutils"
+	ticketServ "bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/ticket/service"
+	"errors"
+	"net/http"
+)
+
+type refund struct {
+	Id       int     `json:"refundId"`
+	TicketId int     `json:"ticketId"`
+	Amount   float64 `json:"amount"`
+	Status   string  `json:"status"`
+}
+
+func (h HttpHandler) cancelTicket(w http.ResponseWriter, r *http.Request) {
+	ticketId, err := apiutils.IntPathParam(r, "ticketId")
+	if err != nil {
+		http.Error(w, ErrInvalidTicketId.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+	if hasPermission(r, ticketServ.RefundPermission) {
+		userID = ticketServ.AnyUser
+	}
+
+	ref, err := h.s.CancelTicket(userID, ticketId)
+	if errors.Is(err, ticketServ.ErrTicketNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if errors.Is(err, ticketServ.ErrTicketCancelled) || errors.Is(err, ticketServ.ErrCancellationClosed) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	apiutils.WriteResponse(w, refund{
+		Id:       ref.Id,
+		TicketId: ref.TicketId,
+		Amount:   ref.Amount,
+		Status:   ref.Status,
+	}, http.StatusAccepted)
+}
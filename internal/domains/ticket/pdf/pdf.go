@@ -2,42 +2,97 @@ package pdfgenerator
 
 import (
 	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/ticket/service"
+	"bytes"
 	"fmt"
+	"github.com/boombuler/barcode/qr"
 	"github.com/jung-kurt/gofpdf"
 	"io"
 	"log"
+	"strconv"
+	"time"
 )
 
 const (
-	textWidth            = 40
-	textHeight           = 10
-	textSize             = 12
-	lineBreakAfterHeader = 12
-	lineBreak            = 8
+	fontFamily   = "ticket"
+	logoName     = "logo"
+	margin       = 6
+	headerHeight = 24
+	logoSize     = 16
+	labelWidth   = 24
+	lineHeight   = 6
+	titleSize    = 14
+	labelSize    = 8
+	valueSize    = 10
+	minValueSize = 6
+	termsSize    = 6
+	termsHeight  = 16
+	qrMaxSize    = 34
+	qrMinSize    = 20
 )
 
-type Generator struct{}
-
-func (p Generator) GenerateTicket(t service.Ticket, w io.Writer) error {
-	pdf := gofpdf.New("P", "mm", "A6", "")
-	pdf.AddPage()
-
-	pdf.SetFont("Arial", "B", 16)
-	pdf.Cell(textWidth, textHeight, "Ticket Details")
-	pdf.Ln(lineBreakAfterHeader)
-
-	pdf.SetFont("Arial", "", textSize)
-	pdf.Cell(textWidth, textHeight, fmt.Sprintf("Movie: %s", t.MovieName))
-	pdf.Ln(lineBreak)
-	pdf.Cell(textWidth, textHeight, fmt.Sprintf("Date: %s", t.Date))
-	pdf.Ln(lineBreak)
-	pdf.Cell(textWidth, textHeight, fmt.Sprintf("Start time: %s", t.StartTime))
-	pdf.Ln(lineBreak)
-	pdf.Cell(textWidth, textHeight, fmt.Sprintf("Duration: %d hour(s) %d minute(s)", t.Duration/60, t.Duration%60))
-	pdf.Ln(lineBreak)
-	pdf.Cell(textWidth, textHeight, fmt.Sprintf("Hall: %d", t.HallId))
-	pdf.Ln(lineBreak)
-	pdf.Cell(textWidth, textHeight, fmt.Sprintf("Seat Number: %d", t.SeatNumber))
+// now is the creation and modification date written into the PDF. Tests fix
+// it to get reproducible output.
+var now = time.Now
+
+type Generator struct {
+	t                         Template
+	labels                    labels
+	primary, text, headerText rgb
+}
+
+func New(t Template) (Generator, error) {
+	g := Generator{t: t}
+
+	var ok bool
+	if g.labels, ok = translations[t.Language]; !ok {
+		return Generator{}, fmt.Errorf("%w: %q", ErrUnknownLanguage, t.Language)
+	}
+
+	if t.PageSize != "A5" && t.PageSize != "A6" {
+		return Generator{}, ErrInvalidPageSize
+	}
+
+	var err error
+	if g.primary, err = parseColor(t.Colors.Primary); err != nil {
+		return Generator{}, fmt.Errorf("primary: %w", err)
+	}
+	if g.text, err = parseColor(t.Colors.Text); err != nil {
+		return Generator{}, fmt.Errorf("text: %w", err)
+	}
+	if g.headerText, err = parseColor(t.Colors.HeaderText); err != nil {
+		return Generator{}, fmt.Errorf("headerText: %w", err)
+	}
+
+	return g, nil
+}
+
+func (p Generator) GenerateTickets(tickets []service.Ticket, w io.Writer) error {
+	pdf := gofpdf.New("P", "mm", p.t.PageSize, "")
+	pdf.SetCreationDate(now())
+	pdf.SetModificationDate(now())
+	pdf.SetCatalogSort(true)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.SetMargins(margin, margin, margin)
+	pdf.AddUTF8FontFromBytes(fontFamily, "", p.t.font)
+	if p.t.logo != nil {
+		pdf.RegisterImageOptionsReader(logoName, gofpdf.ImageOptions{ImageType: p.t.logoType},
+			bytes.NewReader(p.t.logo))
+	}
+
+	for _, t := range tickets {
+		pdf.AddPage()
+		p.header(pdf, t)
+		p.details(pdf, t)
+
+		if t.Code != "" {
+			if err := addQRCode(pdf, t); err != nil {
+				log.Printf("error while generating QR code: %v", err)
+				return err
+			}
+		}
+
+		p.terms(pdf)
+	}
 
 	err := pdf.Output(w)
 	if err != nil {
@@ -47,3 +102,145 @@ func (p Generator) GenerateTicket(t service.Ticket, w io.Writer) error {
 
 	return nil
 }
+
+// header draws a band in the primary color with the logo, the cinema name and
+// the ticket and order numbers.
+func (p Generator) header(pdf *gofpdf.Fpdf, t service.Ticket) {
+	pageWidth, _ := pdf.GetPageSize()
+
+	pdf.SetFillColor(p.primary.r, p.primary.g, p.primary.b)
+	pdf.Rect(0, 0, pageWidth, headerHeight, "F")
+
+	x := float64(margin)
+	if p.t.logo != nil {
+		pdf.ImageOptions(logoName, x, (headerHeight-logoSize)/2, logoSize, logoSize, false,
+			gofpdf.ImageOptions{ImageType: p.t.logoType}, 0, "")
+		x += logoSize + 4
+	}
+
+	pdf.SetTextColor(p.headerText.r, p.headerText.g, p.headerText.b)
+	pdf.SetFont(fontFamily, "", 15)
+	pdf.SetXY(x, 5)
+	pdf.CellFormat(pageWidth-x-margin, 8, p.t.CinemaName, "", 0, "L", false, 0, "")
+
+	reference := fmt.Sprintf("%s #%d", p.labels.Ticket, t.Id)
+	if t.OrderId != 0 {
+		reference += fmt.Sprintf("  ·  %s #%d", p.labels.Order, t.OrderId)
+	}
+	pdf.SetFont(fontFamily, "", 9)
+	pdf.SetXY(x, 13)
+	pdf.CellFormat(pageWidth-x-margin, 6, reference, "", 0, "L", false, 0, "")
+}
+
+// details prints the movie title followed by a label and a value per line.
+func (p Generator) details(pdf *gofpdf.Fpdf, t service.Ticket) {
+	pageWidth, _ := pdf.GetPageSize()
+	width := pageWidth - 2*margin
+
+	pdf.SetTextColor(p.text.r, p.text.g, p.text.b)
+	pdf.SetFont(fontFamily, "", titleSize)
+	pdf.SetXY(margin, headerHeight+4)
+	pdf.MultiCell(width, 6, t.MovieName, "", "L", false)
+	pdf.Ln(2)
+
+	hall := t.HallName
+	if hall == "" {
+		hall = strconv.Itoa(t.HallId)
+	}
+
+	price := fmt.Sprintf("%.2f", t.Price)
+	if p.t.Currency != "" {
+		price += " " + p.t.Currency
+	}
+
+	lines := [][2]string{
+		{p.labels.Date, t.Date},
+		{p.labels.Time, t.StartTime},
+		{p.labels.Duration, fmt.Sprintf(p.labels.DurationFormat, t.Duration/60, t.Duration%60)},
+		{p.labels.Hall, hall},
+	}
+
+	row, place := t.Seat()
+	if row != 0 {
+		lines = append(lines, [2]string{p.labels.Row, strconv.Itoa(row)})
+	}
+	lines = append(lines, [2]string{p.labels.Seat, strconv.Itoa(place)}, [2]string{p.labels.Price, price})
+	if t.Purchaser != "" {
+		lines = append(lines, [2]string{p.labels.Purchaser, t.Purchaser})
+	}
+
+	for _, line := range lines {
+		y := pdf.GetY()
+
+		pdf.SetTextColor(p.primary.r, p.primary.g, p.primary.b)
+		pdf.SetFont(fontFamily, "", labelSize)
+		pdf.SetXY(margin, y)
+		pdf.CellFormat(labelWidth, lineHeight, line[0], "", 0, "L", false, 0, "")
+
+		pdf.SetTextColor(p.text.r, p.text.g, p.text.b)
+		fitFont(pdf, line[1], width-labelWidth)
+		pdf.CellFormat(width-labelWidth, lineHeight, line[1], "", 1, "L", false, 0, "")
+	}
+
+	pdf.SetDrawColor(p.primary.r, p.primary.g, p.primary.b)
+	pdf.Line(margin, pdf.GetY()+1, pageWidth-margin, pdf.GetY()+1)
+}
+
+// fitFont picks the largest value font size at which the text fits the width.
+func fitFont(pdf *gofpdf.Fpdf, text string, width float64) {
+	for size := float64(valueSize); ; size-- {
+		pdf.SetFont(fontFamily, "", size)
+		if size <= minValueSize || pdf.GetStringWidth(text) <= width {
+			return
+		}
+	}
+}
+
+func (p Generator) terms(pdf *gofpdf.Fpdf) {
+	if p.t.Terms == "" {
+		return
+	}
+
+	pageWidth, pageHeight := pdf.GetPageSize()
+	pdf.SetTextColor(p.text.r, p.text.g, p.text.b)
+	pdf.SetFont(fontFamily, "", termsSize)
+	pdf.SetXY(margin, pageHeight-margin-termsHeight)
+	pdf.MultiCell(pageWidth-2*margin, 2.6, p.t.Terms, "", "L", false)
+}
+
+// addQRCode draws the signed code of the ticket as a QR code centered between
+// the ticket details and the terms, shrinking it if the details are long. The
+// code is drawn with rectangles rather than embedded as an image, which keeps
+// it sharp and the output reproducible.
+func addQRCode(pdf *gofpdf.Fpdf, t service.Ticket) error {
+	code, err := qr.Encode(t.Code, qr.M, qr.Auto)
+	if err != nil {
+		return err
+	}
+
+	pageWidth, pageHeight := pdf.GetPageSize()
+	top := pdf.GetY() + 3
+	size := pageHeight - margin - termsHeight - 2 - top
+	if size > qrMaxSize {
+		size = qrMaxSize
+	}
+	if size < qrMinSize {
+		size = qrMinSize
+	}
+
+	bounds := code.Bounds()
+	module := size / float64(bounds.Dx())
+	left := (pageWidth - size) / 2
+
+	pdf.SetFillColor(0, 0, 0)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if r, _, _, _ := code.At(x, y).RGBA(); r == 0 {
+				pdf.Rect(left+float64(x-bounds.Min.X)*module, top+float64(y-bounds.Min.Y)*module,
+					module, module, "F")
+			}
+		}
+	}
+
+	return pdf.Error()
+}
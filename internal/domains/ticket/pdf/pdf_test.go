@@ -0,0 +1,134 @@
+package pdfgenerator
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/ticket/service"
+	"bytes"
+	"flag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+var tickets = []service.Ticket{
+	{
+		Id:          1,
+		SessionId:   3,
+		OrderId:     7,
+		MovieName:   "Movie",
+		Date:        "2023-06-01",
+		StartTime:   "18:30",
+		Duration:    135,
+		HallId:      2,
+		HallName:    "Red hall",
+		SeatsPerRow: 10,
+		SeatNumber:  23,
+		Price:       12.5,
+		Purchaser:   "guest@example.com",
+		Code:        "1.3.23.signature",
+	},
+	{
+		Id:         2,
+		SessionId:  3,
+		MovieName:  "Однажды в... Голливуде: очень длинное название фильма, которое не помещается в одну строку",
+		Date:       "2023-06-01",
+		StartTime:  "21:00",
+		Duration:   161,
+		HallId:     4,
+		SeatNumber: 5,
+		Price:      450,
+		Purchaser:  "Анна Каренина-Вронская, очень длинное имя покупателя",
+		Code:       "2.3.5.signature",
+	},
+}
+
+func TestGenerateTickets(t *testing.T) {
+	now = func() time.Time { return time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	defaultTemplate, err := DefaultTemplate()
+	require.NoError(t, err)
+	ruTemplate, err := LoadTemplate(filepath.Join("testdata", "ru"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		template Template
+	}{
+		{name: "default", template: defaultTemplate},
+		{name: "ru", template: ruTemplate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen, err := New(tt.template)
+			require.NoError(t, err)
+
+			var got bytes.Buffer
+			require.NoError(t, gen.GenerateTickets(tickets, &got))
+
+			var again bytes.Buffer
+			require.NoError(t, gen.GenerateTickets(tickets, &again))
+			assert.Equal(t, got.Bytes(), again.Bytes(), "output is not reproducible")
+
+			golden := filepath.Join("testdata", tt.name+".golden.pdf")
+			if *update {
+				require.NoError(t, os.WriteFile(golden, got.Bytes(), 0o644))
+			}
+
+			want, err := os.ReadFile(golden)
+			require.NoError(t, err)
+			assert.True(t, bytes.Equal(want, got.Bytes()), "output differs from %s, run with -update to refresh it", golden)
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	valid, err := DefaultTemplate()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		modify func(*Template)
+		err    error
+	}{
+		{name: "valid", modify: func(*Template) {}},
+		{name: "unknown language", modify: func(t *Template) { t.Language = "xx" }, err: ErrUnknownLanguage},
+		{name: "invalid page size", modify: func(t *Template) { t.PageSize = "A4" }, err: ErrInvalidPageSize},
+		{name: "invalid color", modify: func(t *Template) { t.Colors.Primary = "red" }, err: ErrInvalidColor},
+		{name: "short color", modify: func(t *Template) { t.Colors.Text = "#fff" }, err: ErrInvalidColor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl := valid
+			tt.modify(&tmpl)
+
+			_, err := New(tmpl)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestLoadHallTemplates(t *testing.T) {
+	ru, err := os.ReadFile(filepath.Join("testdata", "ru", "template.json"))
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "3"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "3", "template.json"), ru, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README"), []byte("hall templates"), 0o644))
+
+	templates, err := LoadHallTemplates(dir)
+	require.NoError(t, err)
+	require.Len(t, templates, 1)
+	assert.Equal(t, "ru", templates[3].Language)
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "red"), 0o755))
+	_, err = LoadHallTemplates(dir)
+	assert.ErrorIs(t, err, ErrInvalidHall)
+}
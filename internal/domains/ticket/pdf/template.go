@@ -0,0 +1,197 @@
+package pdfgenerator
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidColor    = errors.New("color must be in the #rrggbb format")
+	ErrUnknownLanguage = errors.New("unknown template language")
+	ErrInvalidPageSize = errors.New("page size must be A5 or A6")
+	ErrInvalidLogo     = errors.New("logo must be a PNG, JPEG or GIF image")
+	ErrInvalidHall     = errors.New("hall template directories must be named after a hall id")
+)
+
+const (
+	templateFile    = "template.json"
+	defaultTemplate = "templates/default"
+	defaultFont     = "fonts/DejaVuSansCondensed.ttf"
+)
+
+//go:embed templates fonts/*.ttf
+var embedded embed.FS
+
+type Colors struct {
+	Primary    string `json:"primary"`
+	Text       string `json:"text"`
+	HeaderText string `json:"headerText"`
+}
+
+// Template describes how tickets of a cinema look. Logo and font paths are
+// relative to the template directory; without a font the embedded DejaVu Sans
+// is used, which covers Latin, Cyrillic and Greek.
+type Template struct {
+	CinemaName string `json:"cinemaName"`
+	Language   string `json:"language"`
+	PageSize   string `json:"pageSize"`
+	LogoPath   string `json:"logo"`
+	FontPath   string `json:"font"`
+	Currency   string `json:"currency"`
+	Colors     Colors `json:"colors"`
+	Terms      string `json:"terms"`
+
+	logo     []byte
+	logoType string
+	font     []byte
+}
+
+// DefaultTemplate returns the template built into the service.
+func DefaultTemplate() (Template, error) {
+	return loadTemplate(embedded, defaultTemplate)
+}
+
+// LoadTemplate reads template.json and the files it refers to from dir.
+func LoadTemplate(dir string) (Template, error) {
+	return loadTemplate(os.DirFS(dir), ".")
+}
+
+// LoadHallTemplates reads a template from every subdirectory of dir, keyed by
+// the hall id the subdirectory is named after.
+func LoadHallTemplates(dir string) (map[int]Template, error) {
+	fsys := os.DirFS(dir)
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hall templates: %w", err)
+	}
+
+	templates := make(map[int]Template)
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+
+		hallId, err := strconv.Atoi(e.Name())
+		if err != nil || hallId <= 0 {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidHall, e.Name())
+		}
+
+		if templates[hallId], err = loadTemplate(fsys, e.Name()); err != nil {
+			return nil, fmt.Errorf("hall %d: %w", hallId, err)
+		}
+	}
+
+	return templates, nil
+}
+
+func loadTemplate(fsys fs.FS, dir string) (Template, error) {
+	data, err := fs.ReadFile(fsys, path.Join(dir, templateFile))
+	if err != nil {
+		return Template{}, fmt.Errorf("failed to read ticket template: %w", err)
+	}
+
+	var t Template
+	if err = json.Unmarshal(data, &t); err != nil {
+		return Template{}, fmt.Errorf("failed to parse ticket template: %w", err)
+	}
+
+	if t.LogoPath != "" {
+		if t.logo, err = fs.ReadFile(fsys, path.Join(dir, t.LogoPath)); err != nil {
+			return Template{}, fmt.Errorf("failed to read logo: %w", err)
+		}
+		if t.logoType, err = imageType(t.LogoPath); err != nil {
+			return Template{}, err
+		}
+	}
+
+	if t.FontPath != "" {
+		t.font, err = fs.ReadFile(fsys, path.Join(dir, t.FontPath))
+	} else {
+		t.font, err = embedded.ReadFile(defaultFont)
+	}
+	if err != nil {
+		return Template{}, fmt.Errorf("failed to read font: %w", err)
+	}
+
+	return t, nil
+}
+
+func imageType(name string) (string, error) {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".png":
+		return "PNG", nil
+	case ".jpg", ".jpeg":
+		return "JPG", nil
+	case ".gif":
+		return "GIF", nil
+	default:
+		return "", ErrInvalidLogo
+	}
+}
+
+type rgb struct {
+	r, g, b int
+}
+
+func parseColor(s string) (rgb, error) {
+	if len(s) != 7 || s[0] != '#' {
+		return rgb{}, ErrInvalidColor
+	}
+
+	v, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return rgb{}, ErrInvalidColor
+	}
+	return rgb{r: int(v >> 16), g: int(v >> 8 & 0xff), b: int(v & 0xff)}, nil
+}
+
+type labels struct {
+	Ticket    string
+	Order     string
+	Date      string
+	Time      string
+	Duration  string
+	Hall      string
+	Row       string
+	Seat      string
+	Price     string
+	Purchaser string
+	// DurationFormat formats hours and minutes.
+	DurationFormat string
+}
+
+var translations = map[string]labels{
+	"en": {
+		Ticket:         "Ticket",
+		Order:          "Order",
+		Date:           "Date",
+		Time:           "Time",
+		Duration:       "Duration",
+		Hall:           "Hall",
+		Row:            "Row",
+		Seat:           "Seat",
+		Price:          "Price",
+		Purchaser:      "Purchaser",
+		DurationFormat: "%d h %02d min",
+	},
+	"ru": {
+		Ticket:         "Билет",
+		Order:          "Заказ",
+		Date:           "Дата",
+		Time:           "Время",
+		Duration:       "Длительность",
+		Hall:           "Зал",
+		Row:            "Ряд",
+		Seat:           "Место",
+		Price:          "Цена",
+		Purchaser:      "Покупатель",
+		DurationFormat: "%d ч %02d мин",
+	},
+}
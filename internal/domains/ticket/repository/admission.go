@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/ticket/service"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+func (t TicketRepository) AdmitTicket(ticketId, sessionId, seatNum int, startsFrom,
+	startsTo time.Time) (service.TicketDetails, error) {
+	tx, err := t.db.Begin()
+	if err != nil {
+		return service.TicketDetails{}, fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Println(err)
+		}
+	}()
+
+	var (
+		ticket     service.TicketDetails
+		admittedAt sql.NullTime
+	)
+	err = tx.QueryRow(ticketDetailsQuery+`, t.admitted_at
+						FROM tickets t
+						JOIN cinema_sessions s ON s.session_id = t.session_id
+						JOIN movies m ON m.movie_id = s.movie_id
+						JOIN halls h ON h.hall_id = s.hall_id
+						WHERE t.ticket_id = $1 AND t.session_id = $2 AND t.seat_number = $3
+						FOR UPDATE OF t`, ticketId, sessionId, seatNum).
+		Scan(&ticket.Id, &ticket.UserId, &ticket.SessionId, &ticket.MovieTitle, &ticket.HallName, &ticket.StartTime,
+			&ticket.SeatNumber, &ticket.Price, &ticket.Status, &admittedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return service.TicketDetails{}, service.ErrTicketNotFound
+	}
+	if err != nil {
+		return service.TicketDetails{}, fmt.Errorf("failed to get ticket: %w", err)
+	}
+
+	if ticket.Status == service.StatusCancelled {
+		return service.TicketDetails{}, service.ErrTicketCancelled
+	}
+	if admittedAt.Valid {
+		return service.TicketDetails{}, service.ErrTicketAdmitted
+	}
+	if ticket.StartTime.Before(startsFrom) || ticket.StartTime.After(startsTo) {
+		return service.TicketDetails{}, service.ErrAdmissionClosed
+	}
+
+	if _, err = tx.Exec("UPDATE tickets SET admitted_at = now() WHERE ticket_id = $1", ticketId); err != nil {
+		return service.TicketDetails{}, fmt.Errorf("failed to admit ticket: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return service.TicketDetails{}, fmt.Errorf("failed to admit ticket: %w", err)
+	}
+
+	return ticket, nil
+}
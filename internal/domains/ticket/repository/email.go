@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/ticket/service"
+	"fmt"
+	"github.com/lib/pq"
+	"time"
+)
+
+// QueueTicketEmail queues the tickets stored under the key for delivery to the
+// email of their owner: the checkout email of a guest or the verified email of
+// an account. Owners without such an email get nothing.
+func (t TicketRepository) QueueTicketEmail(key string) error {
+	_, err := t.db.Exec(`INSERT INTO ticket_emails (pdf_key, recipient)
+						SELECT DISTINCT t.pdf_key, COALESCE(g.email, u.email)
+						FROM tickets t
+						JOIN users u ON u.user_id = t.user_id
+						LEFT JOIN guest_checkouts g ON g.user_id = u.user_id
+						WHERE t.pdf_key = $1
+						AND (g.email IS NOT NULL OR u.email IS NOT NULL AND u.email_verified)`, key)
+	if err != nil {
+		return fmt.Errorf("failed to queue ticket email: %w", err)
+	}
+	return nil
+}
+
+func (t TicketRepository) PendingTicketEmails(now, leaseUntil time.Time, limit int) ([]service.TicketEmail, error) {
+	rows, err := t.db.Query(`WITH e AS (
+							UPDATE ticket_emails SET next_attempt_at = $3
+							WHERE email_id IN (
+								SELECT email_id FROM ticket_emails
+								WHERE status = $1 AND next_attempt_at <= $2
+								ORDER BY email_id
+								LIMIT $4
+								FOR UPDATE SKIP LOCKED)
+							RETURNING email_id, recipient, pdf_key, status, attempts)
+						SELECT e.email_id, e.recipient, e.pdf_key, e.status, e.attempts, s.session_id, m.title,
+							h.hall_name, s.start_time, s.end_time, array_agg(t.seat_number ORDER BY t.seat_number)
+						FROM e
+						JOIN tickets t ON t.pdf_key = e.pdf_key
+						JOIN cinema_sessions s ON s.session_id = t.session_id
+						JOIN movies m ON m.movie_id = s.movie_id
+						JOIN halls h ON h.hall_id = s.hall_id
+						GROUP BY e.email_id, e.recipient, e.pdf_key, e.status, e.attempts, s.session_id, m.movie_id,
+							h.hall_id
+						ORDER BY e.email_id`, service.EmailPending, now, leaseUntil, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending ticket emails: %w", err)
+	}
+	defer rows.Close()
+
+	var emails []service.TicketEmail
+	for rows.Next() {
+		var (
+			e     service.TicketEmail
+			seats []int64
+		)
+		err = rows.Scan(&e.Id, &e.To, &e.FileKey, &e.Status, &e.Attempts, &e.SessionId, &e.MovieTitle, &e.HallName,
+			&e.StartTime, &e.EndTime, pq.Array(&seats))
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan ticket email: %w", err)
+		}
+
+		for _, seat := range seats {
+			e.Seats = append(e.Seats, int(seat))
+		}
+		emails = append(emails, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get pending ticket emails: %w", err)
+	}
+
+	return emails, nil
+}
+
+func (t TicketRepository) UpdateTicketEmail(e service.TicketEmail) error {
+	_, err := t.db.Exec(`UPDATE ticket_emails
+						SET status = $2, attempts = $3, next_attempt_at = $4, failure = LEFT(NULLIF($5, ''), 255),
+							sent_at = CASE WHEN $2 = 'sent' THEN now() END
+						WHERE email_id = $1`, e.Id, e.Status, e.Attempts, e.NextAttempt, e.Failure)
+	if err != nil {
+		return fmt.Errorf("failed to update ticket email: %w", err)
+	}
+	return nil
+}
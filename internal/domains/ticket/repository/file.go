@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/ticket/service"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+)
+
+func (t TicketRepository) SetTicketFile(ticketIds []int, key string) error {
+	_, err := t.db.Exec("UPDATE tickets SET pdf_key = $2 WHERE ticket_id = ANY($1)", pq.Array(ticketIds), key)
+	if err != nil {
+		return fmt.Errorf("failed to save ticket file: %w", err)
+	}
+	return nil
+}
+
+func (t TicketRepository) TicketFile(ticketId, userId int) (string, error) {
+	var (
+		key    sql.NullString
+		status string
+	)
+	err := t.db.QueryRow(`SELECT pdf_key, status FROM tickets
+						WHERE ticket_id = $1 AND ($2 = 0 OR user_id = $2)`, ticketId, userId).Scan(&key, &status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", service.ErrTicketNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get ticket file: %w", err)
+	}
+
+	if status == service.StatusCancelled {
+		return "", service.ErrTicketCancelled
+	}
+	if !key.Valid {
+		return "", service.ErrTicketFileNotFound
+	}
+
+	return key.String, nil
+}
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/ticket/service"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+)
+
+func (t TicketRepository) CreateGuestTicket(email, lookupCodeHash, passwordHash string,
+	sessionId, seatNum int) (service.Ticket, error) {
+	tx, err := t.db.Begin()
+	if err != nil {
+		return service.Ticket{}, fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Println(err)
+		}
+	}()
+
+	var guestId int
+	err = tx.QueryRow(`INSERT INTO users (username, hashed_password, disabled_at)
+						VALUES ('guest', $1, now()) RETURNING user_id`, passwordHash).Scan(&guestId)
+	if err != nil {
+		return service.Ticket{}, fmt.Errorf("failed to create guest user: %w", err)
+	}
+
+	_, err = tx.Exec("UPDATE users SET username = 'guest-' || user_id WHERE user_id = $1", guestId)
+	if err != nil {
+		return service.Ticket{}, fmt.Errorf("failed to create guest user: %w", err)
+	}
+
+	_, err = tx.Exec("INSERT INTO guest_checkouts (user_id, email, lookup_code_hash) VALUES ($1, $2, $3)",
+		guestId, email, lookupCodeHash)
+	if err != nil {
+		return service.Ticket{}, fmt.Errorf("failed to create guest checkout: %w", err)
+	}
+
+	created, err := insertTicket(tx, sessionId, guestId, seatNum)
+	if err != nil {
+		return service.Ticket{}, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return service.Ticket{}, fmt.Errorf("failed to create guest ticket: %w", err)
+	}
+
+	return created, nil
+}
+
+func (t TicketRepository) GuestTickets(lookupCodeHash string) ([]service.GuestTicket, bool, error) {
+	var guestId int
+	err := t.db.QueryRow("SELECT user_id FROM guest_checkouts WHERE lookup_code_hash = $1", lookupCodeHash).
+		Scan(&guestId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get guest checkout: %w", err)
+	}
+
+	rows, err := t.db.Query(`SELECT t.ticket_id, s.hall_id, t.seat_number, m.duration, m.title, s.start_time,
+							COALESCE(t.price, s.price), CASE WHEN t.status <> $2 THEN COALESCE(t.pdf_key, '') ELSE '' END
+						FROM tickets t
+						JOIN cinema_sessions s ON s.session_id = t.session_id
+						JOIN movies m ON m.movie_id = s.movie_id
+						WHERE t.user_id = $1
+						ORDER BY s.start_time, t.ticket_id`, guestId, service.StatusCancelled)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get guest tickets: %w", err)
+	}
+	defer rows.Close()
+
+	tickets := make([]service.GuestTicket, 0)
+	for rows.Next() {
+		var (
+			tk   ticket
+			seat int
+			key  string
+		)
+		err = rows.Scan(&tk.Id, &tk.HallId, &seat, &tk.Duration, &tk.MovieName, &tk.StartTime, &tk.Price, &key)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to scan guest ticket: %w", err)
+		}
+		guestTicket := service.NewTicketEntity(tk.Id, tk.HallId, seat, tk.Duration, tk.MovieName, tk.StartTime)
+		guestTicket.Price = tk.Price
+		tickets = append(tickets, service.GuestTicket{Ticket: guestTicket, FileKey: key})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("failed to get guest tickets: %w", err)
+	}
+
+	return tickets, true, nil
+}
+
+func (t TicketRepository) ClaimGuestTickets(lookupCodeHash string, userId int) (int, bool, error) {
+	tx, err := t.db.Begin()
+	if err != nil {
+		return 0, false, fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Println(err)
+		}
+	}()
+
+	var guestId int
+	err = tx.QueryRow("SELECT user_id FROM guest_checkouts WHERE lookup_code_hash = $1 FOR UPDATE",
+		lookupCodeHash).Scan(&guestId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get guest checkout: %w", err)
+	}
+
+	if _, err = tx.Exec("UPDATE orders SET user_id = $1 WHERE user_id = $2", userId, guestId); err != nil {
+		return 0, false, fmt.Errorf("failed to claim orders: %w", err)
+	}
+
+	res, err := tx.Exec("UPDATE tickets SET user_id = $1 WHERE user_id = $2", userId, guestId)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to claim tickets: %w", err)
+	}
+
+	claimed, err := res.RowsAffected()
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to claim tickets: %w", err)
+	}
+
+	if _, err = tx.Exec("UPDATE refunds SET user_id = $1 WHERE user_id = $2", userId, guestId); err != nil {
+		return 0, false, fmt.Errorf("failed to claim refunds: %w", err)
+	}
+
+	if _, err = tx.Exec("DELETE FROM users WHERE user_id = $1", guestId); err != nil {
+		return 0, false, fmt.Errorf("failed to delete guest user: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, false, fmt.Errorf("failed to claim tickets: %w", err)
+	}
+
+	return int(claimed), true, nil
+}
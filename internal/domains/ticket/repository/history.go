@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/ticket/service"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const ticketDetailsQuery = `SELECT t.ticket_id, t.user_id, t.session_id, m.title, h.hall_name, s.start_time,
+							t.seat_number, COALESCE(t.price, s.price), t.status`
+
+// userTicketsFilter selects the tickets of user $1 in period $2 relative to $3.
+const userTicketsFilter = `
+						FROM tickets t
+						JOIN cinema_sessions s ON s.session_id = t.session_id
+						JOIN movies m ON m.movie_id = s.movie_id
+						JOIN halls h ON h.hall_id = s.hall_id
+						WHERE t.user_id = $1
+						AND ($2 = '' OR ($2 = 'upcoming' AND s.start_time > $3) OR ($2 = 'past' AND s.start_time <= $3))`
+
+func (t TicketRepository) UserTickets(filter service.TicketFilter, now time.Time) ([]service.TicketDetails, int,
+	error) {
+	// The total is counted separately, since a page past the end has no rows
+	// to carry it.
+	var total int
+	err := t.db.QueryRow("SELECT COUNT(*)"+userTicketsFilter, filter.UserId, filter.Period, now).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count user tickets: %w", err)
+	}
+
+	rows, err := t.db.Query(ticketDetailsQuery+userTicketsFilter+`
+						ORDER BY CASE WHEN $2 = 'upcoming' THEN s.start_time END, s.start_time DESC, t.ticket_id
+						OFFSET $4
+						LIMIT $5`, filter.UserId, filter.Period, now, filter.Offset, filter.Limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get user tickets: %w", err)
+	}
+	defer rows.Close()
+
+	var tickets []service.TicketDetails
+	for rows.Next() {
+		var ticket service.TicketDetails
+		err = rows.Scan(&ticket.Id, &ticket.UserId, &ticket.SessionId, &ticket.MovieTitle, &ticket.HallName,
+			&ticket.StartTime, &ticket.SeatNumber, &ticket.Price, &ticket.Status)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan ticket: %w", err)
+		}
+		tickets = append(tickets, ticket)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to get user tickets: %w", err)
+	}
+
+	return tickets, total, nil
+}
+
+func (t TicketRepository) TicketDetails(ticketId, userId int) (service.TicketDetails, error) {
+	var ticket service.TicketDetails
+	err := t.db.QueryRow(ticketDetailsQuery+`
+						FROM tickets t
+						JOIN cinema_sessions s ON s.session_id = t.session_id
+						JOIN movies m ON m.movie_id = s.movie_id
+						JOIN halls h ON h.hall_id = s.hall_id
+						WHERE t.ticket_id = $1 AND ($2 = 0 OR t.user_id = $2)`, ticketId, userId).
+		Scan(&ticket.Id, &ticket.UserId, &ticket.SessionId, &ticket.MovieTitle, &ticket.HallName, &ticket.StartTime,
+			&ticket.SeatNumber, &ticket.Price, &ticket.Status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return service.TicketDetails{}, service.ErrTicketNotFound
+	}
+	if err != nil {
+		return service.TicketDetails{}, fmt.Errorf("failed to get ticket: %w", err)
+	}
+
+	return ticket, nil
+}
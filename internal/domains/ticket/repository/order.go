@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/ticket/service"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+)
+
+func (t TicketRepository) CreateOrder(sessionId, userId int, seats []int) (service.Order, error) {
+	tx, err := t.db.Begin()
+	if err != nil {
+		return service.Order{}, fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Println(err)
+		}
+	}()
+
+	session, err := sessionForSale(tx, sessionId)
+	if err != nil {
+		return service.Order{}, err
+	}
+
+	if session.Purchaser, err = purchaser(tx, userId); err != nil {
+		return service.Order{}, err
+	}
+
+	order := service.Order{SessionId: sessionId, UserId: userId}
+	err = tx.QueryRow("INSERT INTO orders (user_id, session_id) VALUES ($1, $2) RETURNING order_id",
+		userId, sessionId).Scan(&order.Id)
+	if err != nil {
+		return service.Order{}, fmt.Errorf("failed to create order: %w", err)
+	}
+
+	orderId := sql.NullInt64{Int64: int64(order.Id), Valid: true}
+	for _, seat := range seats {
+		created, err := sellSeat(tx, session, sessionId, userId, seat, orderId)
+		if err != nil {
+			return service.Order{}, err
+		}
+		order.Tickets = append(order.Tickets, created)
+	}
+
+	err = tx.QueryRow(`UPDATE orders SET total_price = (SELECT SUM(price) FROM tickets WHERE order_id = $1)
+						WHERE order_id = $1 RETURNING total_price`, order.Id).Scan(&order.TotalPrice)
+	if err != nil {
+		return service.Order{}, fmt.Errorf("failed to calculate order total: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return service.Order{}, fmt.Errorf("failed to create order: %w", err)
+	}
+
+	return order, nil
+}
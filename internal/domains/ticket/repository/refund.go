@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/ticket/service"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+func (t TicketRepository) CancelTicket(ticketId, userId int, startsAfter time.Time) (service.Refund, error) {
+	tx, err := t.db.Begin()
+	if err != nil {
+		return service.Refund{}, fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Println(err)
+		}
+	}()
+
+	var (
+		ownerId   int
+		status    string
+		startTime time.Time
+		amount    float64
+	)
+	err = tx.QueryRow(`SELECT t.user_id, t.status, s.start_time, COALESCE(t.price, s.price)
+						FROM tickets t
+						JOIN cinema_sessions s ON s.session_id = t.session_id
+						WHERE t.ticket_id = $1 AND ($2 = 0 OR t.user_id = $2)
+						FOR UPDATE OF t`, ticketId, userId).Scan(&ownerId, &status, &startTime, &amount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return service.Refund{}, service.ErrTicketNotFound
+	}
+	if err != nil {
+		return service.Refund{}, fmt.Errorf("failed to get ticket: %w", err)
+	}
+
+	if status == service.StatusCancelled {
+		return service.Refund{}, service.ErrTicketCancelled
+	}
+	if !startTime.After(startsAfter) {
+		return service.Refund{}, service.ErrCancellationClosed
+	}
+
+	_, err = tx.Exec("UPDATE tickets SET status = $1, cancelled_at = now() WHERE ticket_id = $2",
+		service.StatusCancelled, ticketId)
+	if err != nil {
+		return service.Refund{}, fmt.Errorf("failed to cancel ticket: %w", err)
+	}
+
+	reason := "cancelled by customer"
+	if userId == service.AnyUser {
+		reason = "cancelled by staff"
+	}
+
+	refund := service.Refund{TicketId: ticketId, UserId: ownerId, Amount: amount, Status: service.RefundPending}
+	err = tx.QueryRow(`INSERT INTO refunds (ticket_id, user_id, amount, reason)
+						VALUES ($1, $2, $3, $4) RETURNING refund_id`,
+		ticketId, ownerId, amount, reason).Scan(&refund.Id)
+	if err != nil {
+		return service.Refund{}, fmt.Errorf("failed to create refund: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return service.Refund{}, fmt.Errorf("failed to cancel ticket: %w", err)
+	}
+
+	return refund, nil
+}
+
+func (t TicketRepository) PendingRefunds(now, leaseUntil time.Time, limit int) ([]service.Refund, error) {
+	rows, err := t.db.Query(`UPDATE refunds SET next_attempt_at = $3
+						WHERE refund_id IN (
+							SELECT refund_id FROM refunds
+							WHERE status = $1 AND next_attempt_at <= $2
+							ORDER BY refund_id
+							LIMIT $4
+							FOR UPDATE SKIP LOCKED)
+						RETURNING refund_id, COALESCE(ticket_id, 0), user_id, amount, status, attempts`,
+		service.RefundPending, now, leaseUntil, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending refunds: %w", err)
+	}
+	defer rows.Close()
+
+	var refunds []service.Refund
+	for rows.Next() {
+		var r service.Refund
+		if err = rows.Scan(&r.Id, &r.TicketId, &r.UserId, &r.Amount, &r.Status, &r.Attempts); err != nil {
+			return nil, fmt.Errorf("failed to scan refund: %w", err)
+		}
+		refunds = append(refunds, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get pending refunds: %w", err)
+	}
+
+	return refunds, nil
+}
+
+func (t TicketRepository) UpdateRefund(refund service.Refund) error {
+	_, err := t.db.Exec(`UPDATE refunds
+						SET status = $2, provider_ref = NULLIF($3, ''), failure = LEFT(NULLIF($4, ''), 255),
+							attempts = $5, next_attempt_at = CASE WHEN $2 = 'pending' THEN $6 ELSE next_attempt_at END,
+							updated_at = now()
+						WHERE refund_id = $1`, refund.Id, refund.Status, refund.ProviderRef, refund.Failure,
+		refund.Attempts, refund.NextAttempt)
+	if err != nil {
+		return fmt.Errorf("failed to update refund: %w", err)
+	}
+	return nil
+}
@@ -3,17 +3,24 @@ package repository
 import (
 	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/ticket/service"
 	"database/sql"
+	"errors"
 	"fmt"
+	"github.com/lib/pq"
 	"log"
 	"time"
 )
 
 type ticket struct {
-	Id        int
-	MovieName string
-	StartTime time.Time
-	Duration  int
-	HallId    int
+	Id          int
+	MovieName   string
+	StartTime   time.Time
+	Duration    int
+	HallId      int
+	HallName    string
+	SeatsPerRow int
+	Capacity    int
+	Price       float64
+	Purchaser   string
 }
 
 type TicketRepository struct {
@@ -25,59 +32,120 @@ func New(db *sql.DB) TicketRepository {
 }
 
 func (t TicketRepository) CreateTicket(sessionId, userId, seatNum int) (service.Ticket, error) {
-	sessionTicket, err := t.sessionInfo(sessionId)
+	tx, err := t.db.Begin()
 	if err != nil {
-		return service.Ticket{}, err
+		return service.Ticket{}, fmt.Errorf("could not begin transaction: %w", err)
 	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Println(err)
+		}
+	}()
 
-	var id int
-	err = t.db.QueryRow(`INSERT INTO tickets (session_id, user_id, seat_number) 
-				VALUES ($1, $2, $3) RETURNING ticket_id`, sessionId, userId, seatNum).Scan(&id)
-
+	created, err := insertTicket(tx, sessionId, userId, seatNum)
 	if err != nil {
-		log.Println(err)
 		return service.Ticket{}, err
 	}
 
-	return service.NewTicketEntity(id, sessionTicket.HallId, seatNum,
-		sessionTicket.Duration, sessionTicket.MovieName, sessionTicket.StartTime), nil
+	if err = tx.Commit(); err != nil {
+		return service.Ticket{}, fmt.Errorf("failed to create ticket: %w", err)
+	}
+
+	return created, nil
 }
 
-func (t TicketRepository) SessionExists(id int) (bool, error) {
-	var count int
-	err := t.db.QueryRow("SELECT COUNT(*) FROM cinema_sessions WHERE session_id = $1", id).Scan(&count)
+func insertTicket(tx *sql.Tx, sessionId, userId, seatNum int) (service.Ticket, error) {
+	session, err := sessionForSale(tx, sessionId)
 	if err != nil {
-		log.Println(err)
-		return false, fmt.Errorf("failed to check if session exists %w", err)
+		return service.Ticket{}, err
 	}
 
-	return count > 0, nil
+	if session.Purchaser, err = purchaser(tx, userId); err != nil {
+		return service.Ticket{}, err
+	}
+
+	return sellSeat(tx, session, sessionId, userId, seatNum, sql.NullInt64{})
 }
 
-func (t TicketRepository) sessionInfo(sessionId int) (ticket, error) {
-	var sessionTicket ticket
-	err := t.db.QueryRow(`
-		SELECT m.title, s.start_time, m.duration, s.hall_id
+func sessionForSale(tx *sql.Tx, sessionId int) (ticket, error) {
+	var session ticket
+	err := tx.QueryRow(`
+		SELECT m.title, s.start_time, m.duration, s.hall_id, h.hall_name, h.seats_per_row, h.capacity, s.price
 		FROM cinema_sessions s
 		JOIN movies m ON s.movie_id = m.movie_id
-		WHERE s.session_id = $1`, sessionId).Scan(&sessionTicket.MovieName,
-		&sessionTicket.StartTime, &sessionTicket.Duration, &sessionTicket.HallId)
+		JOIN halls h ON s.hall_id = h.hall_id
+		WHERE s.session_id = $1 AND s.cancelled_at IS NULL`, sessionId).Scan(&session.MovieName,
+		&session.StartTime, &session.Duration, &session.HallId, &session.HallName, &session.SeatsPerRow,
+		&session.Capacity, &session.Price)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ticket{}, service.ErrCinemaSessionsNotFound
+	}
 	if err != nil {
-		log.Println(err)
-		return ticket{}, err
+		return ticket{}, fmt.Errorf("failed to get session info: %w", err)
 	}
-	return sessionTicket, nil
+
+	return session, nil
 }
 
-func (t TicketRepository) TicketExists(sessionId, seatNum int) (bool, error) {
-	var count int
-	err := t.db.QueryRow(`SELECT COUNT(*) 
-				FROM tickets 
-				WHERE session_id = $1 AND seat_number = $2`, sessionId, seatNum).Scan(&count)
+// purchaser returns the name printed on tickets of the user: the email of a
+// guest, otherwise the display name or username.
+func purchaser(tx *sql.Tx, userId int) (string, error) {
+	var name string
+	err := tx.QueryRow(`SELECT COALESCE(g.email, NULLIF(u.display_name, ''), u.username)
+				FROM users u
+				LEFT JOIN guest_checkouts g ON g.user_id = u.user_id
+				WHERE u.user_id = $1`, userId).Scan(&name)
+	if err != nil {
+		return "", fmt.Errorf("failed to get purchaser: %w", err)
+	}
+	return name, nil
+}
+
+// sellSeat checks the seat against the hall of the session and inserts the
+// ticket, turning the buyer's hold on the seat into the sale. A seat sold
+// concurrently is reported by the unique index on (session_id, seat_number)
+// as ErrTicketExists.
+func sellSeat(tx *sql.Tx, session ticket, sessionId, userId, seatNum int, orderId sql.NullInt64) (service.Ticket,
+	error) {
+	if seatNum < 1 || seatNum > session.Capacity {
+		return service.Ticket{}, service.ErrInvalidSeat
+	}
+
+	var holder int
+	err := tx.QueryRow(`SELECT user_id FROM seat_holds
+				WHERE session_id = $1 AND seat_number = $2 AND expires_at > now()
+				FOR UPDATE`, sessionId, seatNum).Scan(&holder)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return service.Ticket{}, fmt.Errorf("failed to check seat hold: %w", err)
+	}
+	if err == nil && holder != userId {
+		return service.Ticket{}, service.ErrSeatHeld
+	}
+
+	var id int
+	err = tx.QueryRow(`INSERT INTO tickets (session_id, user_id, seat_number, order_id, price)
+				VALUES ($1, $2, $3, $4, $5) RETURNING ticket_id`, sessionId, userId, seatNum, orderId,
+		session.Price).Scan(&id)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return service.Ticket{}, service.ErrTicketExists
+	}
+	if err != nil {
+		return service.Ticket{}, fmt.Errorf("failed to create ticket: %w", err)
+	}
+
+	_, err = tx.Exec("DELETE FROM seat_holds WHERE session_id = $1 AND seat_number = $2", sessionId, seatNum)
 	if err != nil {
-		log.Println(err)
-		return false, fmt.Errorf("failed to check if ticket exists %w", err)
+		return service.Ticket{}, fmt.Errorf("failed to release seat hold: %w", err)
 	}
 
-	return count > 0, nil
+	t := service.NewTicketEntity(id, session.HallId, seatNum, session.Duration, session.MovieName,
+		session.StartTime)
+	t.SessionId = sessionId
+	t.OrderId = int(orderId.Int64)
+	t.HallName = session.HallName
+	t.SeatsPerRow = session.SeatsPerRow
+	t.Price = session.Price
+	t.Purchaser = session.Purchaser
+	return t, nil
 }
@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/ticket/service"
+	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testDB connects to the database at DATABASE_URL, which must be created from
+// database/cinemadb.sql. The tests are skipped without it.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	url := os.Getenv("DATABASE_URL")
+	if url == "" {
+		t.Skip("DATABASE_URL is not set")
+	}
+
+	db, err := sql.Open("postgres", url)
+	require.NoError(t, err)
+	require.NoError(t, db.Ping())
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestCreateTicketConcurrently(t *testing.T) {
+	const buyers = 20
+
+	db := testDB(t)
+	repo := New(db)
+
+	var movieId, hallId, sessionId int
+	err := db.QueryRow(`INSERT INTO movies (title, genre, release_date, duration)
+						VALUES ('Test movie', 'drama', '2023-01-01', 120) RETURNING movie_id`).Scan(&movieId)
+	require.NoError(t, err)
+	err = db.QueryRow("INSERT INTO halls (hall_name, capacity) VALUES ('Test hall', 10) RETURNING hall_id").
+		Scan(&hallId)
+	require.NoError(t, err)
+	start := time.Now().Add(24 * time.Hour)
+	err = db.QueryRow(`INSERT INTO cinema_sessions (movie_id, hall_id, start_time, end_time, price)
+						VALUES ($1, $2, $3, $4, 10) RETURNING session_id`,
+		movieId, hallId, start, start.Add(2*time.Hour)).Scan(&sessionId)
+	require.NoError(t, err)
+
+	users := make([]int, buyers)
+	for i := range users {
+		err = db.QueryRow("INSERT INTO users (username, hashed_password) VALUES ($1, 'hash') RETURNING user_id",
+			fmt.Sprintf("test-%d-%d", time.Now().UnixNano(), i)).Scan(&users[i])
+		require.NoError(t, err)
+	}
+
+	defer func() {
+		_, err := db.Exec("DELETE FROM tickets WHERE session_id = $1", sessionId)
+		assert.NoError(t, err)
+		_, err = db.Exec("DELETE FROM users WHERE user_id = ANY($1)", pq.Array(users))
+		assert.NoError(t, err)
+		_, err = db.Exec("DELETE FROM movies WHERE movie_id = $1", movieId)
+		assert.NoError(t, err)
+		_, err = db.Exec("DELETE FROM halls WHERE hall_id = $1", hallId)
+		assert.NoError(t, err)
+	}()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, buyers)
+	for _, userId := range users {
+		wg.Add(1)
+		go func(userId int) {
+			defer wg.Done()
+			_, err := repo.CreateTicket(sessionId, userId, 5)
+			errs <- err
+		}(userId)
+	}
+	wg.Wait()
+	close(errs)
+
+	sold := 0
+	for err := range errs {
+		if err == nil {
+			sold++
+			continue
+		}
+		assert.ErrorIs(t, err, service.ErrTicketExists)
+	}
+	assert.Equal(t, 1, sold)
+
+	var tickets int
+	err = db.QueryRow("SELECT COUNT(*) FROM tickets WHERE session_id = $1 AND seat_number = 5", sessionId).
+		Scan(&tickets)
+	require.NoError(t, err)
+	assert.Equal(t, 1, tickets)
+}
+
+func TestClaimGuestTicketsWithRefund(t *testing.T) {
+	db := testDB(t)
+	repo := New(db)
+
+	var movieId, hallId, sessionId, userId, guestId int
+	err := db.QueryRow(`INSERT INTO movies (title, genre, release_date, duration)
+						VALUES ('Test movie', 'drama', '2023-01-01', 120) RETURNING movie_id`).Scan(&movieId)
+	require.NoError(t, err)
+	err = db.QueryRow("INSERT INTO halls (hall_name, capacity) VALUES ('Test hall', 10) RETURNING hall_id").
+		Scan(&hallId)
+	require.NoError(t, err)
+	start := time.Now().Add(24 * time.Hour)
+	err = db.QueryRow(`INSERT INTO cinema_sessions (movie_id, hall_id, start_time, end_time, price)
+						VALUES ($1, $2, $3, $4, 10) RETURNING session_id`,
+		movieId, hallId, start, start.Add(2*time.Hour)).Scan(&sessionId)
+	require.NoError(t, err)
+	err = db.QueryRow("INSERT INTO users (username, hashed_password) VALUES ($1, 'hash') RETURNING user_id",
+		fmt.Sprintf("test-%d", time.Now().UnixNano())).Scan(&userId)
+	require.NoError(t, err)
+
+	defer func() {
+		_, err := db.Exec("DELETE FROM refunds WHERE user_id = ANY($1)", pq.Array([]int{userId, guestId}))
+		assert.NoError(t, err)
+		_, err = db.Exec("DELETE FROM tickets WHERE session_id = $1", sessionId)
+		assert.NoError(t, err)
+		_, err = db.Exec("DELETE FROM users WHERE user_id = ANY($1)", pq.Array([]int{userId, guestId}))
+		assert.NoError(t, err)
+		_, err = db.Exec("DELETE FROM movies WHERE movie_id = $1", movieId)
+		assert.NoError(t, err)
+		_, err = db.Exec("DELETE FROM halls WHERE hall_id = $1", hallId)
+		assert.NoError(t, err)
+	}()
+
+	codeHash := fmt.Sprintf("claim-%d", time.Now().UnixNano())
+	ticket, err := repo.CreateGuestTicket("guest@example.com", codeHash, "hash", sessionId, 1)
+	require.NoError(t, err)
+
+	err = db.QueryRow("SELECT user_id FROM tickets WHERE ticket_id = $1", ticket.Id).Scan(&guestId)
+	require.NoError(t, err)
+
+	refund, err := repo.CancelTicket(ticket.Id, guestId, time.Now())
+	require.NoError(t, err)
+
+	claimed, found, err := repo.ClaimGuestTickets(codeHash, userId)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, 1, claimed)
+
+	var owner int
+	err = db.QueryRow("SELECT user_id FROM refunds WHERE refund_id = $1", refund.Id).Scan(&owner)
+	require.NoError(t, err)
+	assert.Equal(t, userId, owner)
+
+	var status string
+	err = db.QueryRow("SELECT status FROM tickets WHERE ticket_id = $1", ticket.Id).Scan(&status)
+	require.NoError(t, err)
+	assert.Equal(t, service.StatusCancelled, status)
+}
+
+func TestUserTicketsPastTheEnd(t *testing.T) {
+	db := testDB(t)
+	repo := New(db)
+
+	var movieId, hallId, sessionId, userId int
+	err := db.QueryRow(`INSERT INTO movies (title, genre, release_date, duration)
+						VALUES ('Test movie', 'drama', '2023-01-01', 120) RETURNING movie_id`).Scan(&movieId)
+	require.NoError(t, err)
+	err = db.QueryRow("INSERT INTO halls (hall_name, capacity) VALUES ('Test hall', 10) RETURNING hall_id").
+		Scan(&hallId)
+	require.NoError(t, err)
+	start := time.Now().Add(24 * time.Hour)
+	err = db.QueryRow(`INSERT INTO cinema_sessions (movie_id, hall_id, start_time, end_time, price)
+						VALUES ($1, $2, $3, $4, 10) RETURNING session_id`,
+		movieId, hallId, start, start.Add(2*time.Hour)).Scan(&sessionId)
+	require.NoError(t, err)
+	err = db.QueryRow("INSERT INTO users (username, hashed_password) VALUES ($1, 'hash') RETURNING user_id",
+		fmt.Sprintf("test-%d", time.Now().UnixNano())).Scan(&userId)
+	require.NoError(t, err)
+
+	defer func() {
+		_, err := db.Exec("DELETE FROM tickets WHERE session_id = $1", sessionId)
+		assert.NoError(t, err)
+		_, err = db.Exec("DELETE FROM users WHERE user_id = $1", userId)
+		assert.NoError(t, err)
+		_, err = db.Exec("DELETE FROM movies WHERE movie_id = $1", movieId)
+		assert.NoError(t, err)
+		_, err = db.Exec("DELETE FROM halls WHERE hall_id = $1", hallId)
+		assert.NoError(t, err)
+	}()
+
+	_, err = repo.CreateTicket(sessionId, userId, 1)
+	require.NoError(t, err)
+
+	tickets, total, err := repo.UserTickets(service.TicketFilter{UserId: userId, Offset: 5, Limit: 10}, time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, tickets)
+	assert.Equal(t, 1, total)
+}
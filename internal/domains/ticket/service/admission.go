@@ -0,0 +1,104 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidTicketCode = errors.New("ticket code is invalid")
+	ErrTicketAdmitted    = errors.New("ticket was already admitted")
+	ErrAdmissionClosed   = errors.New("session of the ticket is not open for admission")
+)
+
+const (
+	ValidatePermission = "tickets:validate"
+
+	DefaultAdmissionWindow = 30 * time.Minute
+	signatureBytes         = 16
+)
+
+// WithSigningKey sets the key the codes printed on tickets are signed with.
+func (s Service) WithSigningKey(key []byte) Service {
+	s.signingKey = key
+	return s
+}
+
+// WithAdmissionWindow sets how long before and after the start of a session
+// its tickets are admitted.
+func (s Service) WithAdmissionWindow(window time.Duration) Service {
+	s.admissionWindow = window
+	return s
+}
+
+// TicketCode returns the signed code of the ticket that is printed on it as a
+// QR code. It has the form "<ticket id>.<session id>.<seat>.<signature>".
+func (s Service) TicketCode(t Ticket) string {
+	payload := fmt.Sprintf("%d.%d.%d", t.Id, t.SessionId, t.SeatNumber)
+	return payload + "." + s.sign(payload)
+}
+
+// ValidateTicket checks the signature of the scanned code and admits the
+// ticket if its session starts within the admission window. A ticket can be
+// admitted only once.
+func (s Service) ValidateTicket(code string) (TicketDetails, error) {
+	ticketId, sessionId, seatNum, err := s.parseTicketCode(code)
+	if err != nil {
+		return TicketDetails{}, err
+	}
+
+	now := time.Now()
+	ticket, err := s.r.AdmitTicket(ticketId, sessionId, seatNum, now.Add(-s.admissionWindow),
+		now.Add(s.admissionWindow))
+	if errors.Is(err, ErrTicketNotFound) {
+		return TicketDetails{}, ErrInvalidTicketCode
+	}
+	if errors.Is(err, ErrTicketCancelled) || errors.Is(err, ErrTicketAdmitted) || errors.Is(err, ErrAdmissionClosed) {
+		return TicketDetails{}, err
+	}
+	if err != nil {
+		log.Println(err)
+		return TicketDetails{}, ErrInternalError
+	}
+
+	return ticket, nil
+}
+
+func (s Service) parseTicketCode(code string) (ticketId, sessionId, seatNum int, err error) {
+	i := strings.LastIndex(code, ".")
+	if i < 0 {
+		return 0, 0, 0, ErrInvalidTicketCode
+	}
+
+	payload, signature := code[:i], code[i+1:]
+	if !hmac.Equal([]byte(signature), []byte(s.sign(payload))) {
+		return 0, 0, 0, ErrInvalidTicketCode
+	}
+
+	parts := strings.Split(payload, ".")
+	if len(parts) != 3 {
+		return 0, 0, 0, ErrInvalidTicketCode
+	}
+
+	ids := make([]int, len(parts))
+	for j, p := range parts {
+		if ids[j], err = strconv.Atoi(p); err != nil {
+			return 0, 0, 0, ErrInvalidTicketCode
+		}
+	}
+
+	return ids[0], ids[1], ids[2], nil
+}
+
+func (s Service) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:signatureBytes])
+}
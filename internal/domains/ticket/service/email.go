@@ -0,0 +1,197 @@
+package service
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/pkg/mailer"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	EmailPending = "pending"
+	EmailSent    = "sent"
+	EmailFailed  = "failed"
+)
+
+const (
+	emailBatchSize      = 20
+	maxEmailAttempts    = 5
+	emailRetryDelay     = time.Minute
+	calendarContentType = "text/calendar; charset=utf-8; method=PUBLISH"
+	calendarTimeLayout  = "20060102T150405Z"
+	// emailLease is how long a claimed email is hidden from other workers
+	// while it is being sent.
+	emailLease = 5 * time.Minute
+)
+
+// TicketEmail delivers the PDF of tickets bought together for a session.
+type TicketEmail struct {
+	Id          int
+	To          string
+	FileKey     string
+	Status      string
+	Attempts    int
+	NextAttempt time.Time
+	Failure     string
+	SessionId   int
+	MovieTitle  string
+	HallName    string
+	StartTime   time.Time
+	EndTime     time.Time
+	Seats       []int
+}
+
+// queueTicketEmail schedules the tickets stored under the key to be emailed
+// to their owner by RunEmailWorker. Failing to queue does not fail the
+// purchase, since the tickets can still be downloaded.
+func (s Service) queueTicketEmail(key string) {
+	if err := s.r.QueueTicketEmail(key); err != nil {
+		log.Println(err)
+		return
+	}
+
+	select {
+	case s.emailsDue <- struct{}{}:
+	default:
+	}
+}
+
+// RunEmailWorker sends queued ticket emails every interval and right after a
+// purchase, until ctx is done. Failed emails are retried with a growing delay
+// until they run out of attempts. Several workers may run at once, since each
+// claims its batch for emailLease.
+func (s Service) RunEmailWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.emailsDue:
+		}
+		s.processEmails(ctx)
+	}
+}
+
+func (s Service) processEmails(ctx context.Context) {
+	now := time.Now()
+	emails, err := s.r.PendingTicketEmails(now, now.Add(emailLease), emailBatchSize)
+	if err != nil {
+		log.Println("failed to get pending ticket emails:", err)
+		return
+	}
+
+	for _, e := range emails {
+		e.Attempts++
+		e.Status = EmailSent
+		e.NextAttempt = time.Now()
+
+		if err = s.sendTicketEmail(ctx, e); err != nil {
+			log.Printf("ticket email %d failed: %v", e.Id, err)
+			e.Failure = err.Error()
+			e.Status = EmailPending
+			e.NextAttempt = time.Now().Add(emailRetryDelay << (e.Attempts - 1))
+			if e.Attempts >= maxEmailAttempts {
+				e.Status = EmailFailed
+			}
+		}
+
+		if err = s.r.UpdateTicketEmail(e); err != nil {
+			log.Printf("failed to update ticket email %d: %v", e.Id, err)
+		}
+	}
+}
+
+func (s Service) sendTicketEmail(ctx context.Context, e TicketEmail) error {
+	obj, err := s.storage.Get(ctx, e.FileKey)
+	if err != nil {
+		return err
+	}
+	defer obj.Body.Close()
+
+	pdf, err := io.ReadAll(obj.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read ticket file: %w", err)
+	}
+
+	seats := seatList(e.Seats)
+	return s.m.Send(mailer.Message{
+		To:      e.To,
+		Subject: "Your tickets for " + e.MovieTitle,
+		Body: fmt.Sprintf("Thank you for your purchase!\n\n%s\n%s, hall %s\nSeats: %s\n\n"+
+			"Your tickets are attached. Show the QR code at the entrance.\n",
+			e.MovieTitle, e.StartTime.Format("2006-01-02 15:04"), e.HallName, seats),
+		Attachments: []mailer.Attachment{
+			{Name: "tickets.pdf", ContentType: pdfContentType, Data: pdf},
+			{Name: "session.ics", ContentType: calendarContentType, Data: calendarInvite(e, time.Now())},
+		},
+	})
+}
+
+// calendarInvite returns an iCalendar event for the session of the email so
+// that it can be added to a calendar.
+func calendarInvite(e TicketEmail, now time.Time) []byte {
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//CinemaGo//Tickets//EN",
+		"METHOD:PUBLISH",
+		"BEGIN:VEVENT",
+		fmt.Sprintf("UID:ticket-email-%d@cinemago", e.Id),
+		"DTSTAMP:" + now.UTC().Format(calendarTimeLayout),
+		"DTSTART:" + e.StartTime.UTC().Format(calendarTimeLayout),
+		"DTEND:" + e.EndTime.UTC().Format(calendarTimeLayout),
+		"SUMMARY:" + escapeText(e.MovieTitle),
+		"LOCATION:" + escapeText("Hall "+e.HallName),
+		"DESCRIPTION:" + escapeText("Seats: "+seatList(e.Seats)),
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}
+
+	var b bytes.Buffer
+	for _, line := range lines {
+		b.WriteString(foldLine(line))
+		b.WriteString("\r\n")
+	}
+	return b.Bytes()
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+// foldLine splits lines longer than 75 octets as iCalendar requires, without
+// breaking UTF-8 characters.
+func foldLine(line string) string {
+	const maxLength = 75
+
+	var b strings.Builder
+	length := 0
+	for _, r := range line {
+		size := len(string(r))
+		if length+size > maxLength {
+			b.WriteString("\r\n ")
+			length = 1
+		}
+		b.WriteRune(r)
+		length += size
+	}
+	return b.String()
+}
+
+func seatList(seats []int) string {
+	list := make([]string, 0, len(seats))
+	for _, seat := range seats {
+		list = append(list, strconv.Itoa(seat))
+	}
+	return strings.Join(list, ", ")
+}
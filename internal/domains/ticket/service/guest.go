@@ -0,0 +1,168 @@
+package service
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/password"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/token"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/pkg/mailer"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+var (
+	ErrInvalidLookupCode = errors.New("invalid lookup code")
+	ErrTooManyPurchases  = errors.New("too many guest purchases, try again later")
+)
+
+// RetryError tells how long the client has to wait before buying again.
+type RetryError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e RetryError) Error() string {
+	return e.Err.Error()
+}
+
+func (e RetryError) Unwrap() error {
+	return e.Err
+}
+
+type limiter interface {
+	Check(key string) (retryAfter time.Duration, err error)
+	Fail(key string) (retryAfter time.Duration, err error)
+}
+
+// WithGuestLimiter limits guest purchases per client address. Every purchase
+// counts as a failure of the limiter, so a client is throttled once it buys
+// more tickets than the policy allows failures.
+func (s Service) WithGuestLimiter(l limiter) Service {
+	s.guests = l
+	return s
+}
+
+// GuestTicket is a ticket found by its lookup code. The TicketPath to download
+// it is signed when the ticket is looked up and is empty for cancelled tickets.
+type GuestTicket struct {
+	Ticket
+	FileKey    string
+	TicketPath string
+}
+
+// BuyGuestTicket sells a ticket without an account. The ticket belongs to a
+// disabled guest user and can be found or claimed later with the returned
+// lookup code, which is also sent to the given email. The email carries no
+// download link, since it would expire long before the email is read; the
+// lookup code gets a fresh one. The code is sent and returned as soon as the
+// sale is made, so it is not lost when the PDF cannot be created; the
+// ticketPath is empty then.
+func (s Service) BuyGuestTicket(ctx context.Context, email, clientIP string, sessionId, seatNum int) (
+	ticketPath string, lookupCode string, err error) {
+	if err = s.limitGuest(clientIP); err != nil {
+		return "", "", err
+	}
+
+	lookupCode, codeHash, err := token.New()
+	if err != nil {
+		log.Println(err)
+		return "", "", ErrInternalError
+	}
+
+	random, _, err := token.New()
+	if err != nil {
+		log.Println(err)
+		return "", "", ErrInternalError
+	}
+	passwordHash, err := password.Hash(random)
+	if err != nil {
+		log.Println("failed to hash password:", err)
+		return "", "", ErrInternalError
+	}
+
+	ticket, err := s.r.CreateGuestTicket(email, codeHash, passwordHash, sessionId, seatNum)
+	if errors.Is(err, ErrTicketExists) || errors.Is(err, ErrSeatHeld) || errors.Is(err, ErrCinemaSessionsNotFound) ||
+		errors.Is(err, ErrInvalidSeat) {
+		return "", "", err
+	}
+	if err != nil {
+		log.Println(err)
+		return "", "", ErrInternalError
+	}
+
+	err = s.m.Send(mailer.Message{
+		To:      email,
+		Subject: "Your cinema ticket",
+		Body: fmt.Sprintf("Thank you for your purchase!\n\n"+
+			"Use the lookup code below to download your tickets, to find them again or to add them to an "+
+			"account after registering:\n\n%s\n", lookupCode),
+	})
+	if err != nil {
+		log.Println("failed to send guest ticket email:", err)
+	}
+
+	ticketPath, err = s.issueTickets(ctx, []Ticket{ticket})
+	if err != nil {
+		log.Printf("failed to issue guest ticket %d: %v", ticket.Id, err)
+	}
+
+	return ticketPath, lookupCode, nil
+}
+
+func (s Service) limitGuest(clientIP string) error {
+	if s.guests == nil {
+		return nil
+	}
+
+	key := "guest:" + clientIP
+	retryAfter, err := s.guests.Check(key)
+	if err != nil {
+		log.Println(err)
+		return ErrInternalError
+	}
+	if retryAfter > 0 {
+		return RetryError{Err: ErrTooManyPurchases, RetryAfter: retryAfter}
+	}
+
+	if _, err = s.guests.Fail(key); err != nil {
+		log.Println(err)
+		return ErrInternalError
+	}
+	return nil
+}
+
+func (s Service) GuestTickets(ctx context.Context, lookupCode string) ([]GuestTicket, error) {
+	tickets, found, err := s.r.GuestTickets(token.Hash(lookupCode))
+	if err != nil {
+		log.Println(err)
+		return nil, ErrInternalError
+	}
+	if !found {
+		return nil, ErrInvalidLookupCode
+	}
+
+	for i, t := range tickets {
+		if t.FileKey == "" {
+			continue
+		}
+		if tickets[i].TicketPath, err = s.fileURL(ctx, t.FileKey); err != nil {
+			return nil, err
+		}
+	}
+	return tickets, nil
+}
+
+// ClaimTickets moves the tickets bought as a guest to the account of the
+// user and removes the guest identity.
+func (s Service) ClaimTickets(userId int, lookupCode string) (int, error) {
+	claimed, found, err := s.r.ClaimGuestTickets(token.Hash(lookupCode), userId)
+	if err != nil {
+		log.Println(err)
+		return 0, ErrInternalError
+	}
+	if !found {
+		return 0, ErrInvalidLookupCode
+	}
+	return claimed, nil
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+var ErrInvalidPeriod = errors.New("period must be either upcoming or past")
+
+const (
+	ReadPermission = "tickets:read"
+
+	PeriodUpcoming = "upcoming"
+	PeriodPast     = "past"
+
+	// AnyUser lets TicketDetails and CancelTicket reach a ticket regardless
+	// of its owner.
+	AnyUser = 0
+)
+
+type TicketDetails struct {
+	Id         int
+	UserId     int
+	SessionId  int
+	MovieTitle string
+	HallName   string
+	StartTime  time.Time
+	SeatNumber int
+	Price      float64
+	Status     string
+}
+
+type TicketFilter struct {
+	UserId int
+	Period string
+	Offset int
+	Limit  int
+}
+
+// UserTickets returns a page of the user's tickets together with the total
+// number of tickets matching the filter. Upcoming tickets are sorted by the
+// nearest session first, past ones by the latest.
+func (s Service) UserTickets(filter TicketFilter) ([]TicketDetails, int, error) {
+	if filter.Period != "" && filter.Period != PeriodUpcoming && filter.Period != PeriodPast {
+		return nil, 0, ErrInvalidPeriod
+	}
+
+	tickets, total, err := s.r.UserTickets(filter, time.Now())
+	if err != nil {
+		log.Println(err)
+		return nil, 0, ErrInternalError
+	}
+
+	return tickets, total, nil
+}
+
+// TicketDetails returns the ticket if it belongs to the user. Pass AnyUser to
+// skip the ownership check.
+func (s Service) TicketDetails(ticketId, userId int) (TicketDetails, error) {
+	ticket, err := s.r.TicketDetails(ticketId, userId)
+	if errors.Is(err, ErrTicketNotFound) {
+		return TicketDetails{}, err
+	}
+	if err != nil {
+		log.Println(err)
+		return TicketDetails{}, ErrInternalError
+	}
+
+	return ticket, nil
+}
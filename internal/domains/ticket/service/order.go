@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+)
+
+var ErrInvalidOrder = errors.New("an order must contain 1 to 10 different seats")
+
+const maxOrderSeats = 10
+
+type Order struct {
+	Id         int
+	SessionId  int
+	UserId     int
+	Tickets    []Ticket
+	TotalPrice float64
+}
+
+// BuyOrder sells all given seats of a session in one order or none of them.
+// The tickets are issued as a single PDF with a page per seat.
+func (s Service) BuyOrder(ctx context.Context, sessionId, userId int, seats []int) (Order, string, error) {
+	if len(seats) == 0 || len(seats) > maxOrderSeats {
+		return Order{}, "", ErrInvalidOrder
+	}
+
+	sorted := append([]int(nil), seats...)
+	sort.Ints(sorted)
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i-1] == sorted[i] {
+			return Order{}, "", ErrInvalidOrder
+		}
+	}
+
+	order, err := s.r.CreateOrder(sessionId, userId, sorted)
+	if errors.Is(err, ErrTicketExists) || errors.Is(err, ErrSeatHeld) || errors.Is(err, ErrCinemaSessionsNotFound) ||
+		errors.Is(err, ErrInvalidSeat) {
+		return Order{}, "", err
+	}
+	if err != nil {
+		log.Println(err)
+		return Order{}, "", ErrInternalError
+	}
+
+	path, err := s.issueTickets(ctx, order.Tickets)
+	if err != nil {
+		return Order{}, "", err
+	}
+
+	return order, path, nil
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+var (
+	ErrTicketNotFound     = errors.New("ticket was not found")
+	ErrTicketCancelled    = errors.New("ticket is already cancelled")
+	ErrCancellationClosed = errors.New("ticket can no longer be cancelled")
+)
+
+// RefundPermission lets staff cancel and refund tickets of any user, and
+// refund the sold tickets of a deleted session.
+const RefundPermission = "tickets:refund"
+
+const (
+	StatusActive    = "active"
+	StatusCancelled = "cancelled"
+
+	RefundPending   = "pending"
+	RefundSucceeded = "succeeded"
+	RefundFailed    = "failed"
+)
+
+const (
+	DefaultCancellationCutoff = 2 * time.Hour
+	refundBatchSize           = 50
+	maxRefundAttempts         = 5
+	refundRetryDelay          = time.Minute
+	// refundLease is how long a claimed refund is hidden from other workers
+	// while it is being sent to the payment provider.
+	refundLease = 5 * time.Minute
+)
+
+type Refund struct {
+	Id          int
+	TicketId    int
+	UserId      int
+	Amount      float64
+	Status      string
+	ProviderRef string
+	Failure     string
+	Attempts    int
+	NextAttempt time.Time
+}
+
+type refundProvider interface {
+	Refund(ctx context.Context, reference string, amount float64) (refundId string, err error)
+}
+
+// WithCancellationCutoff sets how long before the start of a session tickets
+// can still be cancelled by their owners.
+func (s Service) WithCancellationCutoff(cutoff time.Duration) Service {
+	s.cancellationCutoff = cutoff
+	return s
+}
+
+// CancelTicket cancels a ticket of the user, releases its seat and creates a
+// pending refund. Refunds are sent by RunRefundWorker. With AnyUser the
+// ticket of any user is cancelled, even after the cancellation cutoff, as long
+// as its session has not started yet.
+func (s Service) CancelTicket(userId, ticketId int) (Refund, error) {
+	startsAfter := time.Now()
+	if userId != AnyUser {
+		startsAfter = startsAfter.Add(s.cancellationCutoff)
+	}
+
+	refund, err := s.r.CancelTicket(ticketId, userId, startsAfter)
+	if errors.Is(err, ErrTicketNotFound) || errors.Is(err, ErrTicketCancelled) ||
+		errors.Is(err, ErrCancellationClosed) {
+		return Refund{}, err
+	}
+	if err != nil {
+		log.Println(err)
+		return Refund{}, ErrInternalError
+	}
+
+	select {
+	case s.refundsDue <- struct{}{}:
+	default:
+	}
+
+	return refund, nil
+}
+
+// RunRefundWorker sends pending refunds to the payment provider every interval
+// and right after a ticket was cancelled, until ctx is done. Failed refunds are
+// retried with a growing delay until they run out of attempts. Workers of
+// several instances claim different refunds. The refund id is sent as the
+// idempotency key, which keeps a refund retried after a crash from being paid
+// twice only as long as the provider remembers the key; the fake provider
+// forgets it on restart.
+//
+// Purchases do not charge the buyer yet, so there is no charge to refund
+// against and no money is paid back.
+func (s Service) RunRefundWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.refundsDue:
+		}
+		s.processRefunds(ctx)
+	}
+}
+
+func (s Service) processRefunds(ctx context.Context) {
+	now := time.Now()
+	refunds, err := s.r.PendingRefunds(now, now.Add(refundLease), refundBatchSize)
+	if err != nil {
+		log.Println("failed to get pending refunds:", err)
+		return
+	}
+
+	for _, refund := range refunds {
+		refund.Attempts++
+		refund.Status = RefundSucceeded
+		// The reference is only an idempotency key, it does not point to a
+		// charge since tickets are issued without one.
+		refund.ProviderRef, err = s.refunds.Refund(ctx, fmt.Sprintf("refund-%d", refund.Id), refund.Amount)
+		if err != nil {
+			log.Printf("refund %d failed: %v", refund.Id, err)
+			refund.Failure = err.Error()
+			refund.Status = RefundPending
+			refund.NextAttempt = time.Now().Add(refundRetryDelay << (refund.Attempts - 1))
+			if refund.Attempts >= maxRefundAttempts {
+				refund.Status = RefundFailed
+			}
+		}
+
+		if err = s.r.UpdateRefund(refund); err != nil {
+			log.Printf("failed to update refund %d: %v", refund.Id, err)
+		}
+	}
+}
@@ -1,11 +1,14 @@
 package service
 
 import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/token"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/pkg/mailer"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/pkg/storage"
+	"bytes"
 	"context"
 	"errors"
-	"fmt"
 	"io"
-	"os"
+	"log"
 	"time"
 )
 
@@ -13,21 +16,43 @@ var (
 	ErrInternalError          = errors.New("internal server error")
 	ErrCinemaSessionsNotFound = errors.New("no cinema sessions were found")
 	ErrTicketExists           = errors.New("ticket already exists")
+	ErrInvalidSeat            = errors.New("seat number is out of the hall's range")
+	ErrSeatHeld               = errors.New("seat is held by another customer")
+	ErrTicketFileNotFound     = errors.New("ticket has no PDF file")
 )
 
 const (
 	dateLayout = "2006-01-02"
 	timeLayout = "15:04:05"
+
+	DefaultTicketURLTTL = 15 * time.Minute
+	pdfContentType      = "application/pdf"
 )
 
 type Ticket struct {
-	Id         int
-	MovieName  string
-	Date       string
-	StartTime  string
-	Duration   int
-	HallId     int
-	SeatNumber int
+	Id          int
+	SessionId   int
+	OrderId     int
+	MovieName   string
+	Date        string
+	StartTime   string
+	Duration    int
+	HallId      int
+	HallName    string
+	SeatsPerRow int
+	SeatNumber  int
+	Price       float64
+	Purchaser   string
+	Code        string
+}
+
+// Seat returns the row of the seat and its number within the row. When the
+// layout of the hall is unknown the row is 0 and the place is the seat number.
+func (t Ticket) Seat() (row, place int) {
+	if t.SeatsPerRow <= 0 {
+		return 0, t.SeatNumber
+	}
+	return (t.SeatNumber-1)/t.SeatsPerRow + 1, (t.SeatNumber-1)%t.SeatsPerRow + 1
 }
 
 func NewTicketEntity(id, hallId, seat, duration int, movie string, startTime time.Time) Ticket {
@@ -43,75 +68,173 @@ func NewTicketEntity(id, hallId, seat, duration int, movie string, startTime tim
 }
 
 type repository interface {
-	SessionExists(id int) (bool, error)
-	TicketExists(sessionId, seatNum int) (bool, error)
 	CreateTicket(sessionId, userId, seatNum int) (Ticket, error)
+	CreateOrder(sessionId, userId int, seats []int) (Order, error)
+	CreateGuestTicket(email, lookupCodeHash, passwordHash string, sessionId, seatNum int) (Ticket, error)
+	GuestTickets(lookupCodeHash string) (tickets []GuestTicket, found bool, err error)
+	ClaimGuestTickets(lookupCodeHash string, userId int) (claimed int, found bool, err error)
+	CancelTicket(ticketId, userId int, startsAfter time.Time) (Refund, error)
+	// PendingRefunds claims up to limit refunds that are due and hides them
+	// from other callers until leaseUntil.
+	PendingRefunds(now, leaseUntil time.Time, limit int) ([]Refund, error)
+	UpdateRefund(refund Refund) error
+	UserTickets(filter TicketFilter, now time.Time) ([]TicketDetails, int, error)
+	TicketDetails(ticketId, userId int) (TicketDetails, error)
+	SetTicketFile(ticketIds []int, key string) error
+	TicketFile(ticketId, userId int) (string, error)
+	AdmitTicket(ticketId, sessionId, seatNum int, startsFrom, startsTo time.Time) (TicketDetails, error)
+	QueueTicketEmail(key string) error
+	// PendingTicketEmails claims up to limit emails that are due and hides them
+	// from other callers until leaseUntil.
+	PendingTicketEmails(now, leaseUntil time.Time, limit int) ([]TicketEmail, error)
+	UpdateTicketEmail(e TicketEmail) error
 }
 
 type ticketGenerator interface {
-	GenerateTicket(t Ticket, w io.Writer) error
+	GenerateTickets(tickets []Ticket, w io.Writer) error
 }
 
 type ticketsStorage interface {
-	Store(ctx context.Context, file *os.File) (string, error)
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (storage.Object, error)
+	SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+type sender interface {
+	Send(msg mailer.Message) error
 }
 
 type Service struct {
-	r       repository
-	gen     ticketGenerator
-	storage ticketsStorage
+	r                  repository
+	gen                ticketGenerator
+	hallGens           map[int]ticketGenerator
+	storage            ticketsStorage
+	m                  sender
+	refunds            refundProvider
+	cancellationCutoff time.Duration
+	refundsDue         chan struct{}
+	ticketURLTTL       time.Duration
+	signingKey         []byte
+	admissionWindow    time.Duration
+	emailsDue          chan struct{}
+	guests             limiter
 }
 
-func New(r repository, t ticketGenerator, s ticketsStorage) Service {
+func New(r repository, t ticketGenerator, s ticketsStorage, m sender, p refundProvider) Service {
 	return Service{
-		r:       r,
-		gen:     t,
-		storage: s,
+		r:                  r,
+		gen:                t,
+		storage:            s,
+		m:                  m,
+		refunds:            p,
+		cancellationCutoff: DefaultCancellationCutoff,
+		refundsDue:         make(chan struct{}, 1),
+		ticketURLTTL:       DefaultTicketURLTTL,
+		admissionWindow:    DefaultAdmissionWindow,
+		emailsDue:          make(chan struct{}, 1),
+	}
+}
+
+// WithHallGenerator makes tickets for sessions in the hall use gen instead of
+// the default generator, so that halls can carry the branding of their cinema.
+func (s Service) WithHallGenerator(hallId int, gen ticketGenerator) Service {
+	gens := make(map[int]ticketGenerator, len(s.hallGens)+1)
+	for id, g := range s.hallGens {
+		gens[id] = g
 	}
+	gens[hallId] = gen
+	s.hallGens = gens
+	return s
+}
+
+// generator returns the generator for tickets of the hall.
+func (s Service) generator(hallId int) ticketGenerator {
+	if gen, ok := s.hallGens[hallId]; ok {
+		return gen
+	}
+	return s.gen
+}
+
+// WithTicketURLTTL sets how long download URLs of ticket PDFs stay valid.
+func (s Service) WithTicketURLTTL(ttl time.Duration) Service {
+	s.ticketURLTTL = ttl
+	return s
 }
 
 func (s Service) BuyTicket(ctx context.Context, sessionId, userId, seatNum int) (string, error) {
-	exists, err := s.r.TicketExists(sessionId, seatNum)
+	ticket, err := s.r.CreateTicket(sessionId, userId, seatNum)
+	if errors.Is(err, ErrTicketExists) || errors.Is(err, ErrSeatHeld) || errors.Is(err, ErrCinemaSessionsNotFound) ||
+		errors.Is(err, ErrInvalidSeat) {
+		return "", err
+	}
+
 	if err != nil {
+		log.Println(err)
 		return "", ErrInternalError
 	}
 
-	if exists {
-		return "", ErrTicketExists
+	return s.issueTickets(ctx, []Ticket{ticket})
+}
+
+// issueTickets renders the tickets into one PDF, a page per ticket, stores it,
+// queues it to be emailed and returns a short-lived URL to download it. All
+// tickets belong to one session, so the template of its hall is used.
+func (s Service) issueTickets(ctx context.Context, tickets []Ticket) (string, error) {
+	for i := range tickets {
+		tickets[i].Code = s.TicketCode(tickets[i])
 	}
 
-	exists, err = s.r.SessionExists(sessionId)
-	if err != nil {
+	var buf bytes.Buffer
+	if err := s.generator(tickets[0].HallId).GenerateTickets(tickets, &buf); err != nil {
 		return "", ErrInternalError
 	}
 
-	if !exists {
-		return "", ErrCinemaSessionsNotFound
+	// Keys are random so that files cannot be found by guessing.
+	key, _, err := token.New()
+	if err != nil {
+		log.Println("failed to generate ticket file key:", err)
+		return "", ErrInternalError
 	}
 
-	ticket, err := s.r.CreateTicket(sessionId, userId, seatNum)
-	if errors.Is(err, ErrTicketExists) {
-		return "", err
+	if err = s.storage.Put(ctx, key, &buf, int64(buf.Len()), pdfContentType); err != nil {
+		log.Println(err)
+		return "", ErrInternalError
 	}
 
-	if err != nil {
+	ids := make([]int, 0, len(tickets))
+	for _, t := range tickets {
+		ids = append(ids, t.Id)
+	}
+	if err = s.r.SetTicketFile(ids, key); err != nil {
+		log.Println(err)
 		return "", ErrInternalError
 	}
+	s.queueTicketEmail(key)
 
-	ticketName := fmt.Sprintf("ticket%d.pdf", ticket.Id)
-	ticketFile, err := os.Create(ticketName)
-	defer ticketFile.Close()
+	return s.fileURL(ctx, key)
+}
 
-	err = s.gen.GenerateTicket(ticket, ticketFile)
+// TicketURL returns a short-lived URL to download the PDF of the user's
+// ticket. Pass AnyUser to skip the ownership check.
+func (s Service) TicketURL(ctx context.Context, ticketId, userId int) (string, error) {
+	key, err := s.r.TicketFile(ticketId, userId)
+	if errors.Is(err, ErrTicketNotFound) || errors.Is(err, ErrTicketCancelled) ||
+		errors.Is(err, ErrTicketFileNotFound) {
+		return "", err
+	}
 	if err != nil {
+		log.Println(err)
 		return "", ErrInternalError
 	}
 
-	ticketFile, err = os.Open(ticketName)
-	path, err := s.storage.Store(ctx, ticketFile)
+	return s.fileURL(ctx, key)
+}
+
+func (s Service) fileURL(ctx context.Context, key string) (string, error) {
+	url, err := s.storage.SignedURL(ctx, key, s.ticketURLTTL)
 	if err != nil {
+		log.Println(err)
 		return "", ErrInternalError
 	}
-
-	return path, nil
+	return url, nil
 }
@@ -1,83 +1,843 @@
 package service
 
 import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/auth/lockout"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/pkg/mailer"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/pkg/payment"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/pkg/storage"
 	"context"
 	"errors"
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"io"
-	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
+// mockRepository behaves like the tickets table with its unique
+// (session_id, seat_number) index: every seat can be sold only once.
 type mockRepository struct {
-	sessionExists bool
-	ticketExists  bool
+	mu            sync.Mutex
+	capacity      map[int]int
+	sold          map[[2]int]bool
+	holds         map[[2]int]int
+	tickets       map[int]time.Time
+	refunds       []Refund
 	err           error
+	guestCodeHash string
+	guestTickets  []Ticket
+	details       []TicketDetails
+	files         map[int]string
+	admitted      map[int]bool
+	emails        []TicketEmail
 }
 
-func (m *mockRepository) TicketExists(sessionId, seatNum int) (bool, error) {
-	return m.ticketExists, nil
+func newMockRepository() *mockRepository {
+	return &mockRepository{
+		capacity: map[int]int{1: 10},
+		sold:     map[[2]int]bool{},
+		holds:    map[[2]int]int{},
+	}
 }
 
-func (m *mockRepository) SessionExists(id int) (bool, error) {
-	return m.sessionExists, nil
+func (m *mockRepository) reserveSeat(sessionId, userId, seatNum int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return m.err
+	}
+
+	capacity, ok := m.capacity[sessionId]
+	if !ok {
+		return ErrCinemaSessionsNotFound
+	}
+	if seatNum < 1 || seatNum > capacity {
+		return ErrInvalidSeat
+	}
+	if m.sold[[2]int{sessionId, seatNum}] {
+		return ErrTicketExists
+	}
+	if holder, ok := m.holds[[2]int{sessionId, seatNum}]; ok && holder != userId {
+		return ErrSeatHeld
+	}
+
+	m.sold[[2]int{sessionId, seatNum}] = true
+	return nil
 }
 
 func (m *mockRepository) CreateTicket(sessionId, userId, seatNum int) (Ticket, error) {
-	if sessionId == 1 && userId == 1 && seatNum == 2 {
-		return NewTicketEntity(1, 1, 2, 120, "Movie 1", time.Now()), nil
+	if err := m.reserveSeat(sessionId, userId, seatNum); err != nil {
+		return Ticket{}, err
+	}
+	return NewTicketEntity(1, 1, seatNum, 120, "Movie 1", time.Now()), nil
+}
+
+func (m *mockRepository) CreateOrder(sessionId, userId int, seats []int) (Order, error) {
+	order := Order{Id: 1, SessionId: sessionId, UserId: userId}
+	for _, seat := range seats {
+		if err := m.reserveSeat(sessionId, userId, seat); err != nil {
+			m.mu.Lock()
+			for _, t := range order.Tickets {
+				delete(m.sold, [2]int{sessionId, t.SeatNumber})
+			}
+			m.mu.Unlock()
+			return Order{}, err
+		}
+		t := NewTicketEntity(len(order.Tickets)+1, 1, seat, 120, "Movie 1", time.Now())
+		t.Price = 7.5
+		order.Tickets = append(order.Tickets, t)
+		order.TotalPrice += t.Price
+	}
+	return order, nil
+}
+
+func (m *mockRepository) CreateGuestTicket(email, lookupCodeHash, passwordHash string,
+	sessionId, seatNum int) (Ticket, error) {
+	if err := m.reserveSeat(sessionId, 0, seatNum); err != nil {
+		return Ticket{}, err
+	}
+	m.guestCodeHash = lookupCodeHash
+	m.guestTickets = append(m.guestTickets, NewTicketEntity(1, 1, seatNum, 120, "Movie 1", time.Now()))
+	return m.guestTickets[len(m.guestTickets)-1], nil
+}
+
+func (m *mockRepository) GuestTickets(lookupCodeHash string) ([]GuestTicket, bool, error) {
+	if lookupCodeHash != m.guestCodeHash {
+		return nil, false, m.err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tickets := make([]GuestTicket, 0, len(m.guestTickets))
+	for _, t := range m.guestTickets {
+		tickets = append(tickets, GuestTicket{Ticket: t, FileKey: m.files[t.Id]})
+	}
+	return tickets, true, m.err
+}
+
+func (m *mockRepository) ClaimGuestTickets(lookupCodeHash string, userId int) (int, bool, error) {
+	if lookupCodeHash != m.guestCodeHash {
+		return 0, false, m.err
+	}
+	claimed := len(m.guestTickets)
+	m.guestTickets = nil
+	m.guestCodeHash = ""
+	return claimed, true, m.err
+}
+
+func (m *mockRepository) CancelTicket(ticketId, userId int, startsAfter time.Time) (Refund, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return Refund{}, m.err
+	}
+
+	startTime, ok := m.tickets[ticketId]
+	if !ok {
+		return Refund{}, ErrTicketNotFound
+	}
+	if !startTime.After(startsAfter) {
+		return Refund{}, ErrCancellationClosed
+	}
+
+	delete(m.tickets, ticketId)
+	refund := Refund{Id: len(m.refunds) + 1, TicketId: ticketId, UserId: userId, Amount: 7.5, Status: RefundPending}
+	m.refunds = append(m.refunds, refund)
+	return refund, nil
+}
+
+func (m *mockRepository) PendingRefunds(now, leaseUntil time.Time, limit int) ([]Refund, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var pending []Refund
+	for i, r := range m.refunds {
+		if r.Status == RefundPending && !r.NextAttempt.After(now) {
+			m.refunds[i].NextAttempt = leaseUntil
+			pending = append(pending, r)
+		}
+	}
+	return pending, nil
+}
+
+func (m *mockRepository) UpdateRefund(refund Refund) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.refunds[refund.Id-1] = refund
+	return nil
+}
+
+func (m *mockRepository) refund(id int) Refund {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.refunds[id-1]
+}
+
+func (m *mockRepository) UserTickets(filter TicketFilter, now time.Time) ([]TicketDetails, int, error) {
+	if m.err != nil {
+		return nil, 0, m.err
+	}
+
+	var tickets []TicketDetails
+	for _, t := range m.details {
+		upcoming := t.StartTime.After(now)
+		if t.UserId != filter.UserId || filter.Period == PeriodUpcoming && !upcoming ||
+			filter.Period == PeriodPast && upcoming {
+			continue
+		}
+		tickets = append(tickets, t)
+	}
+	return tickets, len(tickets), nil
+}
+
+func (m *mockRepository) TicketDetails(ticketId, userId int) (TicketDetails, error) {
+	if m.err != nil {
+		return TicketDetails{}, m.err
+	}
+
+	for _, t := range m.details {
+		if t.Id == ticketId && (userId == AnyUser || t.UserId == userId) {
+			return t, nil
+		}
 	}
-	return Ticket{}, m.err
+	return TicketDetails{}, ErrTicketNotFound
 }
 
-type mockTicketGenerator struct{}
+func (m *mockRepository) SetTicketFile(ticketIds []int, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-func (m *mockTicketGenerator) GenerateTicket(t Ticket, w io.Writer) error {
+	if m.files == nil {
+		m.files = map[int]string{}
+	}
+	for _, id := range ticketIds {
+		m.files[id] = key
+	}
 	return nil
 }
 
-type mockTicketsStorage struct{}
+func (m *mockRepository) TicketFile(ticketId, userId int) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-func (m mockTicketsStorage) Store(ctx context.Context, file *os.File) (string, error) {
-	return "", nil
+	for _, t := range m.details {
+		if t.Id != ticketId || userId != AnyUser && t.UserId != userId {
+			continue
+		}
+		key, ok := m.files[ticketId]
+		if !ok {
+			return "", ErrTicketFileNotFound
+		}
+		return key, nil
+	}
+	return "", ErrTicketNotFound
+}
+
+func (m *mockRepository) AdmitTicket(ticketId, sessionId, seatNum int, startsFrom,
+	startsTo time.Time) (TicketDetails, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, t := range m.details {
+		if t.Id != ticketId || t.SessionId != sessionId || t.SeatNumber != seatNum {
+			continue
+		}
+		if m.admitted[ticketId] {
+			return TicketDetails{}, ErrTicketAdmitted
+		}
+		if t.StartTime.Before(startsFrom) || t.StartTime.After(startsTo) {
+			return TicketDetails{}, ErrAdmissionClosed
+		}
+		if m.admitted == nil {
+			m.admitted = map[int]bool{}
+		}
+		m.admitted[ticketId] = true
+		return t, nil
+	}
+	return TicketDetails{}, ErrTicketNotFound
+}
+
+func (m *mockRepository) QueueTicketEmail(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.emails = append(m.emails, TicketEmail{
+		Id:         len(m.emails) + 1,
+		To:         "user@example.com",
+		FileKey:    key,
+		Status:     EmailPending,
+		SessionId:  1,
+		MovieTitle: "Movie",
+		HallName:   "Red",
+		StartTime:  time.Date(2023, 6, 1, 18, 30, 0, 0, time.UTC),
+		EndTime:    time.Date(2023, 6, 1, 20, 45, 0, 0, time.UTC),
+		Seats:      []int{1},
+	})
+	return nil
+}
+
+func (m *mockRepository) PendingTicketEmails(now, leaseUntil time.Time, limit int) ([]TicketEmail, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var pending []TicketEmail
+	for i, e := range m.emails {
+		if e.Status == EmailPending && !e.NextAttempt.After(now) {
+			m.emails[i].NextAttempt = leaseUntil
+			pending = append(pending, e)
+		}
+	}
+	return pending, nil
+}
+
+func (m *mockRepository) UpdateTicketEmail(e TicketEmail) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.emails[e.Id-1] = e
+	return nil
+}
+
+func (m *mockRepository) email(id int) TicketEmail {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.emails[id-1]
+}
+
+type mockRefunds struct {
+	err error
+}
+
+func (m mockRefunds) Refund(ctx context.Context, reference string, amount float64) (string, error) {
+	return "re_" + reference, m.err
+}
+
+type mockTicketGenerator struct {
+	pages int
+	err   error
+}
+
+func (m *mockTicketGenerator) GenerateTickets(tickets []Ticket, w io.Writer) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.pages = len(tickets)
+	_, err := fmt.Fprintf(w, "%%PDF %d", len(tickets))
+	return err
 }
 
 func TestService_BuyTicket(t *testing.T) {
-	repo := &mockRepository{}
+	repo := newMockRepository()
 	gen := &mockTicketGenerator{}
-	storage := &mockTicketsStorage{}
+	files := storage.NewMemory()
 	ctx := context.Background()
+	service := New(repo, gen, files, mailer.NewMemory(), payment.NewFake())
 
 	t.Run("successful purchase", func(t *testing.T) {
-		repo.sessionExists = true
-		service := New(repo, gen, storage)
 		_, err := service.BuyTicket(ctx, 1, 1, 2)
 		assert.NoError(t, err)
+
+		obj, err := files.Get(ctx, repo.files[1])
+		require.NoError(t, err)
+		defer obj.Body.Close()
+		content, err := io.ReadAll(obj.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "%PDF 1", string(content))
+		assert.Equal(t, "application/pdf", obj.ContentType)
 	})
 
 	t.Run("session not found", func(t *testing.T) {
-		repo.sessionExists = false
-		service := New(repo, gen, storage)
-		_, err := service.BuyTicket(ctx, 1, 1, 2)
+		_, err := service.BuyTicket(ctx, 5, 1, 2)
 		assert.ErrorIs(t, err, ErrCinemaSessionsNotFound)
 	})
 
 	t.Run("ticket already exists", func(t *testing.T) {
-		repo.ticketExists = true
-		repo.sessionExists = true
-		service := New(repo, gen, storage)
-		_, err := service.BuyTicket(ctx, 1, 1, 2)
+		_, err := service.BuyTicket(ctx, 1, 2, 2)
 		assert.ErrorIs(t, err, ErrTicketExists)
 	})
 
+	t.Run("seat held by another customer", func(t *testing.T) {
+		repo.holds[[2]int{1, 7}] = 3
+		_, err := service.BuyTicket(ctx, 1, 1, 7)
+		assert.ErrorIs(t, err, ErrSeatHeld)
+
+		_, err = service.BuyTicket(ctx, 1, 3, 7)
+		assert.NoError(t, err)
+	})
+
+	t.Run("seat out of range", func(t *testing.T) {
+		_, err := service.BuyTicket(ctx, 1, 1, 11)
+		assert.ErrorIs(t, err, ErrInvalidSeat)
+
+		_, err = service.BuyTicket(ctx, 1, 1, 0)
+		assert.ErrorIs(t, err, ErrInvalidSeat)
+	})
+
 	t.Run("internal server error", func(t *testing.T) {
-		repo.ticketExists = false
-		repo.sessionExists = true
 		repo.err = errors.New("something went wrong")
-
-		service := New(repo, gen, storage)
-		_, err := service.BuyTicket(ctx, 2, 1, 2)
+		_, err := service.BuyTicket(ctx, 1, 1, 3)
 		assert.ErrorIs(t, err, ErrInternalError)
 	})
 }
+
+func TestService_HallGenerator(t *testing.T) {
+	gen, hallGen, otherGen := &mockTicketGenerator{}, &mockTicketGenerator{}, &mockTicketGenerator{}
+	service := New(newMockRepository(), gen, storage.NewMemory(), mailer.NewMemory(), payment.NewFake()).
+		WithHallGenerator(1, hallGen).
+		WithHallGenerator(2, otherGen)
+
+	_, err := service.BuyTicket(context.Background(), 1, 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 1, hallGen.pages)
+	assert.Zero(t, gen.pages)
+	assert.Zero(t, otherGen.pages)
+
+	service = New(newMockRepository(), gen, storage.NewMemory(), mailer.NewMemory(), payment.NewFake()).
+		WithHallGenerator(2, otherGen)
+
+	_, err = service.BuyTicket(context.Background(), 1, 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 1, gen.pages)
+	assert.Zero(t, otherGen.pages)
+}
+
+func TestService_BuyTicketConcurrently(t *testing.T) {
+	const buyers = 50
+
+	service := New(newMockRepository(), &mockTicketGenerator{}, storage.NewMemory(), mailer.NewMemory(),
+		payment.NewFake())
+
+	var wg sync.WaitGroup
+	errs := make(chan error, buyers)
+	for i := 1; i <= buyers; i++ {
+		wg.Add(1)
+		go func(userId int) {
+			defer wg.Done()
+			_, err := service.BuyTicket(context.Background(), 1, userId, 5)
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	sold := 0
+	for err := range errs {
+		if err == nil {
+			sold++
+			continue
+		}
+		assert.ErrorIs(t, err, ErrTicketExists)
+	}
+	assert.Equal(t, 1, sold)
+}
+
+func TestService_GuestTickets(t *testing.T) {
+	repo := newMockRepository()
+	m := mailer.NewMemory()
+	service := New(repo, &mockTicketGenerator{}, storage.NewMemory(), m, payment.NewFake())
+	ctx := context.Background()
+
+	_, code, err := service.BuyGuestTicket(ctx, "guest@example.com", "192.0.2.1", 1, 3)
+	require.NoError(t, err)
+	require.NotEmpty(t, code)
+
+	messages := m.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, "guest@example.com", messages[0].To)
+	assert.Contains(t, messages[0].Body, code)
+	assert.NotContains(t, messages[0].Body, "memory://")
+
+	tickets, err := service.GuestTickets(ctx, code)
+	require.NoError(t, err)
+	require.Len(t, tickets, 1)
+	assert.Equal(t, 3, tickets[0].SeatNumber)
+	assert.True(t, strings.HasPrefix(tickets[0].TicketPath, "memory://"))
+
+	_, err = service.GuestTickets(ctx, "wrong_code")
+	assert.ErrorIs(t, err, ErrInvalidLookupCode)
+
+	claimed, err := service.ClaimTickets(2, code)
+	require.NoError(t, err)
+	assert.Equal(t, 1, claimed)
+
+	_, err = service.ClaimTickets(2, code)
+	assert.ErrorIs(t, err, ErrInvalidLookupCode)
+
+	_, _, err = service.BuyGuestTicket(ctx, "guest@example.com", "192.0.2.1", 1, 3)
+	assert.ErrorIs(t, err, ErrTicketExists)
+}
+
+func TestService_BuyGuestTicketLimit(t *testing.T) {
+	limiter := lockout.New(lockout.NewMemoryStore(), lockout.Policy{
+		MaxFailures: 2,
+		BaseDelay:   time.Minute,
+		MaxDelay:    time.Hour,
+		Window:      time.Hour,
+	})
+	service := New(newMockRepository(), &mockTicketGenerator{}, storage.NewMemory(), mailer.NewMemory(),
+		payment.NewFake()).WithGuestLimiter(limiter)
+	ctx := context.Background()
+
+	for seat := 1; seat <= 2; seat++ {
+		_, _, err := service.BuyGuestTicket(ctx, "guest@example.com", "192.0.2.1", 1, seat)
+		require.NoError(t, err)
+	}
+
+	_, _, err := service.BuyGuestTicket(ctx, "guest@example.com", "192.0.2.1", 1, 3)
+	var retryErr RetryError
+	require.ErrorAs(t, err, &retryErr)
+	assert.ErrorIs(t, err, ErrTooManyPurchases)
+	assert.Greater(t, retryErr.RetryAfter, time.Duration(0))
+
+	_, _, err = service.BuyGuestTicket(ctx, "guest@example.com", "192.0.2.2", 1, 3)
+	assert.NoError(t, err)
+}
+
+func TestService_BuyGuestTicketWithoutPDF(t *testing.T) {
+	m := mailer.NewMemory()
+	gen := &mockTicketGenerator{err: errors.New("something went wrong")}
+	service := New(newMockRepository(), gen, storage.NewMemory(), m, payment.NewFake())
+
+	ticketPath, code, err := service.BuyGuestTicket(context.Background(), "guest@example.com", "192.0.2.1", 1, 3)
+	require.NoError(t, err)
+	assert.Empty(t, ticketPath)
+	require.NotEmpty(t, code)
+
+	messages := m.Messages()
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0].Body, code)
+}
+
+func TestService_BuyOrder(t *testing.T) {
+	repo := newMockRepository()
+	gen := &mockTicketGenerator{}
+	service := New(repo, gen, storage.NewMemory(), mailer.NewMemory(), payment.NewFake())
+	ctx := context.Background()
+
+	t.Run("successful order", func(t *testing.T) {
+		order, _, err := service.BuyOrder(ctx, 1, 1, []int{4, 2, 3})
+		require.NoError(t, err)
+		require.Len(t, order.Tickets, 3)
+		assert.Equal(t, 2, order.Tickets[0].SeatNumber)
+		assert.Equal(t, 22.5, order.TotalPrice)
+		assert.Equal(t, 3, gen.pages)
+	})
+
+	t.Run("invalid seats", func(t *testing.T) {
+		for _, seats := range [][]int{nil, {5, 5}, {1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}} {
+			_, _, err := service.BuyOrder(ctx, 1, 1, seats)
+			assert.ErrorIs(t, err, ErrInvalidOrder)
+		}
+	})
+
+	t.Run("all or nothing", func(t *testing.T) {
+		_, _, err := service.BuyOrder(ctx, 1, 2, []int{5, 6, 4})
+		assert.ErrorIs(t, err, ErrTicketExists)
+
+		_, _, err = service.BuyOrder(ctx, 1, 2, []int{5, 6})
+		assert.NoError(t, err)
+	})
+
+	t.Run("seat out of range", func(t *testing.T) {
+		_, _, err := service.BuyOrder(ctx, 1, 1, []int{9, 11})
+		assert.ErrorIs(t, err, ErrInvalidSeat)
+	})
+}
+
+func TestService_CancelTicket(t *testing.T) {
+	repo := newMockRepository()
+	repo.tickets = map[int]time.Time{
+		1: time.Now().Add(24 * time.Hour),
+		2: time.Now().Add(30 * time.Minute),
+	}
+	service := New(repo, &mockTicketGenerator{}, storage.NewMemory(), mailer.NewMemory(), mockRefunds{}).
+		WithCancellationCutoff(time.Hour)
+
+	refund, err := service.CancelTicket(1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, RefundPending, refund.Status)
+	assert.Equal(t, 7.5, refund.Amount)
+
+	_, err = service.CancelTicket(1, 1)
+	assert.ErrorIs(t, err, ErrTicketNotFound)
+
+	_, err = service.CancelTicket(1, 2)
+	assert.ErrorIs(t, err, ErrCancellationClosed)
+
+	_, err = service.CancelTicket(AnyUser, 2)
+	assert.NoError(t, err)
+
+	repo.err = errors.New("something went wrong")
+	_, err = service.CancelTicket(1, 3)
+	assert.ErrorIs(t, err, ErrInternalError)
+}
+
+func TestService_RunRefundWorker(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider mockRefunds
+		status   string
+	}{
+		{name: "refund succeeded", status: RefundSucceeded},
+		{name: "refund failed", provider: mockRefunds{err: errors.New("card closed")}, status: RefundPending},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMockRepository()
+			repo.tickets = map[int]time.Time{1: time.Now().Add(24 * time.Hour)}
+			service := New(repo, &mockTicketGenerator{}, storage.NewMemory(), mailer.NewMemory(), tt.provider)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go service.RunRefundWorker(ctx, time.Hour)
+
+			refund, err := service.CancelTicket(1, 1)
+			require.NoError(t, err)
+
+			assert.Eventually(t, func() bool {
+				return repo.refund(refund.Id).Attempts == 1
+			}, time.Second, 10*time.Millisecond)
+			assert.Equal(t, tt.status, repo.refund(refund.Id).Status)
+		})
+	}
+}
+
+func TestService_RetryRefund(t *testing.T) {
+	repo := newMockRepository()
+	repo.tickets = map[int]time.Time{1: time.Now().Add(24 * time.Hour), 2: time.Now().Add(24 * time.Hour)}
+	service := New(repo, &mockTicketGenerator{}, storage.NewMemory(), mailer.NewMemory(),
+		mockRefunds{err: errors.New("card closed")})
+	ctx := context.Background()
+
+	refund, err := service.CancelTicket(1, 1)
+	require.NoError(t, err)
+
+	service.processRefunds(ctx)
+	failed := repo.refund(refund.Id)
+	assert.Equal(t, RefundPending, failed.Status)
+	assert.Equal(t, "card closed", failed.Failure)
+	assert.True(t, failed.NextAttempt.After(time.Now()))
+
+	service.processRefunds(ctx)
+	assert.Equal(t, 1, repo.refund(refund.Id).Attempts, "refund retried before its next attempt")
+
+	for i := 1; i < maxRefundAttempts; i++ {
+		failed = repo.refund(refund.Id)
+		failed.NextAttempt = time.Now()
+		require.NoError(t, repo.UpdateRefund(failed))
+		service.processRefunds(ctx)
+	}
+	assert.Equal(t, RefundFailed, repo.refund(refund.Id).Status)
+	assert.Equal(t, maxRefundAttempts, repo.refund(refund.Id).Attempts)
+
+	// Refunds are keyed by their own id, so refunds of deleted tickets never
+	// share an idempotency key.
+	service = New(repo, &mockTicketGenerator{}, storage.NewMemory(), mailer.NewMemory(), mockRefunds{})
+	second, err := service.CancelTicket(1, 2)
+	require.NoError(t, err)
+	service.processRefunds(ctx)
+	assert.Equal(t, fmt.Sprintf("re_refund-%d", second.Id), repo.refund(second.Id).ProviderRef)
+}
+
+type failingSender struct{}
+
+func (failingSender) Send(msg mailer.Message) error {
+	return errors.New("connection refused")
+}
+
+func TestService_RunEmailWorker(t *testing.T) {
+	repo := newMockRepository()
+	m := mailer.NewMemory()
+	service := New(repo, &mockTicketGenerator{}, storage.NewMemory(), m, payment.NewFake())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go service.RunEmailWorker(ctx, time.Hour)
+
+	_, err := service.BuyTicket(ctx, 1, 1, 1)
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		return repo.email(1).Status == EmailSent
+	}, time.Second, 10*time.Millisecond)
+
+	messages := m.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, "user@example.com", messages[0].To)
+	assert.Equal(t, "Your tickets for Movie", messages[0].Subject)
+	require.Len(t, messages[0].Attachments, 2)
+	assert.Equal(t, pdfContentType, messages[0].Attachments[0].ContentType)
+	assert.Equal(t, "%PDF 1", string(messages[0].Attachments[0].Data))
+	assert.Contains(t, string(messages[0].Attachments[1].Data), "DTSTART:20230601T183000Z\r\n")
+}
+
+func TestService_RetryEmail(t *testing.T) {
+	repo := newMockRepository()
+	service := New(repo, &mockTicketGenerator{}, storage.NewMemory(), failingSender{}, payment.NewFake())
+	ctx := context.Background()
+
+	_, err := service.BuyTicket(ctx, 1, 1, 1)
+	require.NoError(t, err)
+
+	service.processEmails(ctx)
+	email := repo.email(1)
+	assert.Equal(t, EmailPending, email.Status)
+	assert.Equal(t, 1, email.Attempts)
+	assert.Equal(t, "connection refused", email.Failure)
+	assert.True(t, email.NextAttempt.After(time.Now()))
+
+	service.processEmails(ctx)
+	assert.Equal(t, 1, repo.email(1).Attempts, "email retried before its next attempt")
+
+	for i := 1; i < maxEmailAttempts; i++ {
+		email = repo.email(1)
+		email.NextAttempt = time.Now()
+		require.NoError(t, repo.UpdateTicketEmail(email))
+		service.processEmails(ctx)
+	}
+	assert.Equal(t, EmailFailed, repo.email(1).Status)
+	assert.Equal(t, maxEmailAttempts, repo.email(1).Attempts)
+}
+
+func TestCalendarInvite(t *testing.T) {
+	e := TicketEmail{
+		Id:         7,
+		MovieTitle: "Crouching Tiger, Hidden Dragon; the extended director's cut with a very long title",
+		HallName:   "Red",
+		StartTime:  time.Date(2023, 6, 1, 21, 30, 0, 0, time.FixedZone("UTC+3", 3*60*60)),
+		EndTime:    time.Date(2023, 6, 1, 23, 30, 0, 0, time.FixedZone("UTC+3", 3*60*60)),
+		Seats:      []int{4, 5},
+	}
+
+	invite := string(calendarInvite(e, time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)))
+
+	assert.Equal(t, "BEGIN:VCALENDAR\r\n"+
+		"VERSION:2.0\r\n"+
+		"PRODID:-//CinemaGo//Tickets//EN\r\n"+
+		"METHOD:PUBLISH\r\n"+
+		"BEGIN:VEVENT\r\n"+
+		"UID:ticket-email-7@cinemago\r\n"+
+		"DTSTAMP:20230501T120000Z\r\n"+
+		"DTSTART:20230601T183000Z\r\n"+
+		"DTEND:20230601T203000Z\r\n"+
+		"SUMMARY:Crouching Tiger\\, Hidden Dragon\\; the extended director's cut with \r\n"+
+		" a very long title\r\n"+
+		"LOCATION:Hall Red\r\n"+
+		"DESCRIPTION:Seats: 4\\, 5\r\n"+
+		"END:VEVENT\r\n"+
+		"END:VCALENDAR\r\n", invite)
+}
+
+func TestService_UserTickets(t *testing.T) {
+	repo := newMockRepository()
+	repo.details = []TicketDetails{
+		{Id: 1, UserId: 1, StartTime: time.Now().Add(-24 * time.Hour), Status: StatusActive},
+		{Id: 2, UserId: 1, StartTime: time.Now().Add(24 * time.Hour), Status: StatusActive},
+		{Id: 3, UserId: 2, StartTime: time.Now().Add(24 * time.Hour), Status: StatusActive},
+	}
+	service := New(repo, &mockTicketGenerator{}, storage.NewMemory(), mailer.NewMemory(), payment.NewFake())
+
+	tickets, total, err := service.UserTickets(TicketFilter{UserId: 1, Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, 2, total)
+	assert.Len(t, tickets, 2)
+
+	tickets, _, err = service.UserTickets(TicketFilter{UserId: 1, Period: PeriodUpcoming, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, tickets, 1)
+	assert.Equal(t, 2, tickets[0].Id)
+
+	tickets, _, err = service.UserTickets(TicketFilter{UserId: 1, Period: PeriodPast, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, tickets, 1)
+	assert.Equal(t, 1, tickets[0].Id)
+
+	_, _, err = service.UserTickets(TicketFilter{UserId: 1, Period: "tomorrow"})
+	assert.ErrorIs(t, err, ErrInvalidPeriod)
+
+	repo.err = errors.New("something went wrong")
+	_, _, err = service.UserTickets(TicketFilter{UserId: 1})
+	assert.ErrorIs(t, err, ErrInternalError)
+}
+
+func TestService_TicketDetails(t *testing.T) {
+	repo := newMockRepository()
+	repo.details = []TicketDetails{{Id: 3, UserId: 2, HallName: "Red", SeatNumber: 4}}
+	service := New(repo, &mockTicketGenerator{}, storage.NewMemory(), mailer.NewMemory(), payment.NewFake())
+
+	ticket, err := service.TicketDetails(3, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "Red", ticket.HallName)
+
+	_, err = service.TicketDetails(3, 1)
+	assert.ErrorIs(t, err, ErrTicketNotFound)
+
+	ticket, err = service.TicketDetails(3, AnyUser)
+	require.NoError(t, err)
+	assert.Equal(t, 4, ticket.SeatNumber)
+}
+
+func TestService_TicketURL(t *testing.T) {
+	repo := newMockRepository()
+	repo.details = []TicketDetails{{Id: 3, UserId: 2}, {Id: 4, UserId: 2}}
+	repo.files = map[int]string{3: "abc"}
+	files := storage.NewMemory()
+	service := New(repo, &mockTicketGenerator{}, files, mailer.NewMemory(), payment.NewFake()).
+		WithTicketURLTTL(time.Minute)
+	ctx := context.Background()
+	require.NoError(t, files.Put(ctx, "abc", strings.NewReader("%PDF"), 4, "application/pdf"))
+
+	url, err := service.TicketURL(ctx, 3, 2)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(url, "memory:///abc?expires="), url)
+
+	_, err = service.TicketURL(ctx, 3, 1)
+	assert.ErrorIs(t, err, ErrTicketNotFound)
+
+	_, err = service.TicketURL(ctx, 4, 2)
+	assert.ErrorIs(t, err, ErrTicketFileNotFound)
+}
+
+func TestService_ValidateTicket(t *testing.T) {
+	repo := newMockRepository()
+	repo.details = []TicketDetails{
+		{Id: 1, SessionId: 2, SeatNumber: 3, StartTime: time.Now().Add(10 * time.Minute)},
+		{Id: 2, SessionId: 2, SeatNumber: 4, StartTime: time.Now().Add(2 * time.Hour)},
+	}
+	service := New(repo, &mockTicketGenerator{}, storage.NewMemory(), mailer.NewMemory(), payment.NewFake()).
+		WithSigningKey([]byte("secret")).
+		WithAdmissionWindow(30 * time.Minute)
+
+	code := service.TicketCode(Ticket{Id: 1, SessionId: 2, SeatNumber: 3})
+
+	ticket, err := service.ValidateTicket(code)
+	require.NoError(t, err)
+	assert.Equal(t, 1, ticket.Id)
+
+	_, err = service.ValidateTicket(code)
+	assert.ErrorIs(t, err, ErrTicketAdmitted)
+
+	_, err = service.ValidateTicket(service.TicketCode(Ticket{Id: 2, SessionId: 2, SeatNumber: 4}))
+	assert.ErrorIs(t, err, ErrAdmissionClosed)
+
+	_, err = service.ValidateTicket(service.TicketCode(Ticket{Id: 1, SessionId: 2, SeatNumber: 5}))
+	assert.ErrorIs(t, err, ErrInvalidTicketCode)
+
+	forged := New(repo, &mockTicketGenerator{}, storage.NewMemory(), mailer.NewMemory(), payment.NewFake()).
+		WithSigningKey([]byte("other")).TicketCode(Ticket{Id: 2, SessionId: 2, SeatNumber: 4})
+	_, err = service.ValidateTicket(forged)
+	assert.ErrorIs(t, err, ErrInvalidTicketCode)
+
+	for _, code := range []string{"", "1.2.3", "1.2.x.abc", "garbage"} {
+		_, err = service.ValidateTicket(code)
+		assert.ErrorIs(t, err, ErrInvalidTicketCode)
+	}
+}
@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/apiutils"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/user/service"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultLimit = 10
+	maxLimit     = 100
+)
+
+var (
+	ErrInvalidOffset = errors.New("invalid offset parameter")
+	ErrInvalidLimit  = errors.New("invalid limit parameter")
+)
+
+type user struct {
+	ID            int        `json:"userId"`
+	Username      string     `json:"username"`
+	Email         string     `json:"email,omitempty"`
+	EmailVerified bool       `json:"emailVerified"`
+	DisplayName   string     `json:"displayName,omitempty"`
+	Roles         []string   `json:"roles"`
+	Disabled      bool       `json:"disabled"`
+	DisabledAt    *time.Time `json:"disabledAt,omitempty"`
+	TicketCount   *int       `json:"ticketCount,omitempty"`
+}
+
+type userList struct {
+	Users  []user `json:"users"`
+	Total  int    `json:"total"`
+	Offset int    `json:"offset"`
+	Limit  int    `json:"limit"`
+}
+
+func (h HttpHandler) getUsersHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := service.UserFilter{
+		Username: query.Get("username"),
+		Email:    query.Get("email"),
+		Role:     query.Get("role"),
+		Limit:    defaultLimit,
+	}
+
+	var err error
+	if offset := query.Get("offset"); offset != "" {
+		if filter.Offset, err = strconv.Atoi(offset); err != nil || filter.Offset < 0 {
+			http.Error(w, ErrInvalidOffset.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit <= 0 || filter.Limit > maxLimit {
+			http.Error(w, ErrInvalidLimit.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	users, total, err := h.s.Users(filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	list := userList{Users: make([]user, 0, len(users)), Total: total, Offset: filter.Offset, Limit: filter.Limit}
+	for _, u := range users {
+		list.Users = append(list.Users, userToDTO(u, false))
+	}
+
+	apiutils.WriteResponse(w, list, http.StatusOK)
+}
+
+func (h HttpHandler) getUserHandler(w http.ResponseWriter, r *http.Request) {
+	userId, err := apiutils.IntPathParam(r, "userId")
+	if err != nil {
+		http.Error(w, ErrInvalidUserId.Error(), http.StatusBadRequest)
+		return
+	}
+
+	u, err := h.s.User(userId)
+	if errors.Is(err, service.ErrUserNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	apiutils.WriteResponse(w, userToDTO(u, true), http.StatusOK)
+}
+
+func (h HttpHandler) revokeAdminHandler(w http.ResponseWriter, r *http.Request) {
+	h.adminAction(w, r, func(adminId, userId int) error {
+		return h.s.RevokeAdmin(adminId, userId)
+	})
+}
+
+func (h HttpHandler) disableUserHandler(w http.ResponseWriter, r *http.Request) {
+	h.adminAction(w, r, func(adminId, userId int) error {
+		return h.s.SetDisabled(adminId, userId, true)
+	})
+}
+
+func (h HttpHandler) enableUserHandler(w http.ResponseWriter, r *http.Request) {
+	h.adminAction(w, r, func(adminId, userId int) error {
+		return h.s.SetDisabled(adminId, userId, false)
+	})
+}
+
+func (h HttpHandler) adminAction(w http.ResponseWriter, r *http.Request, action func(adminId, userId int) error) {
+	userId, err := apiutils.IntPathParam(r, "userId")
+	if err != nil {
+		http.Error(w, ErrInvalidUserId.Error(), http.StatusBadRequest)
+		return
+	}
+
+	adminId := r.Context().Value("userID").(int)
+
+	err = action(adminId, userId)
+	if errors.Is(err, service.ErrUserNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if errors.Is(err, service.ErrSelfAction) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func userToDTO(u service.User, withTickets bool) user {
+	dto := user{
+		ID:            u.ID,
+		Username:      u.Username,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerified,
+		DisplayName:   u.DisplayName,
+		Roles:         u.Roles,
+		Disabled:      u.DisabledAt != nil,
+		DisabledAt:    u.DisabledAt,
+	}
+	if dto.Roles == nil {
+		dto.Roles = []string{}
+	}
+	if withTickets {
+		ticketCount := u.TicketCount
+		dto.TicketCount = &ticketCount
+	}
+	return dto
+}
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"archive/zip"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/apiutils"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/user/service"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+var ErrInvalidExportFormat = errors.New("format must be json or zip")
+
+const exportFileName = "export.json"
+
+type ticketRecord struct {
+	ID         int       `json:"ticketId"`
+	SessionID  int       `json:"sessionId"`
+	MovieTitle string    `json:"movieTitle"`
+	HallID     int       `json:"hallId"`
+	HallName   string    `json:"hallName"`
+	StartTime  time.Time `json:"startTime"`
+	SeatNumber int       `json:"seatNumber"`
+	Price      float64   `json:"price"`
+	Status     string    `json:"status"`
+}
+
+type sessionRecord struct {
+	ID         int       `json:"sessionId"`
+	MovieTitle string    `json:"movieTitle"`
+	HallName   string    `json:"hallName"`
+	StartTime  time.Time `json:"startTime"`
+}
+
+type watchedMovie struct {
+	ID          int    `json:"id"`
+	Title       string `json:"title"`
+	Genre       string `json:"genre"`
+	ReleaseDate string `json:"releaseDate"`
+	Duration    int    `json:"duration"`
+}
+
+type export struct {
+	GeneratedAt      time.Time       `json:"generatedAt"`
+	Profile          profile         `json:"profile"`
+	Tickets          []ticketRecord  `json:"tickets"`
+	SessionsAttended []sessionRecord `json:"sessionsAttended"`
+	WatchedMovies    []watchedMovie  `json:"watchedMovies"`
+}
+
+func (h HttpHandler) exportHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "zip" {
+		http.Error(w, ErrInvalidExportFormat.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+
+	e, err := h.s.Export(userID)
+	if errors.Is(err, service.ErrUserNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if format != "zip" {
+		apiutils.WriteResponse(w, exportToDTO(e), http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="export.zip"`)
+	w.WriteHeader(http.StatusOK)
+
+	zw := zip.NewWriter(w)
+	f, err := zw.Create(exportFileName)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(exportToDTO(e)); err != nil {
+		log.Println(err)
+		return
+	}
+	if err = zw.Close(); err != nil {
+		log.Println(err)
+	}
+}
+
+func (h HttpHandler) eraseUserHandler(w http.ResponseWriter, r *http.Request) {
+	userId, err := apiutils.IntPathParam(r, "userId")
+	if err != nil {
+		http.Error(w, ErrInvalidUserId.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.s.EraseUser(r.Context(), userId)
+	if errors.Is(err, service.ErrUserNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func exportToDTO(e service.Export) export {
+	dto := export{
+		GeneratedAt:      e.GeneratedAt,
+		Profile:          profileToDTO(e.Profile),
+		Tickets:          make([]ticketRecord, 0, len(e.Tickets)),
+		SessionsAttended: make([]sessionRecord, 0, len(e.SessionsAttended)),
+		WatchedMovies:    make([]watchedMovie, 0, len(e.WatchedMovies)),
+	}
+
+	for _, t := range e.Tickets {
+		dto.Tickets = append(dto.Tickets, ticketRecord(t))
+	}
+	for _, s := range e.SessionsAttended {
+		dto.SessionsAttended = append(dto.SessionsAttended, sessionRecord(s))
+	}
+	for _, m := range e.WatchedMovies {
+		dto.WatchedMovies = append(dto.WatchedMovies, watchedMovie{
+			ID:          m.Id,
+			Title:       m.Title,
+			Genre:       m.Genre,
+			ReleaseDate: m.ReleaseDate,
+			Duration:    m.Duration,
+		})
+	}
+
+	return dto
+}
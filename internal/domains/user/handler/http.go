@@ -3,24 +3,32 @@ package handler
 import (
 	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/apiutils"
 	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/user/service"
+	"context"
 	"encoding/json"
 	"errors"
 	"github.com/gorilla/mux"
 	"io"
 	"log"
 	"net/http"
+	"net/mail"
 )
 
+const maxEmailLength = 50
+
 var (
 	ErrReadRequestFail = errors.New("failed to read request body")
 	ErrNoUsername      = errors.New("missing username")
 	ErrNoPassword      = errors.New("missing password")
+	ErrNoEmail         = errors.New("missing email")
+	ErrInvalidEmail    = errors.New("invalid email")
 	ErrInvalidUserId   = errors.New("invalid user id")
+	ErrNoToken         = errors.New("missing token")
 )
 
 type credentials struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	Email    string `json:"email"`
 }
 
 type accessChecker interface {
@@ -29,8 +37,19 @@ type accessChecker interface {
 }
 
 type Service interface {
-	CreateUser(username string, passwordHash string) (userId int, err error)
+	CreateUser(username string, password string, email string) (userId int, err error)
+	ResendVerification(userId int) error
+	VerifyEmail(token string) error
 	MakeAdmin(userId int) error
+	Profile(userId int) (service.Profile, error)
+	UpdateProfile(userId int, update service.ProfileUpdate) (service.Profile, error)
+	ChangePassword(userId int, currentPassword string, newPassword string) error
+	Export(userId int) (service.Export, error)
+	EraseUser(ctx context.Context, userId int) error
+	Users(filter service.UserFilter) ([]service.User, int, error)
+	User(userId int) (service.User, error)
+	RevokeAdmin(adminId int, userId int) error
+	SetDisabled(adminId int, userId int, disabled bool) error
 }
 
 type HttpHandler struct {
@@ -46,13 +65,28 @@ func New(router *mux.Router, s Service) HttpHandler {
 func (h HttpHandler) SetRoutes(router *mux.Router, a accessChecker) {
 	allRouter := router.PathPrefix("/users").Subrouter()
 	allRouter.HandleFunc("/", h.createUserHandler).Methods(http.MethodPost)
+	allRouter.HandleFunc("/verify-email", h.verifyEmailHandler).Methods(http.MethodGet)
+
+	userRouter := router.PathPrefix("/users").Subrouter()
+	userRouter.Use(a.Authenticate)
+	userRouter.HandleFunc("/verify-email/resend", h.resendVerificationHandler).Methods(http.MethodPost)
+	userRouter.HandleFunc("/me", h.getProfileHandler).Methods(http.MethodGet)
+	userRouter.HandleFunc("/me", h.updateProfileHandler).Methods(http.MethodPatch)
+	userRouter.HandleFunc("/me/password", h.changePasswordHandler).Methods(http.MethodPut)
+	userRouter.HandleFunc("/me", h.deleteProfileHandler).Methods(http.MethodDelete)
+	userRouter.HandleFunc("/me/export", h.exportHandler).Methods(http.MethodGet)
 
 	adminRouter := router.PathPrefix("/users").Subrouter()
 	adminRouter.Use(a.Authenticate)
-	adminRouter.Use(a.CheckPerms(service.AdminRoleName))
+	adminRouter.Use(a.CheckPerms(service.WritePermission))
 
+	adminRouter.HandleFunc("/", h.getUsersHandler).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/{userId}", h.getUserHandler).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/{userId}", h.eraseUserHandler).Methods(http.MethodDelete)
 	adminRouter.HandleFunc("/{userId}/grant-admin", h.makeUserAdmin).Methods(http.MethodPut)
-
+	adminRouter.HandleFunc("/{userId}/revoke-admin", h.revokeAdminHandler).Methods(http.MethodPut)
+	adminRouter.HandleFunc("/{userId}/disable", h.disableUserHandler).Methods(http.MethodPut)
+	adminRouter.HandleFunc("/{userId}/enable", h.enableUserHandler).Methods(http.MethodPut)
 }
 
 func (h HttpHandler) makeUserAdmin(w http.ResponseWriter, r *http.Request) {
@@ -97,8 +131,8 @@ func (h HttpHandler) createUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id, err := h.s.CreateUser(creds.Username, creds.Password)
-	if errors.Is(err, service.ErrUserExists) {
+	id, err := h.s.CreateUser(creds.Username, creds.Password, creds.Email)
+	if errors.Is(err, service.ErrUserExists) || errors.Is(err, service.ErrEmailExists) {
 		log.Println(err)
 		http.Error(w, err.Error(), http.StatusConflict)
 		return
@@ -113,11 +147,61 @@ func (h HttpHandler) createUserHandler(w http.ResponseWriter, r *http.Request) {
 	apiutils.WriteResponse(w, map[string]int{"userId": id}, http.StatusCreated)
 }
 
+func (h HttpHandler) verifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, ErrNoToken.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := h.s.VerifyEmail(token)
+	if errors.Is(err, service.ErrInvalidToken) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h HttpHandler) resendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	err := h.s.ResendVerification(userID)
+	if errors.Is(err, service.ErrUserNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if errors.Is(err, service.ErrAlreadyVerified) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
 func (c credentials) validate() error {
 	if c.Username == "" {
 		return ErrNoUsername
 	} else if c.Password == "" {
 		return ErrNoPassword
+	} else if c.Email == "" {
+		return ErrNoEmail
+	}
+
+	addr, err := mail.ParseAddress(c.Email)
+	if err != nil || addr.Address != c.Email || len(c.Email) > maxEmailLength {
+		return ErrInvalidEmail
 	}
 	return nil
 }
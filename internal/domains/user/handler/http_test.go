@@ -1,7 +1,12 @@
 package handler
 
 import (
+	"archive/zip"
 	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/user/service"
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"net/http"
@@ -15,17 +20,78 @@ type mockService struct {
 	userId int
 }
 
-func (m mockService) CreateUser(username string, passwordHash string) (int, error) {
+func (m mockService) CreateUser(username string, password string, email string) (int, error) {
 	return m.userId, m.err
 }
 
+func (m mockService) ResendVerification(userId int) error {
+	return m.err
+}
+
+func (m mockService) VerifyEmail(token string) error {
+	return m.err
+}
+
+func (m mockService) MakeAdmin(userId int) error {
+	return m.err
+}
+
+func (m mockService) Profile(userId int) (service.Profile, error) {
+	return service.Profile{ID: userId, Username: "test_user", Email: "test@example.com", EmailVerified: true}, m.err
+}
+
+func (m mockService) UpdateProfile(userId int, update service.ProfileUpdate) (service.Profile, error) {
+	p := service.Profile{ID: userId, Username: "test_user", Email: "test@example.com"}
+	if update.DisplayName != nil {
+		p.DisplayName = *update.DisplayName
+	}
+	return p, m.err
+}
+
+func (m mockService) ChangePassword(userId int, currentPassword string, newPassword string) error {
+	return m.err
+}
+
+func (m mockService) Export(userId int) (service.Export, error) {
+	return service.Export{
+		Profile: service.Profile{ID: userId, Username: "test_user"},
+		Tickets: []service.TicketRecord{{ID: 1, SessionID: 2, MovieTitle: "Movie", SeatNumber: 5, Price: 7.5}},
+	}, m.err
+}
+
+func (m mockService) EraseUser(ctx context.Context, userId int) error {
+	return m.err
+}
+
+func (m mockService) Users(filter service.UserFilter) ([]service.User, int, error) {
+	return []service.User{{ID: 1, Username: "admin", Roles: []string{"admin"}}}, 1, m.err
+}
+
+func (m mockService) User(userId int) (service.User, error) {
+	return service.User{ID: userId, Username: "test_user", Roles: []string{"user"}, TicketCount: 2}, m.err
+}
+
+func (m mockService) RevokeAdmin(adminId int, userId int) error {
+	if adminId == userId {
+		return service.ErrSelfAction
+	}
+	return m.err
+}
+
+func (m mockService) SetDisabled(adminId int, userId int, disabled bool) error {
+	if adminId == userId {
+		return service.ErrSelfAction
+	}
+	return m.err
+}
+
 func TestCreateUserHandler(t *testing.T) {
 	s := mockService{}
 	t.Run("successful registration", func(t *testing.T) {
 		s.err = nil
 		s.userId = 1
 		req, err := http.NewRequest(http.MethodPost, "users/",
-			strings.NewReader(`{"username": "test_user", "password": "test_password"}`))
+			strings.NewReader(`{"username": "test_user", "password": "test_password", "email": "test@example.com"}`))
 		require.NoError(t, err, "failed to create test request")
 
 		response := httptest.NewRecorder()
@@ -62,10 +128,49 @@ func TestCreateUserHandler(t *testing.T) {
 		assert.Equal(t, http.StatusBadRequest, response.Code)
 	})
 
+	t.Run("missing email", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "users/",
+			strings.NewReader(`{"username": "test_user", "password": "test_password"}`))
+		require.NoError(t, err, "failed to create test request")
+
+		response := httptest.NewRecorder()
+		handler := HttpHandler{s: s}.createUserHandler
+		handler(response, req)
+
+		assert.Equal(t, ErrNoEmail.Error()+"\n", response.Body.String())
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+	})
+
+	t.Run("invalid email", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "users/",
+			strings.NewReader(`{"username": "test_user", "password": "test_password", "email": "Test <test@example.com>"}`))
+		require.NoError(t, err, "failed to create test request")
+
+		response := httptest.NewRecorder()
+		handler := HttpHandler{s: s}.createUserHandler
+		handler(response, req)
+
+		assert.Equal(t, ErrInvalidEmail.Error()+"\n", response.Body.String())
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+	})
+
+	t.Run("email in use", func(t *testing.T) {
+		s.err = service.ErrEmailExists
+		req, err := http.NewRequest(http.MethodPost, "users/",
+			strings.NewReader(`{"username": "test_user", "password": "test_password", "email": "test@example.com"}`))
+		require.NoError(t, err, "failed to create test request")
+
+		response := httptest.NewRecorder()
+		handler := HttpHandler{s: s}.createUserHandler
+		handler(response, req)
+
+		assert.Equal(t, http.StatusConflict, response.Code)
+	})
+
 	t.Run("user creation fail", func(t *testing.T) {
 		s.err = service.ErrInternalError
 		req, err := http.NewRequest(http.MethodPost, "users/",
-			strings.NewReader(`{"username": "test_user", "password": "test_password"}`))
+			strings.NewReader(`{"username": "test_user", "password": "test_password", "email": "test@example.com"}`))
 		require.NoError(t, err, "failed to create test request")
 
 		response := httptest.NewRecorder()
@@ -76,3 +181,284 @@ func TestCreateUserHandler(t *testing.T) {
 		assert.Equal(t, http.StatusInternalServerError, response.Code)
 	})
 }
+
+func TestVerifyEmailHandler(t *testing.T) {
+	s := mockService{}
+	t.Run("successful verification", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "users/verify-email?token=test_token", nil)
+		require.NoError(t, err, "failed to create test request")
+
+		response := httptest.NewRecorder()
+		handler := HttpHandler{s: s}.verifyEmailHandler
+		handler(response, req)
+
+		assert.Equal(t, http.StatusNoContent, response.Code)
+	})
+
+	t.Run("missing token", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "users/verify-email", nil)
+		require.NoError(t, err, "failed to create test request")
+
+		response := httptest.NewRecorder()
+		handler := HttpHandler{s: s}.verifyEmailHandler
+		handler(response, req)
+
+		assert.Equal(t, ErrNoToken.Error()+"\n", response.Body.String())
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		s.err = service.ErrInvalidToken
+		req, err := http.NewRequest(http.MethodGet, "users/verify-email?token=test_token", nil)
+		require.NoError(t, err, "failed to create test request")
+
+		response := httptest.NewRecorder()
+		handler := HttpHandler{s: s}.verifyEmailHandler
+		handler(response, req)
+
+		assert.Equal(t, service.ErrInvalidToken.Error()+"\n", response.Body.String())
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+	})
+}
+
+func withUser(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), "userID", 1))
+}
+
+func TestProfileHandlers(t *testing.T) {
+	t.Run("get profile", func(t *testing.T) {
+		req := withUser(httptest.NewRequest(http.MethodGet, "/users/me", nil))
+
+		response := httptest.NewRecorder()
+		HttpHandler{s: mockService{}}.getProfileHandler(response, req)
+
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.JSONEq(t, `{"userId":1,"username":"test_user","email":"test@example.com","emailVerified":true}`,
+			response.Body.String())
+	})
+
+	t.Run("update display name", func(t *testing.T) {
+		req := withUser(httptest.NewRequest(http.MethodPatch, "/users/me",
+			strings.NewReader(`{"displayName": "Test User"}`)))
+
+		response := httptest.NewRecorder()
+		HttpHandler{s: mockService{}}.updateProfileHandler(response, req)
+
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Contains(t, response.Body.String(), `"displayName":"Test User"`)
+	})
+
+	tests := []struct {
+		name string
+		body string
+		err  error
+		code int
+	}{
+		{name: "empty username", body: `{"username": ""}`, code: http.StatusBadRequest},
+		{name: "invalid email", body: `{"email": "not an email"}`, code: http.StatusBadRequest},
+		{name: "username taken", body: `{"username": "taken"}`, err: service.ErrUserExists, code: http.StatusConflict},
+		{name: "email taken", body: `{"email": "taken@example.com"}`, err: service.ErrEmailExists,
+			code: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := withUser(httptest.NewRequest(http.MethodPatch, "/users/me", strings.NewReader(tt.body)))
+
+			response := httptest.NewRecorder()
+			HttpHandler{s: mockService{err: tt.err}}.updateProfileHandler(response, req)
+
+			assert.Equal(t, tt.code, response.Code)
+		})
+	}
+
+	t.Run("delete account", func(t *testing.T) {
+		req := withUser(httptest.NewRequest(http.MethodDelete, "/users/me", nil))
+
+		response := httptest.NewRecorder()
+		HttpHandler{s: mockService{}}.deleteProfileHandler(response, req)
+
+		assert.Equal(t, http.StatusNoContent, response.Code)
+	})
+}
+
+func TestChangePasswordHandler(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		err  error
+		code int
+	}{
+		{name: "password changed", body: `{"currentPassword": "old", "newPassword": "new"}`,
+			code: http.StatusNoContent},
+		{name: "missing current password", body: `{"newPassword": "new"}`, code: http.StatusBadRequest},
+		{name: "missing new password", body: `{"currentPassword": "old"}`, code: http.StatusBadRequest},
+		{name: "wrong current password", body: `{"currentPassword": "wrong", "newPassword": "new"}`,
+			err: service.ErrInvalidPassword, code: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/users/me/password", strings.NewReader(tt.body))
+			req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+
+			response := httptest.NewRecorder()
+			HttpHandler{s: mockService{err: tt.err}}.changePasswordHandler(response, req)
+
+			assert.Equal(t, tt.code, response.Code)
+		})
+	}
+}
+
+func TestGetUsersHandler(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		code  int
+	}{
+		{name: "default page", query: "", code: http.StatusOK},
+		{name: "filtered page", query: "?username=adm&role=admin&offset=0&limit=20", code: http.StatusOK},
+		{name: "negative offset", query: "?offset=-1", code: http.StatusBadRequest},
+		{name: "limit too big", query: "?limit=1000", code: http.StatusBadRequest},
+		{name: "invalid limit", query: "?limit=abc", code: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users/"+tt.query, nil)
+
+			response := httptest.NewRecorder()
+			HttpHandler{s: mockService{}}.getUsersHandler(response, req)
+
+			assert.Equal(t, tt.code, response.Code)
+		})
+	}
+
+	t.Run("response body", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/users/", nil)
+
+		response := httptest.NewRecorder()
+		HttpHandler{s: mockService{}}.getUsersHandler(response, req)
+
+		assert.JSONEq(t, `{"users":[{"userId":1,"username":"admin","emailVerified":false,"roles":["admin"],
+			"disabled":false}],"total":1,"offset":0,"limit":10}`, response.Body.String())
+	})
+}
+
+func TestGetUserHandler(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/users/3", nil)
+	req = mux.SetURLVars(req, map[string]string{"userId": "3"})
+
+	response := httptest.NewRecorder()
+	HttpHandler{s: mockService{}}.getUserHandler(response, req)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Contains(t, response.Body.String(), `"ticketCount":2`)
+}
+
+func TestAdminActionHandlers(t *testing.T) {
+	tests := []struct {
+		name   string
+		userId string
+		err    error
+		code   int
+	}{
+		{name: "successful action", userId: "3", code: http.StatusOK},
+		{name: "acting on yourself", userId: "1", code: http.StatusConflict},
+		{name: "user not found", userId: "3", err: service.ErrUserNotFound, code: http.StatusNotFound},
+		{name: "invalid user id", userId: "abc", code: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		for name, handler := range map[string]func(HttpHandler) http.HandlerFunc{
+			"revoke admin": func(h HttpHandler) http.HandlerFunc { return h.revokeAdminHandler },
+			"disable":      func(h HttpHandler) http.HandlerFunc { return h.disableUserHandler },
+			"enable":       func(h HttpHandler) http.HandlerFunc { return h.enableUserHandler },
+		} {
+			t.Run(name+": "+tt.name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodPut, "/users/"+tt.userId, nil)
+				req = mux.SetURLVars(req, map[string]string{"userId": tt.userId})
+				req = req.WithContext(context.WithValue(req.Context(), "userID", 1))
+
+				response := httptest.NewRecorder()
+				handler(HttpHandler{s: mockService{err: tt.err}})(response, req)
+
+				assert.Equal(t, tt.code, response.Code)
+			})
+		}
+	}
+}
+
+func TestExportHandler(t *testing.T) {
+	t.Run("json export", func(t *testing.T) {
+		req := withUser(httptest.NewRequest(http.MethodGet, "/users/me/export", nil))
+
+		response := httptest.NewRecorder()
+		HttpHandler{s: mockService{}}.exportHandler(response, req)
+
+		require.Equal(t, http.StatusOK, response.Code)
+		var e export
+		require.NoError(t, json.Unmarshal(response.Body.Bytes(), &e))
+		assert.Equal(t, "test_user", e.Profile.Username)
+		assert.Equal(t, []ticketRecord{{ID: 1, SessionID: 2, MovieTitle: "Movie", SeatNumber: 5, Price: 7.5}},
+			e.Tickets)
+		assert.Equal(t, []sessionRecord{}, e.SessionsAttended)
+	})
+
+	t.Run("zip export", func(t *testing.T) {
+		req := withUser(httptest.NewRequest(http.MethodGet, "/users/me/export?format=zip", nil))
+
+		response := httptest.NewRecorder()
+		HttpHandler{s: mockService{}}.exportHandler(response, req)
+
+		require.Equal(t, http.StatusOK, response.Code)
+		assert.Equal(t, "application/zip", response.Header().Get("Content-Type"))
+
+		body := response.Body.Bytes()
+		zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		require.NoError(t, err)
+		require.Len(t, zr.File, 1)
+		assert.Equal(t, "export.json", zr.File[0].Name)
+
+		f, err := zr.File[0].Open()
+		require.NoError(t, err)
+		defer f.Close()
+		var e export
+		require.NoError(t, json.NewDecoder(f).Decode(&e))
+		assert.Equal(t, "test_user", e.Profile.Username)
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+		req := withUser(httptest.NewRequest(http.MethodGet, "/users/me/export?format=xml", nil))
+
+		response := httptest.NewRecorder()
+		HttpHandler{s: mockService{}}.exportHandler(response, req)
+
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+	})
+}
+
+func TestEraseUserHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		userId string
+		err    error
+		code   int
+	}{
+		{name: "user erased", userId: "3", code: http.StatusNoContent},
+		{name: "invalid user id", userId: "abc", code: http.StatusBadRequest},
+		{name: "user not found", userId: "3", err: service.ErrUserNotFound, code: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := withUser(httptest.NewRequest(http.MethodDelete, "/users/"+tt.userId, nil))
+			req = mux.SetURLVars(req, map[string]string{"userId": tt.userId})
+
+			response := httptest.NewRecorder()
+			HttpHandler{s: mockService{err: tt.err}}.eraseUserHandler(response, req)
+
+			assert.Equal(t, tt.code, response.Code)
+		})
+	}
+}
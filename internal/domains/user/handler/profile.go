@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/apiutils"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/user/service"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/mail"
+)
+
+const maxNameLength = 50
+
+var (
+	ErrInvalidUsername    = errors.New("username must be 1 to 50 characters long")
+	ErrInvalidDisplayName = errors.New("display name must be at most 50 characters long")
+	ErrNoNewPassword      = errors.New("missing new password")
+)
+
+type profile struct {
+	ID            int    `json:"userId"`
+	Username      string `json:"username"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified bool   `json:"emailVerified"`
+	DisplayName   string `json:"displayName,omitempty"`
+}
+
+type profileUpdate struct {
+	Username    *string `json:"username"`
+	Email       *string `json:"email"`
+	DisplayName *string `json:"displayName"`
+}
+
+type passwordChange struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+func (h HttpHandler) getProfileHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	p, err := h.s.Profile(userID)
+	if errors.Is(err, service.ErrUserNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	apiutils.WriteResponse(w, profileToDTO(p), http.StatusOK)
+}
+
+func (h HttpHandler) updateProfileHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	var req profileUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, ErrReadRequestFail.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p, err := h.s.UpdateProfile(userID, service.ProfileUpdate{
+		Username:    req.Username,
+		Email:       req.Email,
+		DisplayName: req.DisplayName,
+	})
+	if errors.Is(err, service.ErrUserNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if errors.Is(err, service.ErrUserExists) || errors.Is(err, service.ErrEmailExists) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	apiutils.WriteResponse(w, profileToDTO(p), http.StatusOK)
+}
+
+func (h HttpHandler) changePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	var req passwordChange
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, ErrReadRequestFail.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.CurrentPassword == "" {
+		http.Error(w, ErrNoPassword.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.NewPassword == "" {
+		http.Error(w, ErrNoNewPassword.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := h.s.ChangePassword(userID, req.CurrentPassword, req.NewPassword)
+	if errors.Is(err, service.ErrInvalidPassword) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if errors.Is(err, service.ErrUserNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h HttpHandler) deleteProfileHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	err := h.s.EraseUser(r.Context(), userID)
+	if errors.Is(err, service.ErrUserNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p profileUpdate) validate() error {
+	if p.Username != nil && (*p.Username == "" || len(*p.Username) > maxNameLength) {
+		return ErrInvalidUsername
+	}
+
+	if p.Email != nil {
+		addr, err := mail.ParseAddress(*p.Email)
+		if err != nil || addr.Address != *p.Email || len(*p.Email) > maxEmailLength {
+			return ErrInvalidEmail
+		}
+	}
+
+	if p.DisplayName != nil && len(*p.DisplayName) > maxNameLength {
+		return ErrInvalidDisplayName
+	}
+
+	return nil
+}
+
+func profileToDTO(p service.Profile) profile {
+	return profile{
+		ID:            p.ID,
+		Username:      p.Username,
+		Email:         p.Email,
+		EmailVerified: p.EmailVerified,
+		DisplayName:   p.DisplayName,
+	}
+}
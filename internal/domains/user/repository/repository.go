@@ -5,7 +5,9 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/lib/pq"
 	"log"
+	"time"
 )
 
 type UserRepository struct {
@@ -16,7 +18,7 @@ func New(db *sql.DB) UserRepository {
 	return UserRepository{db: db}
 }
 
-func (u UserRepository) CreateUser(username string, passwordHash string) (userId int, err error) {
+func (u UserRepository) CreateUser(username string, passwordHash string, email string) (userId int, err error) {
 	err = u.db.QueryRow("SELECT user_id FROM users WHERE username = $1", username).
 		Scan(&userId)
 	if err == nil {
@@ -27,28 +29,491 @@ func (u UserRepository) CreateUser(username string, passwordHash string) (userId
 			username, err)
 	}
 
-	err = u.db.QueryRow("INSERT INTO users (username, hashed_password, role_id) "+
-		"VALUES ($1, $2, $3) RETURNING user_id", username, passwordHash, service.UserRoleId).Scan(&userId)
+	tx, err := u.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Println(err)
+		}
+	}()
+
+	err = tx.QueryRow("INSERT INTO users (username, hashed_password, email) "+
+		"VALUES ($1, $2, $3) RETURNING user_id", username, passwordHash, email).Scan(&userId)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "users_email_key" {
+		return 0, fmt.Errorf("%w: %q", service.ErrEmailExists, email)
+	}
 	if err != nil {
 		return 0, fmt.Errorf("could not create user: %w", err)
 	}
 
+	_, err = tx.Exec(`INSERT INTO user_roles (user_id, role_id)
+						SELECT $1, role_id FROM roles WHERE role_name = $2`, userId, service.UserRoleName)
+	if err != nil {
+		return 0, fmt.Errorf("could not assign role to user: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("could not create user: %w", err)
+	}
+
 	return userId, nil
 }
 
 func (u UserRepository) MakeAdmin(userId int) (bool, error) {
-	res, err := u.db.Exec(`UPDATE users
-						SET role_id = $1
-						WHERE user_id = $2`, service.AdminRoleId, userId)
+	var exists bool
+	err := u.db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE user_id = $1)", userId).Scan(&exists)
+	if err != nil {
+		log.Println(err)
+		return false, fmt.Errorf("failed to check if user exists: %w", err)
+	}
+	if !exists {
+		return false, nil
+	}
+
+	_, err = u.db.Exec(`INSERT INTO user_roles (user_id, role_id)
+						SELECT $1, role_id FROM roles WHERE role_name = $2
+						ON CONFLICT DO NOTHING`, userId, service.AdminRoleName)
 	if err != nil {
 		log.Println(err)
 		return false, fmt.Errorf("failed to make user an admin: %w", err)
 	}
 
+	return true, nil
+}
+
+func (u UserRepository) UserEmail(userId int) (email string, verified bool, err error) {
+	var nullEmail sql.NullString
+	err = u.db.QueryRow("SELECT email, email_verified FROM users WHERE user_id = $1", userId).
+		Scan(&nullEmail, &verified)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, service.ErrUserNotFound
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get user email: %w", err)
+	}
+
+	return nullEmail.String, verified, nil
+}
+
+func (u UserRepository) CreateVerificationToken(userId int, tokenHash string, expiresAt time.Time) error {
+	_, err := u.db.Exec(`INSERT INTO user_tokens (user_id, token_hash, purpose, expires_at)
+						VALUES ($1, $2, 'email_verification', $3)`, userId, tokenHash, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create verification token: %w", err)
+	}
+
+	return nil
+}
+
+func (u UserRepository) VerifyEmail(tokenHash string) (bool, error) {
+	tx, err := u.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Println(err)
+		}
+	}()
+
+	var userId int
+	err = tx.QueryRow(`UPDATE user_tokens SET used_at = now()
+						WHERE token_hash = $1 AND purpose = 'email_verification'
+						AND used_at IS NULL AND expires_at > now()
+						RETURNING user_id`, tokenHash).Scan(&userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to use verification token: %w", err)
+	}
+
+	if _, err = tx.Exec("UPDATE users SET email_verified = true WHERE user_id = $1", userId); err != nil {
+		return false, fmt.Errorf("failed to verify email: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to verify email: %w", err)
+	}
+
+	return true, nil
+}
+
+func (u UserRepository) Profile(userId int) (service.Profile, error) {
+	var (
+		profile     service.Profile
+		email       sql.NullString
+		displayName sql.NullString
+	)
+	err := u.db.QueryRow(`SELECT user_id, username, email, email_verified, display_name
+						FROM users WHERE user_id = $1`, userId).
+		Scan(&profile.ID, &profile.Username, &email, &profile.EmailVerified, &displayName)
+	if errors.Is(err, sql.ErrNoRows) {
+		return service.Profile{}, service.ErrUserNotFound
+	}
+	if err != nil {
+		return service.Profile{}, fmt.Errorf("failed to get user profile: %w", err)
+	}
+
+	profile.Email = email.String
+	profile.DisplayName = displayName.String
+
+	return profile, nil
+}
+
+func (u UserRepository) UpdateProfile(profile service.Profile) error {
+	var exists bool
+	err := u.db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE username = $1 AND user_id <> $2)",
+		profile.Username, profile.ID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check if user with username %q exists: %w", profile.Username, err)
+	}
+	if exists {
+		return fmt.Errorf("%w: %q", service.ErrUserExists, profile.Username)
+	}
+
+	res, err := u.db.Exec(`UPDATE users SET username = $2, email = $3, email_verified = $4, display_name = $5
+						WHERE user_id = $1`, profile.ID, profile.Username, nullString(profile.Email),
+		profile.EmailVerified, nullString(profile.DisplayName))
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "users_email_key" {
+		return fmt.Errorf("%w: %q", service.ErrEmailExists, profile.Email)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update user profile: %w", err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update user profile: %w", err)
+	}
+	if rowsAffected == 0 {
+		return service.ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (u UserRepository) PasswordHash(userId int) (string, error) {
+	var hash string
+	err := u.db.QueryRow("SELECT hashed_password FROM users WHERE user_id = $1", userId).Scan(&hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", service.ErrUserNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get password hash: %w", err)
+	}
+
+	return hash, nil
+}
+
+func (u UserRepository) UpdatePassword(userId int, passwordHash string) error {
+	tx, err := u.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Println(err)
+		}
+	}()
+
+	if _, err = tx.Exec("UPDATE users SET hashed_password = $1 WHERE user_id = $2", passwordHash, userId); err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	_, err = tx.Exec("UPDATE refresh_tokens SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL", userId)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	return nil
+}
+
+func (u UserRepository) EraseUser(userId int, passwordHash string) ([]string, []string, error) {
+	tx, err := u.db.Begin()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Println(err)
+		}
+	}()
+
+	var username string
+	err = tx.QueryRow("SELECT username FROM users WHERE user_id = $1 AND erased_at IS NULL FOR UPDATE", userId).
+		Scan(&username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, service.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	_, err = tx.Exec(`UPDATE users
+						SET username = 'deleted-user-' || user_id, hashed_password = $2, email = NULL,
+							email_verified = false, display_name = NULL,
+							disabled_at = COALESCE(disabled_at, now()), erased_at = now()
+						WHERE user_id = $1`, userId, passwordHash)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to anonymize user: %w", err)
+	}
+
+	rows, err := tx.Query("DELETE FROM payment_methods WHERE user_id = $1 RETURNING provider_token", userId)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to delete payment methods: %w", err)
+	}
+	var paymentTokens []string
+	for rows.Next() {
+		var token string
+		if err = rows.Scan(&token); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("failed to delete payment methods: %w", err)
+		}
+		paymentTokens = append(paymentTokens, token)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to delete payment methods: %w", err)
+	}
+
+	rows, err = tx.Query(`SELECT DISTINCT pdf_key FROM tickets WHERE user_id = $1 AND pdf_key IS NOT NULL`, userId)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get ticket files: %w", err)
+	}
+	var fileKeys []string
+	for rows.Next() {
+		var key string
+		if err = rows.Scan(&key); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("failed to get ticket files: %w", err)
+		}
+		fileKeys = append(fileKeys, key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to get ticket files: %w", err)
+	}
+
+	if _, err = tx.Exec("DELETE FROM ticket_emails WHERE pdf_key = ANY($1)", pq.Array(fileKeys)); err != nil {
+		return nil, nil, fmt.Errorf("failed to delete ticket emails: %w", err)
+	}
+
+	if _, err = tx.Exec("UPDATE tickets SET pdf_key = NULL WHERE user_id = $1", userId); err != nil {
+		return nil, nil, fmt.Errorf("failed to unlink ticket files: %w", err)
+	}
+
+	for _, table := range []string{"user_tokens", "recovery_codes", "user_totp", "api_keys", "user_identities",
+		"refresh_tokens", "user_roles", "guest_checkouts", "seat_holds"} {
+		if _, err = tx.Exec("DELETE FROM "+table+" WHERE user_id = $1", userId); err != nil {
+			return nil, nil, fmt.Errorf("failed to delete %s: %w", table, err)
+		}
+	}
+
+	if _, err = tx.Exec("DELETE FROM login_attempts WHERE attempt_key = $1", "account:"+username); err != nil {
+		return nil, nil, fmt.Errorf("failed to delete login attempts: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("failed to erase user: %w", err)
+	}
+
+	return paymentTokens, fileKeys, nil
+}
+
+func (u UserRepository) Tickets(userId int) ([]service.TicketRecord, error) {
+	rows, err := u.db.Query(`SELECT t.ticket_id, s.session_id, m.title, h.hall_id, h.hall_name, s.start_time,
+							t.seat_number, COALESCE(t.price, s.price), t.status
+						FROM tickets t
+						JOIN cinema_sessions s ON s.session_id = t.session_id
+						JOIN movies m ON m.movie_id = s.movie_id
+						JOIN halls h ON h.hall_id = s.hall_id
+						WHERE t.user_id = $1
+						ORDER BY s.start_time, t.ticket_id`, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tickets: %w", err)
+	}
+	defer rows.Close()
+
+	tickets := make([]service.TicketRecord, 0)
+	for rows.Next() {
+		var t service.TicketRecord
+		err = rows.Scan(&t.ID, &t.SessionID, &t.MovieTitle, &t.HallID, &t.HallName, &t.StartTime,
+			&t.SeatNumber, &t.Price, &t.Status)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan ticket: %w", err)
+		}
+		tickets = append(tickets, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get tickets: %w", err)
+	}
+
+	return tickets, nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// usersFilter matches users by a part of the username $1 and of the email $2
+// and by the role $3.
+const usersFilter = `
+						WHERE ($1 = '' OR strpos(lower(u.username), lower($1)) > 0)
+						AND ($2 = '' OR strpos(lower(u.email), lower($2)) > 0)
+						AND ($3 = '' OR EXISTS (SELECT 1 FROM user_roles fur
+							JOIN roles fr ON fr.role_id = fur.role_id
+							WHERE fur.user_id = u.user_id AND fr.role_name = $3))`
+
+func (u UserRepository) Users(filter service.UserFilter) ([]service.User, int, error) {
+	// The total is counted separately, since a page past the end has no rows
+	// to carry it.
+	var total int
+	err := u.db.QueryRow("SELECT COUNT(*) FROM users u"+usersFilter, filter.Username, filter.Email, filter.Role).
+		Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	rows, err := u.db.Query(`SELECT u.user_id, u.username, u.email, u.email_verified, u.display_name, u.disabled_at,
+							COALESCE(array_agg(r.role_name ORDER BY r.role_name)
+								FILTER (WHERE r.role_name IS NOT NULL), '{}')
+						FROM users u
+						LEFT JOIN user_roles ur ON ur.user_id = u.user_id
+						LEFT JOIN roles r ON r.role_id = ur.role_id`+usersFilter+`
+						GROUP BY u.user_id
+						ORDER BY u.user_id
+						OFFSET $4
+						LIMIT $5`, filter.Username, filter.Email, filter.Role, filter.Offset, filter.Limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []service.User
+	for rows.Next() {
+		var (
+			user        service.User
+			email       sql.NullString
+			displayName sql.NullString
+			disabledAt  sql.NullTime
+		)
+		err = rows.Scan(&user.ID, &user.Username, &email, &user.EmailVerified, &displayName, &disabledAt,
+			pq.Array(&user.Roles))
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan user: %w", err)
+		}
+
+		user.Email = email.String
+		user.DisplayName = displayName.String
+		if disabledAt.Valid {
+			user.DisabledAt = &disabledAt.Time
+		}
+		users = append(users, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to get users: %w", err)
+	}
+
+	return users, total, nil
+}
+
+func (u UserRepository) User(userId int) (service.User, error) {
+	var (
+		user        service.User
+		email       sql.NullString
+		displayName sql.NullString
+		disabledAt  sql.NullTime
+	)
+	err := u.db.QueryRow(`SELECT u.user_id, u.username, u.email, u.email_verified, u.display_name, u.disabled_at,
+							COALESCE(ARRAY(SELECT r.role_name FROM user_roles ur
+								JOIN roles r ON r.role_id = ur.role_id
+								WHERE ur.user_id = u.user_id ORDER BY r.role_name), '{}'),
+							(SELECT COUNT(*) FROM tickets t WHERE t.user_id = u.user_id)
+						FROM users u
+						WHERE u.user_id = $1`, userId).
+		Scan(&user.ID, &user.Username, &email, &user.EmailVerified, &displayName, &disabledAt,
+			pq.Array(&user.Roles), &user.TicketCount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return service.User{}, service.ErrUserNotFound
+	}
+	if err != nil {
+		return service.User{}, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	user.Email = email.String
+	user.DisplayName = displayName.String
+	if disabledAt.Valid {
+		user.DisabledAt = &disabledAt.Time
+	}
+
+	return user, nil
+}
+
+func (u UserRepository) RevokeAdmin(userId int) (bool, error) {
+	var exists bool
+	err := u.db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE user_id = $1)", userId).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check if user exists: %w", err)
+	}
+	if !exists {
+		return false, nil
+	}
+
+	_, err = u.db.Exec(`DELETE FROM user_roles
+						WHERE user_id = $1 AND role_id = (SELECT role_id FROM roles WHERE role_name = $2)`,
+		userId, service.AdminRoleName)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke admin role: %w", err)
+	}
+
+	return true, nil
+}
+
+func (u UserRepository) SetDisabled(userId int, disabled bool) (bool, error) {
+	tx, err := u.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Println(err)
+		}
+	}()
+
+	res, err := tx.Exec(`UPDATE users SET disabled_at = CASE WHEN $2 THEN COALESCE(disabled_at, now()) END
+						WHERE user_id = $1 AND erased_at IS NULL`, userId, disabled)
+	if err != nil {
+		return false, fmt.Errorf("failed to update user status: %w", err)
+	}
+
 	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to update user status: %w", err)
+	}
 	if rowsAffected == 0 {
 		return false, nil
 	}
 
+	if disabled {
+		_, err = tx.Exec("UPDATE refresh_tokens SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL",
+			userId)
+		if err != nil {
+			return false, fmt.Errorf("failed to revoke refresh tokens: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to update user status: %w", err)
+	}
+
 	return true, nil
 }
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+var ErrSelfAction = errors.New("administrators can not disable or demote themselves")
+
+type User struct {
+	ID            int
+	Username      string
+	Email         string
+	EmailVerified bool
+	DisplayName   string
+	Roles         []string
+	DisabledAt    *time.Time
+	TicketCount   int
+}
+
+type UserFilter struct {
+	Username string
+	Email    string
+	Role     string
+	Offset   int
+	Limit    int
+}
+
+func (s Service) Users(filter UserFilter) ([]User, int, error) {
+	users, total, err := s.r.Users(filter)
+	if err != nil {
+		log.Println(err)
+		return nil, 0, ErrInternalError
+	}
+
+	return users, total, nil
+}
+
+func (s Service) User(userId int) (User, error) {
+	user, err := s.r.User(userId)
+	if errors.Is(err, ErrUserNotFound) {
+		return User{}, err
+	}
+	if err != nil {
+		log.Println(err)
+		return User{}, ErrInternalError
+	}
+
+	return user, nil
+}
+
+func (s Service) RevokeAdmin(adminId int, userId int) error {
+	if adminId == userId {
+		return ErrSelfAction
+	}
+
+	found, err := s.r.RevokeAdmin(userId)
+	if err != nil {
+		log.Println(err)
+		return ErrInternalError
+	}
+	if !found {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (s Service) SetDisabled(adminId int, userId int, disabled bool) error {
+	if adminId == userId {
+		return ErrSelfAction
+	}
+
+	found, err := s.r.SetDisabled(userId, disabled)
+	if err != nil {
+		log.Println(err)
+		return ErrInternalError
+	}
+	if !found {
+		return ErrUserNotFound
+	}
+	return nil
+}
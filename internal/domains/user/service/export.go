@@ -0,0 +1,137 @@
+package service
+
+import (
+	movieService "bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/movie/service"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/password"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/token"
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+type TicketRecord struct {
+	ID         int
+	SessionID  int
+	MovieTitle string
+	HallID     int
+	HallName   string
+	StartTime  time.Time
+	SeatNumber int
+	Price      float64
+	Status     string
+}
+
+type SessionRecord struct {
+	ID         int
+	MovieTitle string
+	HallName   string
+	StartTime  time.Time
+}
+
+// Export holds all personal data kept about a user, as returned for a data
+// subject access request.
+type Export struct {
+	GeneratedAt      time.Time
+	Profile          Profile
+	Tickets          []TicketRecord
+	SessionsAttended []SessionRecord
+	WatchedMovies    []movieService.Movie
+}
+
+const ticketCancelled = "cancelled"
+
+type movieHistory interface {
+	WatchedMovies(userId int) ([]movieService.Movie, error)
+}
+
+type paymentProvider interface {
+	Detach(ctx context.Context, token string) error
+}
+
+type ticketFiles interface {
+	Delete(ctx context.Context, key string) error
+}
+
+func (s Service) Export(userId int) (Export, error) {
+	profile, err := s.Profile(userId)
+	if err != nil {
+		return Export{}, err
+	}
+
+	tickets, err := s.r.Tickets(userId)
+	if err != nil {
+		log.Println(err)
+		return Export{}, ErrInternalError
+	}
+
+	movies, err := s.movies.WatchedMovies(userId)
+	if err != nil {
+		log.Println(err)
+		return Export{}, ErrInternalError
+	}
+
+	now := time.Now()
+	export := Export{
+		GeneratedAt:      now,
+		Profile:          profile,
+		Tickets:          tickets,
+		SessionsAttended: []SessionRecord{},
+		WatchedMovies:    movies,
+	}
+
+	attended := make(map[int]bool)
+	for _, t := range tickets {
+		if t.StartTime.After(now) || t.Status == ticketCancelled || attended[t.SessionID] {
+			continue
+		}
+		attended[t.SessionID] = true
+		export.SessionsAttended = append(export.SessionsAttended, SessionRecord{
+			ID:         t.SessionID,
+			MovieTitle: t.MovieTitle,
+			HallName:   t.HallName,
+			StartTime:  t.StartTime,
+		})
+	}
+
+	return export, nil
+}
+
+// EraseUser anonymizes the account instead of deleting it, so tickets stay
+// available for accounting while nothing in them points to a person anymore.
+// Ticket PDFs print the purchaser, so they are deleted.
+func (s Service) EraseUser(ctx context.Context, userId int) error {
+	random, _, err := token.New()
+	if err != nil {
+		log.Println(err)
+		return ErrInternalError
+	}
+	passwordHash, err := password.Hash(random)
+	if err != nil {
+		log.Println("failed to hash password:", err)
+		return ErrInternalError
+	}
+
+	paymentTokens, fileKeys, err := s.r.EraseUser(userId, passwordHash)
+	if errors.Is(err, ErrUserNotFound) {
+		return err
+	}
+	if err != nil {
+		log.Println(err)
+		return ErrInternalError
+	}
+
+	for _, paymentToken := range paymentTokens {
+		if err = s.payments.Detach(ctx, paymentToken); err != nil {
+			log.Printf("failed to detach payment method of erased user %d: %v", userId, err)
+		}
+	}
+
+	for _, key := range fileKeys {
+		if err = s.files.Delete(ctx, key); err != nil {
+			log.Printf("failed to delete ticket file of erased user %d: %v", userId, err)
+		}
+	}
+
+	return nil
+}
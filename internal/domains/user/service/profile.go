@@ -0,0 +1,105 @@
+package service
+
+import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/password"
+	"errors"
+	"log"
+)
+
+var ErrInvalidPassword = errors.New("current password is incorrect")
+
+type Profile struct {
+	ID            int
+	Username      string
+	Email         string
+	EmailVerified bool
+	DisplayName   string
+}
+
+// ProfileUpdate holds the fields to change, nil fields are left as they are.
+type ProfileUpdate struct {
+	Username    *string
+	Email       *string
+	DisplayName *string
+}
+
+func (s Service) Profile(userId int) (Profile, error) {
+	profile, err := s.r.Profile(userId)
+	if errors.Is(err, ErrUserNotFound) {
+		return Profile{}, err
+	}
+	if err != nil {
+		log.Println(err)
+		return Profile{}, ErrInternalError
+	}
+
+	return profile, nil
+}
+
+func (s Service) UpdateProfile(userId int, update ProfileUpdate) (Profile, error) {
+	profile, err := s.Profile(userId)
+	if err != nil {
+		return Profile{}, err
+	}
+
+	emailChanged := false
+	if update.Username != nil {
+		profile.Username = *update.Username
+	}
+	if update.DisplayName != nil {
+		profile.DisplayName = *update.DisplayName
+	}
+	if update.Email != nil && *update.Email != profile.Email {
+		profile.Email = *update.Email
+		profile.EmailVerified = false
+		emailChanged = true
+	}
+
+	err = s.r.UpdateProfile(profile)
+	if errors.Is(err, ErrUserExists) || errors.Is(err, ErrEmailExists) || errors.Is(err, ErrUserNotFound) {
+		return Profile{}, err
+	}
+	if err != nil {
+		log.Println(err)
+		return Profile{}, ErrInternalError
+	}
+
+	if emailChanged {
+		if err = s.sendVerification(userId, profile.Email); err != nil {
+			log.Println("failed to send verification email:", err)
+		}
+	}
+
+	return profile, nil
+}
+
+func (s Service) ChangePassword(userId int, currentPassword string, newPassword string) error {
+	hash, err := s.r.PasswordHash(userId)
+	if errors.Is(err, ErrUserNotFound) {
+		return err
+	}
+	if err != nil {
+		log.Println(err)
+		return ErrInternalError
+	}
+
+	if _, err = password.Verify(hash, currentPassword); errors.Is(err, password.ErrMismatch) {
+		return ErrInvalidPassword
+	} else if err != nil {
+		log.Println(err)
+		return ErrInternalError
+	}
+
+	newHash, err := password.Hash(newPassword)
+	if err != nil {
+		log.Println("failed to hash password:", err)
+		return ErrInternalError
+	}
+
+	if err = s.r.UpdatePassword(userId, newHash); err != nil {
+		log.Println(err)
+		return ErrInternalError
+	}
+
+	return nil
+}
@@ -1,47 +1,133 @@
 package service
 
 import (
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/password"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/token"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/pkg/mailer"
 	"errors"
+	"fmt"
+	"log"
+	"time"
 )
 
 var (
-	ErrInternalError = errors.New("internal server error")
-	ErrUserExists    = errors.New("user already exists")
-	ErrUserNotFound  = errors.New("user was not found")
+	ErrInternalError   = errors.New("internal server error")
+	ErrUserExists      = errors.New("user already exists")
+	ErrEmailExists     = errors.New("email is already in use")
+	ErrUserNotFound    = errors.New("user was not found")
+	ErrInvalidToken    = errors.New("invalid or expired token")
+	ErrAlreadyVerified = errors.New("email is already verified")
 )
 
 const (
-	AdminRoleId   = 1
-	UserRoleId    = 2
-	AdminRoleName = "admin"
+	AdminRoleName   = "admin"
+	UserRoleName    = "user"
+	WritePermission = "users:write"
 )
 
+const verificationTokenExp = 24 * time.Hour
+
 type repository interface {
-	CreateUser(username string, passwordHash string) (userId int, err error)
+	CreateUser(username string, passwordHash string, email string) (userId int, err error)
 	MakeAdmin(userId int) (bool, error)
+	UserEmail(userId int) (email string, verified bool, err error)
+	CreateVerificationToken(userId int, tokenHash string, expiresAt time.Time) error
+	VerifyEmail(tokenHash string) (bool, error)
+	Profile(userId int) (Profile, error)
+	UpdateProfile(profile Profile) error
+	PasswordHash(userId int) (string, error)
+	UpdatePassword(userId int, passwordHash string) error
+	EraseUser(userId int, passwordHash string) (paymentTokens, fileKeys []string, err error)
+	Tickets(userId int) ([]TicketRecord, error)
+	Users(filter UserFilter) (users []User, total int, err error)
+	User(userId int) (User, error)
+	RevokeAdmin(userId int) (bool, error)
+	SetDisabled(userId int, disabled bool) (bool, error)
+}
+
+type sender interface {
+	Send(msg mailer.Message) error
 }
 
 type Service struct {
-	r repository
+	r         repository
+	m         sender
+	publicURL string
+	movies    movieHistory
+	payments  paymentProvider
+	files     ticketFiles
 }
 
-func New(r repository) Service {
-	return Service{r: r}
+func New(r repository, m sender, publicURL string, movies movieHistory, payments paymentProvider,
+	files ticketFiles) Service {
+	return Service{
+		r:         r,
+		m:         m,
+		publicURL: publicURL,
+		movies:    movies,
+		payments:  payments,
+		files:     files,
+	}
 }
 
-func (s Service) CreateUser(username string, passwordHash string) (userId int, err error) {
-	id, err := s.r.CreateUser(username, passwordHash)
-	if errors.Is(err, ErrUserExists) {
+func (s Service) CreateUser(username string, passwd string, email string) (userId int, err error) {
+	passwordHash, err := password.Hash(passwd)
+	if err != nil {
+		log.Println("failed to hash password:", err)
+		return 0, ErrInternalError
+	}
+
+	id, err := s.r.CreateUser(username, passwordHash, email)
+	if errors.Is(err, ErrUserExists) || errors.Is(err, ErrEmailExists) {
 		return 0, err
 	}
 
 	if err != nil {
+		log.Println(err)
 		return 0, ErrInternalError
 	}
 
+	if err = s.sendVerification(id, email); err != nil {
+		log.Println("failed to send verification email:", err)
+	}
+
 	return id, nil
 }
 
+func (s Service) ResendVerification(userId int) error {
+	email, verified, err := s.r.UserEmail(userId)
+	if errors.Is(err, ErrUserNotFound) {
+		return err
+	}
+	if err != nil {
+		log.Println(err)
+		return ErrInternalError
+	}
+
+	if verified {
+		return ErrAlreadyVerified
+	}
+
+	if err = s.sendVerification(userId, email); err != nil {
+		log.Println("failed to send verification email:", err)
+		return ErrInternalError
+	}
+
+	return nil
+}
+
+func (s Service) VerifyEmail(verificationToken string) error {
+	found, err := s.r.VerifyEmail(token.Hash(verificationToken))
+	if err != nil {
+		log.Println(err)
+		return ErrInternalError
+	}
+	if !found {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
 func (s Service) MakeAdmin(userId int) error {
 	found, err := s.r.MakeAdmin(userId)
 	if err != nil {
@@ -52,3 +138,22 @@ func (s Service) MakeAdmin(userId int) error {
 	}
 	return nil
 }
+
+func (s Service) sendVerification(userId int, email string) error {
+	verificationToken, hash, err := token.New()
+	if err != nil {
+		return err
+	}
+
+	if err = s.r.CreateVerificationToken(userId, hash, time.Now().Add(verificationTokenExp)); err != nil {
+		return err
+	}
+
+	return s.m.Send(mailer.Message{
+		To:      email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Please confirm your email address by opening the link below:\n\n"+
+			"%s/users/verify-email?token=%s\n\nThe link expires in %d hours.\n",
+			s.publicURL, verificationToken, int(verificationTokenExp.Hours())),
+	})
+}
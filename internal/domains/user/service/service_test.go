@@ -1,43 +1,358 @@
 package service
 
 import (
+	movieService "bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/domains/movie/service"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/internal/password"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/pkg/mailer"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/pkg/payment"
+	"bitbucket.org/Ernst_Dzeravianka/cinemago-app/pkg/storage"
+	"context"
 	"errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 )
 
 type mockRepository struct {
-	id  int
+	id           int
+	err          error
+	passwordHash string
+	verified     bool
+	tokens       map[string]int
+	profile      Profile
+	updateErr    error
+	erased       bool
+	disabled     bool
+	tickets      []TicketRecord
+	paymentToken string
+	fileKey      string
+}
+
+type mockMovies struct {
 	err error
 }
 
-func (m mockRepository) CreateUser(username string, passwordHash string) (userId int, err error) {
+func (m mockMovies) WatchedMovies(userId int) ([]movieService.Movie, error) {
+	return []movieService.Movie{{Id: 1, Title: "Movie"}}, m.err
+}
+
+func (m *mockRepository) CreateUser(username string, passwordHash string, email string) (userId int, err error) {
+	m.passwordHash = passwordHash
 	return m.id, m.err
 }
 
+func (m *mockRepository) UserEmail(userId int) (string, bool, error) {
+	return "test@example.com", m.verified, m.err
+}
+
+func (m *mockRepository) CreateVerificationToken(userId int, tokenHash string, expiresAt time.Time) error {
+	if m.tokens == nil {
+		m.tokens = map[string]int{}
+	}
+	m.tokens[tokenHash] = userId
+	return nil
+}
+
+func (m *mockRepository) VerifyEmail(tokenHash string) (bool, error) {
+	if _, ok := m.tokens[tokenHash]; !ok {
+		return false, m.err
+	}
+	delete(m.tokens, tokenHash)
+	m.verified = true
+	return true, m.err
+}
+
+func (m *mockRepository) MakeAdmin(userId int) (bool, error) {
+	return m.err == nil, m.err
+}
+
+func (m *mockRepository) Profile(userId int) (Profile, error) {
+	return m.profile, m.err
+}
+
+func (m *mockRepository) UpdateProfile(profile Profile) error {
+	if m.updateErr != nil {
+		return m.updateErr
+	}
+	m.profile = profile
+	return nil
+}
+
+func (m *mockRepository) PasswordHash(userId int) (string, error) {
+	return m.passwordHash, m.err
+}
+
+func (m *mockRepository) UpdatePassword(userId int, passwordHash string) error {
+	m.passwordHash = passwordHash
+	return m.err
+}
+
+func (m *mockRepository) EraseUser(userId int, passwordHash string) ([]string, []string, error) {
+	if m.err != nil {
+		return nil, nil, m.err
+	}
+	m.erased = true
+	m.passwordHash = passwordHash
+	return []string{m.paymentToken}, []string{m.fileKey}, nil
+}
+
+func (m *mockRepository) Tickets(userId int) ([]TicketRecord, error) {
+	return m.tickets, m.err
+}
+
+func (m *mockRepository) Users(filter UserFilter) ([]User, int, error) {
+	return []User{{ID: 3, Username: "test_user"}}, 1, m.err
+}
+
+func (m *mockRepository) User(userId int) (User, error) {
+	return User{ID: userId, Username: "test_user"}, m.err
+}
+
+func (m *mockRepository) RevokeAdmin(userId int) (bool, error) {
+	return m.err == nil, m.err
+}
+
+func (m *mockRepository) SetDisabled(userId int, disabled bool) (bool, error) {
+	if userId != m.id {
+		return false, m.err
+	}
+	m.disabled = disabled
+	return true, m.err
+}
+
 func TestCreateUser(t *testing.T) {
 	repo := mockRepository{}
 	t.Run("successful user creation", func(t *testing.T) {
 		repo.id = 3
-		s := New(&repo)
-		id, err := s.CreateUser("test_user", "hashed_password")
+		s := New(&repo, mailer.NewMemory(), "http://localhost:8080", mockMovies{}, payment.NewFake(), storage.NewMemory())
+		id, err := s.CreateUser("test_user", "password", "test@example.com")
 		assert.NoError(t, err)
 		assert.Equal(t, 3, id)
+
+		assert.NotEqual(t, "password", repo.passwordHash, "password should not be stored as is")
+		_, err = password.Verify(repo.passwordHash, "password")
+		assert.NoError(t, err)
 	})
 
 	t.Run("repository error", func(t *testing.T) {
 		repo.err = errors.New("something went wrong")
-		s := New(&repo)
-		id, err := s.CreateUser("test_user", "hashed_password")
+		s := New(&repo, mailer.NewMemory(), "http://localhost:8080", mockMovies{}, payment.NewFake(), storage.NewMemory())
+		id, err := s.CreateUser("test_user", "password", "test@example.com")
 		assert.ErrorIs(t, err, ErrInternalError)
 		assert.Zero(t, id)
 	})
 
 	t.Run("user exists", func(t *testing.T) {
 		repo.err = ErrUserExists
-		s := New(&repo)
-		id, err := s.CreateUser("test_user", "hashed_password")
+		s := New(&repo, mailer.NewMemory(), "http://localhost:8080", mockMovies{}, payment.NewFake(), storage.NewMemory())
+		id, err := s.CreateUser("test_user", "password", "test@example.com")
 		assert.ErrorIs(t, err, ErrUserExists)
 		assert.Zero(t, id)
 	})
 }
+
+func TestEmailVerification(t *testing.T) {
+	repo := mockRepository{id: 3}
+	m := mailer.NewMemory()
+	s := New(&repo, m, "http://localhost:8080", mockMovies{}, payment.NewFake(), storage.NewMemory())
+
+	_, err := s.CreateUser("test_user", "password", "test@example.com")
+	require.NoError(t, err)
+
+	messages := m.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, "test@example.com", messages[0].To)
+
+	link := messages[0].Body[strings.Index(messages[0].Body, "http://"):]
+	link = strings.Fields(link)[0]
+	u, err := url.Parse(link)
+	require.NoError(t, err)
+	assert.Equal(t, "/users/verify-email", u.Path)
+
+	t.Run("invalid token", func(t *testing.T) {
+		err := s.VerifyEmail("invalid")
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("successful verification", func(t *testing.T) {
+		err := s.VerifyEmail(u.Query().Get("token"))
+		assert.NoError(t, err)
+		assert.True(t, repo.verified)
+	})
+
+	t.Run("token is single use", func(t *testing.T) {
+		err := s.VerifyEmail(u.Query().Get("token"))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("verified email is not resent", func(t *testing.T) {
+		err := s.ResendVerification(3)
+		assert.ErrorIs(t, err, ErrAlreadyVerified)
+		assert.Len(t, m.Messages(), 1)
+	})
+
+	t.Run("resend verification", func(t *testing.T) {
+		repo.verified = false
+		err := s.ResendVerification(3)
+		assert.NoError(t, err)
+		assert.Len(t, m.Messages(), 2)
+	})
+}
+
+func TestUpdateProfile(t *testing.T) {
+	repo := mockRepository{profile: Profile{ID: 3, Username: "test_user", Email: "test@example.com",
+		EmailVerified: true}}
+	m := mailer.NewMemory()
+	s := New(&repo, m, "http://localhost:8080", mockMovies{}, payment.NewFake(), storage.NewMemory())
+
+	t.Run("update display name", func(t *testing.T) {
+		displayName := "Test User"
+		p, err := s.UpdateProfile(3, ProfileUpdate{DisplayName: &displayName})
+		require.NoError(t, err)
+
+		assert.Equal(t, "Test User", p.DisplayName)
+		assert.Equal(t, "test_user", p.Username)
+		assert.True(t, p.EmailVerified)
+		assert.Empty(t, m.Messages())
+	})
+
+	t.Run("changed email must be verified again", func(t *testing.T) {
+		email := "new@example.com"
+		p, err := s.UpdateProfile(3, ProfileUpdate{Email: &email})
+		require.NoError(t, err)
+
+		assert.Equal(t, "new@example.com", p.Email)
+		assert.False(t, p.EmailVerified)
+		require.Len(t, m.Messages(), 1)
+		assert.Equal(t, "new@example.com", m.Messages()[0].To)
+	})
+
+	t.Run("username taken", func(t *testing.T) {
+		repo.updateErr = ErrUserExists
+
+		username := "taken"
+		_, err := s.UpdateProfile(3, ProfileUpdate{Username: &username})
+		assert.ErrorIs(t, err, ErrUserExists)
+	})
+}
+
+func TestChangePassword(t *testing.T) {
+	hash, err := password.Hash("old_password")
+	require.NoError(t, err)
+
+	repo := mockRepository{passwordHash: hash}
+	s := New(&repo, mailer.NewMemory(), "http://localhost:8080", mockMovies{}, payment.NewFake(), storage.NewMemory())
+
+	t.Run("wrong current password", func(t *testing.T) {
+		err := s.ChangePassword(3, "wrong_password", "new_password")
+		assert.ErrorIs(t, err, ErrInvalidPassword)
+		assert.Equal(t, hash, repo.passwordHash)
+	})
+
+	t.Run("password changed", func(t *testing.T) {
+		err := s.ChangePassword(3, "old_password", "new_password")
+		require.NoError(t, err)
+
+		_, err = password.Verify(repo.passwordHash, "new_password")
+		assert.NoError(t, err)
+	})
+}
+
+func TestExport(t *testing.T) {
+	past := time.Now().Add(-24 * time.Hour)
+	repo := mockRepository{
+		profile: Profile{ID: 3, Username: "test_user"},
+		tickets: []TicketRecord{
+			{ID: 1, SessionID: 1, MovieTitle: "Movie", StartTime: past, SeatNumber: 1},
+			{ID: 2, SessionID: 1, MovieTitle: "Movie", StartTime: past, SeatNumber: 2},
+			{ID: 4, SessionID: 3, MovieTitle: "Movie", StartTime: past, SeatNumber: 2, Status: "cancelled"},
+			{ID: 3, SessionID: 2, MovieTitle: "Movie", StartTime: time.Now().Add(24 * time.Hour), SeatNumber: 1},
+		},
+	}
+
+	t.Run("successful export", func(t *testing.T) {
+		s := New(&repo, mailer.NewMemory(), "http://localhost:8080", mockMovies{}, payment.NewFake(), storage.NewMemory())
+		e, err := s.Export(3)
+		require.NoError(t, err)
+		assert.Equal(t, "test_user", e.Profile.Username)
+		assert.Len(t, e.Tickets, 4)
+		assert.Equal(t, []SessionRecord{{ID: 1, MovieTitle: "Movie", StartTime: past}}, e.SessionsAttended)
+		assert.Len(t, e.WatchedMovies, 1)
+	})
+
+	t.Run("watched movies fail", func(t *testing.T) {
+		s := New(&repo, mailer.NewMemory(), "http://localhost:8080",
+			mockMovies{err: errors.New("something went wrong")}, payment.NewFake(), storage.NewMemory())
+		_, err := s.Export(3)
+		assert.ErrorIs(t, err, ErrInternalError)
+	})
+}
+
+func TestEraseUser(t *testing.T) {
+	provider := payment.NewFake()
+	paymentToken, err := provider.Tokenize("4242424242424242", 12, time.Now().Year()+1)
+	require.NoError(t, err)
+
+	files := storage.NewMemory()
+	require.NoError(t, files.Put(context.Background(), "tickets-3.pdf", strings.NewReader("%PDF"), 4,
+		"application/pdf"))
+
+	repo := mockRepository{passwordHash: "old_hash", paymentToken: paymentToken, fileKey: "tickets-3.pdf"}
+	s := New(&repo, mailer.NewMemory(), "http://localhost:8080", mockMovies{}, provider, files)
+
+	require.NoError(t, s.EraseUser(context.Background(), 3))
+	assert.True(t, repo.erased)
+	assert.NotEqual(t, "old_hash", repo.passwordHash)
+
+	_, err = provider.PaymentMethod(context.Background(), paymentToken)
+	assert.ErrorIs(t, err, payment.ErrInvalidToken)
+
+	_, err = files.Get(context.Background(), "tickets-3.pdf")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	repo.err = ErrUserNotFound
+	assert.ErrorIs(t, s.EraseUser(context.Background(), 3), ErrUserNotFound)
+
+	repo.err = errors.New("something went wrong")
+	assert.ErrorIs(t, s.EraseUser(context.Background(), 3), ErrInternalError)
+}
+
+func TestAdminActions(t *testing.T) {
+	repo := mockRepository{id: 3}
+	s := New(&repo, mailer.NewMemory(), "http://localhost:8080", mockMovies{}, payment.NewFake(), storage.NewMemory())
+
+	t.Run("disable user", func(t *testing.T) {
+		require.NoError(t, s.SetDisabled(1, 3, true))
+		assert.True(t, repo.disabled)
+	})
+
+	t.Run("enable user", func(t *testing.T) {
+		require.NoError(t, s.SetDisabled(1, 3, false))
+		assert.False(t, repo.disabled)
+	})
+
+	t.Run("disable unknown user", func(t *testing.T) {
+		assert.ErrorIs(t, s.SetDisabled(1, 4, true), ErrUserNotFound)
+	})
+
+	t.Run("admin can not disable themselves", func(t *testing.T) {
+		assert.ErrorIs(t, s.SetDisabled(3, 3, true), ErrSelfAction)
+		assert.False(t, repo.disabled)
+	})
+
+	t.Run("admin can not demote themselves", func(t *testing.T) {
+		assert.ErrorIs(t, s.RevokeAdmin(3, 3), ErrSelfAction)
+	})
+
+	t.Run("repository error", func(t *testing.T) {
+		repo.err = errors.New("something went wrong")
+		defer func() { repo.err = nil }()
+
+		assert.ErrorIs(t, s.RevokeAdmin(1, 3), ErrInternalError)
+		_, _, err := s.Users(UserFilter{Limit: 10})
+		assert.ErrorIs(t, err, ErrInternalError)
+	})
+}
@@ -0,0 +1,59 @@
+package password
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrMismatch = errors.New("password does not match")
+
+const (
+	cost = 12
+
+	legacyHashLen = sha256.Size * 2
+)
+
+func Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Verify compares password with the stored hash. needsRehash is true when the
+// stored hash was produced by the legacy unsalted SHA-256 scheme and should be
+// replaced with the result of Hash.
+func Verify(hash string, password string) (needsRehash bool, err error) {
+	if isLegacy(hash) {
+		sum := sha256.Sum256([]byte(password))
+		expected := hex.EncodeToString(sum[:])
+		if subtle.ConstantTimeCompare([]byte(strings.ToLower(hash)), []byte(expected)) != 1 {
+			return false, ErrMismatch
+		}
+		return true, nil
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, ErrMismatch
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return false, nil
+}
+
+func isLegacy(hash string) bool {
+	if len(hash) != legacyHashLen {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
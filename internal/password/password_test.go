@@ -0,0 +1,48 @@
+package password
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+	first, err := Hash("password")
+	assert.NoError(t, err)
+	second, err := Hash("password")
+	assert.NoError(t, err)
+
+	assert.NotEqual(t, "password", first)
+	assert.NotEqual(t, first, second, "hashes should be salted")
+}
+
+func TestVerify(t *testing.T) {
+	hash, err := Hash("password")
+	assert.NoError(t, err)
+
+	t.Run("valid password", func(t *testing.T) {
+		needsRehash, err := Verify(hash, "password")
+		assert.NoError(t, err)
+		assert.False(t, needsRehash)
+	})
+
+	t.Run("invalid password", func(t *testing.T) {
+		_, err := Verify(hash, "invalid_password")
+		assert.ErrorIs(t, err, ErrMismatch)
+	})
+
+	t.Run("legacy sha256 hash", func(t *testing.T) {
+		legacy := "5e884898da28047151d0e56f8dc6292773603d0d6aabbdd62a11ef721d1542d8"
+		needsRehash, err := Verify(legacy, "password")
+		assert.NoError(t, err)
+		assert.True(t, needsRehash)
+
+		_, err = Verify(legacy, "invalid_password")
+		assert.ErrorIs(t, err, ErrMismatch)
+	})
+
+	t.Run("legacy hash is not accepted as password", func(t *testing.T) {
+		legacy := "5e884898da28047151d0e56f8dc6292773603d0d6aabbdd62a11ef721d1542d8"
+		_, err := Verify(legacy, legacy)
+		assert.ErrorIs(t, err, ErrMismatch)
+	})
+}
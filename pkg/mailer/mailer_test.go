@@ -0,0 +1,100 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+	msg := Message{To: "user@example.com", Subject: "Hello", Body: "Hi"}
+
+	require.NoError(t, m.Send(msg))
+	assert.Equal(t, []Message{msg}, m.Messages())
+}
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewFile(dir, "cinema@example.com")
+	require.NoError(t, err)
+
+	err = m.Send(Message{To: "user@example.com", Subject: "Password reset", Body: "line 1\nline 2"})
+	require.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*user@example.com.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	content, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+
+	headers, body, found := strings.Cut(string(content), "\r\n\r\n")
+	require.True(t, found)
+	assert.Contains(t, headers, "From: cinema@example.com\r\n")
+	assert.Contains(t, headers, "To: user@example.com\r\n")
+	assert.Contains(t, headers, "Subject: Password reset\r\n")
+	assert.Equal(t, "line 1\r\nline 2", body)
+}
+
+func TestFileAttachments(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewFile(dir, "cinema@example.com")
+	require.NoError(t, err)
+
+	pdf := bytes.Repeat([]byte("%PDF-1.3 ticket "), 10)
+	err = m.Send(Message{
+		To:      "user@example.com",
+		Subject: "Your ticket",
+		Body:    "See the attachment",
+		Attachments: []Attachment{
+			{Name: "ticket.pdf", ContentType: "application/pdf", Data: pdf},
+			{Name: "ticket.ics", ContentType: "text/calendar; charset=utf-8", Data: []byte("BEGIN:VCALENDAR")},
+		},
+	})
+	require.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	content, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+
+	msg, err := mail.ReadMessage(bytes.NewReader(content))
+	require.NoError(t, err)
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/mixed", mediaType)
+
+	r := multipart.NewReader(msg.Body, params["boundary"])
+
+	part, err := r.NextPart()
+	require.NoError(t, err)
+	body, err := io.ReadAll(part)
+	require.NoError(t, err)
+	assert.Equal(t, "See the attachment", string(body))
+
+	part, err = r.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "ticket.pdf", part.FileName())
+	assert.Equal(t, "application/pdf", part.Header.Get("Content-Type"))
+	data, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, part))
+	require.NoError(t, err)
+	assert.Equal(t, pdf, data)
+
+	part, err = r.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "ticket.ics", part.FileName())
+
+	_, err = r.NextPart()
+	assert.ErrorIs(t, err, io.EOF)
+}
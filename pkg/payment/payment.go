@@ -0,0 +1,205 @@
+package payment
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidCard   = errors.New("invalid card number")
+	ErrInvalidToken  = errors.New("unknown payment token")
+	ErrInvalidRefund = errors.New("refund amount must be positive")
+)
+
+// Method describes a card stored by the payment provider. The card number
+// itself never leaves the provider, only its token and display details do.
+type Method struct {
+	Token    string
+	Brand    string
+	Last4    string
+	ExpMonth int
+	ExpYear  int
+}
+
+type Provider interface {
+	PaymentMethod(ctx context.Context, token string) (Method, error)
+	Detach(ctx context.Context, token string) error
+	Refund(ctx context.Context, reference string, amount float64) (refundId string, err error)
+}
+
+// Fake is an in-memory provider that tokenizes cards locally. It is meant for
+// development and tests and must not be used with real card data.
+type Fake struct {
+	mu      sync.Mutex
+	methods map[string]Method
+	refunds map[string]string
+}
+
+func NewFake() *Fake {
+	return &Fake{methods: make(map[string]Method), refunds: make(map[string]string)}
+}
+
+// Tokenize plays the part of the provider's client-side library: it accepts a
+// card number and returns a token the API can be called with.
+func (f *Fake) Tokenize(number string, expMonth, expYear int) (string, error) {
+	number = strings.ReplaceAll(number, " ", "")
+	if !validNumber(number) {
+		return "", ErrInvalidCard
+	}
+	if expMonth < 1 || expMonth > 12 || expYear < 1 {
+		return "", ErrInvalidCard
+	}
+
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := "tok_" + hex.EncodeToString(b)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.methods[token] = Method{
+		Token:    token,
+		Brand:    brand(number),
+		Last4:    number[len(number)-4:],
+		ExpMonth: expMonth,
+		ExpYear:  expYear,
+	}
+
+	return token, nil
+}
+
+// ServeHTTP exposes Tokenize to clients, so that cards can be tokenized while
+// developing against the fake provider. It takes a JSON object with the
+// number, expMonth and expYear of a card and responds with its token.
+func (f *Fake) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var card struct {
+		Number   string `json:"number"`
+		ExpMonth int    `json:"expMonth"`
+		ExpYear  int    `json:"expYear"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&card); err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	token, err := f.Tokenize(card.Number, card.ExpMonth, card.ExpYear)
+	if errors.Is(err, ErrInvalidCard) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(struct {
+		Token string `json:"token"`
+	}{token})
+}
+
+func (f *Fake) PaymentMethod(ctx context.Context, token string) (Method, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	method, ok := f.methods[token]
+	if !ok {
+		return Method{}, ErrInvalidToken
+	}
+	return method, nil
+}
+
+func (f *Fake) Detach(ctx context.Context, token string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.methods[token]; !ok {
+		return ErrInvalidToken
+	}
+	delete(f.methods, token)
+	return nil
+}
+
+// Refund records a refund of the amount, no money moves. The reference works
+// as an idempotency key, so repeating a refund returns the id of the first one
+// until the process restarts and the fake forgets its refunds.
+func (f *Fake) Refund(ctx context.Context, reference string, amount float64) (string, error) {
+	if amount <= 0 {
+		return "", ErrInvalidRefund
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if id, ok := f.refunds[reference]; ok {
+		return id, nil
+	}
+
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := "re_" + hex.EncodeToString(b)
+	f.refunds[reference] = id
+
+	return id, nil
+}
+
+// Expired reports whether the card can no longer be charged at t. Cards are
+// valid until the end of their expiry month.
+func (m Method) Expired(t time.Time) bool {
+	return !t.Before(time.Date(m.ExpYear, time.Month(m.ExpMonth)+1, 1, 0, 0, 0, 0, time.UTC))
+}
+
+func validNumber(number string) bool {
+	if len(number) < 12 || len(number) > 19 {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		d := int(number[i] - '0')
+		if d < 0 || d > 9 {
+			return false
+		}
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+func brand(number string) string {
+	switch {
+	case strings.HasPrefix(number, "4"):
+		return "visa"
+	case strings.HasPrefix(number, "34"), strings.HasPrefix(number, "37"):
+		return "amex"
+	case number[0] == '5' && number[1] >= '1' && number[1] <= '5':
+		return "mastercard"
+	case number[0] == '2' && number[1] >= '2' && number[1] <= '7':
+		return "mastercard"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,126 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFake(t *testing.T) {
+	f := NewFake()
+	ctx := context.Background()
+
+	t.Run("tokenize card", func(t *testing.T) {
+		token, err := f.Tokenize("4242 4242 4242 4242", 12, 2030)
+		require.NoError(t, err)
+		assert.NotContains(t, token, "4242")
+
+		method, err := f.PaymentMethod(ctx, token)
+		require.NoError(t, err)
+		assert.Equal(t, Method{Token: token, Brand: "visa", Last4: "4242", ExpMonth: 12, ExpYear: 2030}, method)
+
+		require.NoError(t, f.Detach(ctx, token))
+		_, err = f.PaymentMethod(ctx, token)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	tests := []struct {
+		name   string
+		number string
+		month  int
+		brand  string
+		err    error
+	}{
+		{name: "mastercard", number: "5555555555554444", month: 1, brand: "mastercard"},
+		{name: "amex", number: "378282246310005", month: 1, brand: "amex"},
+		{name: "failed checksum", number: "4242424242424241", month: 1, err: ErrInvalidCard},
+		{name: "not a number", number: "4242abcd42424242", month: 1, err: ErrInvalidCard},
+		{name: "invalid month", number: "4242424242424242", month: 13, err: ErrInvalidCard},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := f.Tokenize(tt.number, tt.month, 2030)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+
+			method, err := f.PaymentMethod(ctx, token)
+			require.NoError(t, err)
+			assert.Equal(t, tt.brand, method.Brand)
+		})
+	}
+}
+
+func TestFakeServeHTTP(t *testing.T) {
+	f := NewFake()
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		code   int
+	}{
+		{name: "tokenize card", method: http.MethodPost,
+			body: `{"number": "4242424242424242", "expMonth": 12, "expYear": 2030}`, code: http.StatusCreated},
+		{name: "invalid card", method: http.MethodPost,
+			body: `{"number": "4242424242424241", "expMonth": 12, "expYear": 2030}`, code: http.StatusUnprocessableEntity},
+		{name: "invalid body", method: http.MethodPost, body: `{`, code: http.StatusBadRequest},
+		{name: "wrong method", method: http.MethodGet, code: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			f.ServeHTTP(rec, httptest.NewRequest(tt.method, "/dev/payment-tokens", strings.NewReader(tt.body)))
+			require.Equal(t, tt.code, rec.Code)
+			if tt.code != http.StatusCreated {
+				return
+			}
+
+			var resp struct {
+				Token string `json:"token"`
+			}
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+
+			method, err := f.PaymentMethod(context.Background(), resp.Token)
+			require.NoError(t, err)
+			assert.Equal(t, "4242", method.Last4)
+		})
+	}
+}
+
+func TestFakeRefund(t *testing.T) {
+	f := NewFake()
+	ctx := context.Background()
+
+	id, err := f.Refund(ctx, "ticket-1", 7.5)
+	require.NoError(t, err)
+	assert.NotEmpty(t, id)
+
+	again, err := f.Refund(ctx, "ticket-1", 7.5)
+	require.NoError(t, err)
+	assert.Equal(t, id, again)
+
+	other, err := f.Refund(ctx, "ticket-2", 7.5)
+	require.NoError(t, err)
+	assert.NotEqual(t, id, other)
+
+	_, err = f.Refund(ctx, "ticket-3", 0)
+	assert.ErrorIs(t, err, ErrInvalidRefund)
+}
+
+func TestMethodExpired(t *testing.T) {
+	m := Method{ExpMonth: 12, ExpYear: 2030}
+
+	assert.False(t, m.Expired(time.Date(2030, 12, 31, 23, 0, 0, 0, time.UTC)))
+	assert.True(t, m.Expired(time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC)))
+}
@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FS stores objects as files in a directory. Its signed URLs point to
+// baseURL, where the FS itself must be mounted as an http.Handler.
+type FS struct {
+	dir     string
+	baseURL string
+	secret  []byte
+}
+
+func NewFS(dir, baseURL string, secret []byte) (FS, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return FS{}, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	return FS{dir: dir, baseURL: strings.TrimSuffix(baseURL, "/"), secret: secret}, nil
+}
+
+// Put writes the object to a temporary file first so readers never see a
+// partially written object. The content type is not kept; Get detects it
+// from the content.
+func (f FS) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	tmp, err := os.CreateTemp(f.dir, ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create object %s: %w", key, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	err = copyObject(tmp, r, size)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write object %s: %w", key, err)
+	}
+
+	if err = os.Rename(tmp.Name(), filepath.Join(f.dir, key)); err != nil {
+		return fmt.Errorf("failed to write object %s: %w", key, err)
+	}
+	return nil
+}
+
+func (f FS) Get(ctx context.Context, key string) (Object, error) {
+	file, info, err := f.open(key)
+	if err != nil {
+		return Object{}, err
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		file.Close()
+		return Object{}, fmt.Errorf("failed to read object %s: %w", key, err)
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		return Object{}, fmt.Errorf("failed to read object %s: %w", key, err)
+	}
+
+	return Object{Body: file, Size: info.Size(), ContentType: http.DetectContentType(head[:n])}, nil
+}
+
+func (f FS) Delete(ctx context.Context, key string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	err := os.Remove(filepath.Join(f.dir, key))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete object %s: %w", key, err)
+	}
+	return nil
+}
+
+func (f FS) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	if !validKey(key) {
+		return "", ErrInvalidKey
+	}
+
+	expires := strconv.FormatInt(time.Now().Add(expiry).Unix(), 10)
+	q := url.Values{"expires": {expires}, "signature": {f.sign(key, expires)}}
+	return f.baseURL + "/" + url.PathEscape(key) + "?" + q.Encode(), nil
+}
+
+// ServeHTTP serves the object named by the request path if the URL carries a
+// valid signature from SignedURL that has not expired yet.
+func (f FS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	expires := r.URL.Query().Get("expires")
+	signature := r.URL.Query().Get("signature")
+
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || !hmac.Equal([]byte(signature), []byte(f.sign(key, expires))) {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+	if time.Now().Unix() > expiresAt {
+		http.Error(w, "url has expired", http.StatusForbidden)
+		return
+	}
+
+	obj, err := f.Get(r.Context(), key)
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrInvalidKey) {
+		http.Error(w, ErrNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer obj.Body.Close()
+
+	w.Header().Set("Content-Type", obj.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+	if r.Method == http.MethodGet {
+		io.Copy(w, obj.Body)
+	}
+}
+
+func (f FS) open(key string) (*os.File, fs.FileInfo, error) {
+	if !validKey(key) {
+		return nil, nil, ErrInvalidKey
+	}
+
+	file, err := os.Open(filepath.Join(f.dir, key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open object %s: %w", key, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("failed to open object %s: %w", key, err)
+	}
+
+	return file, info, nil
+}
+
+func (f FS) sign(key, expires string) string {
+	mac := hmac.New(sha256.New, f.secret)
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
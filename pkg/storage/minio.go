@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"github.com/minio/minio-go/v7"
+	"io"
+	"net/url"
+	"time"
+)
+
+type MinIO struct {
+	c          *minio.Client
+	public     *minio.Client
+	bucketName string
+}
+
+func NewMinIO(c *minio.Client, bucketName string) MinIO {
+	return MinIO{
+		c:          c,
+		public:     c,
+		bucketName: bucketName,
+	}
+}
+
+// WithPublicClient sets the client used to sign download URLs. Its endpoint
+// is the address clients reach MinIO at, which differs from the internal one
+// when MinIO runs behind a proxy or in a container network.
+func (m MinIO) WithPublicClient(c *minio.Client) MinIO {
+	m.public = c
+	return m
+}
+
+func (m MinIO) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	_, err := m.c.PutObject(ctx, m.bucketName, key, r, size, minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload object %s to MinIO: %w", key, err)
+	}
+	return nil
+}
+
+func (m MinIO) Get(ctx context.Context, key string) (Object, error) {
+	obj, err := m.c.GetObject(ctx, m.bucketName, key, minio.GetObjectOptions{})
+	if err != nil {
+		return Object{}, fmt.Errorf("failed to get object %s from MinIO: %w", key, err)
+	}
+
+	info, err := obj.Stat()
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		obj.Close()
+		return Object{}, ErrNotFound
+	}
+	if err != nil {
+		obj.Close()
+		return Object{}, fmt.Errorf("failed to get object %s from MinIO: %w", key, err)
+	}
+
+	return Object{Body: obj, Size: info.Size, ContentType: info.ContentType}, nil
+}
+
+func (m MinIO) Delete(ctx context.Context, key string) error {
+	if err := m.c.RemoveObject(ctx, m.bucketName, key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to delete object %s from MinIO: %w", key, err)
+	}
+	return nil
+}
+
+// SignedURL returns a presigned URL. The bucket is private, so objects can be
+// downloaded only this way.
+func (m MinIO) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	u, err := m.public.PresignedGetObject(ctx, m.bucketName, key, expiry, url.Values{})
+	if err != nil {
+		return "", fmt.Errorf("failed to presign URL: %w", err)
+	}
+	return u.String(), nil
+}
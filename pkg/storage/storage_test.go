@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const pdf = "%PDF-1.3 ticket"
+
+func testStorage(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	require.NoError(t, s.Put(ctx, "ticket", strings.NewReader(pdf), int64(len(pdf)), "application/pdf"))
+
+	obj, err := s.Get(ctx, "ticket")
+	require.NoError(t, err)
+	content, err := io.ReadAll(obj.Body)
+	require.NoError(t, err)
+	require.NoError(t, obj.Body.Close())
+	assert.Equal(t, pdf, string(content))
+	assert.Equal(t, int64(len(pdf)), obj.Size)
+	assert.Equal(t, "application/pdf", obj.ContentType)
+
+	_, err = s.SignedURL(ctx, "ticket", time.Minute)
+	assert.NoError(t, err)
+
+	require.NoError(t, s.Delete(ctx, "ticket"))
+	_, err = s.Get(ctx, "ticket")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, s.Delete(ctx, "ticket"))
+
+	for _, key := range []string{"", "..", "../secret", "dir/file"} {
+		err = s.Put(ctx, key, strings.NewReader(pdf), int64(len(pdf)), "application/pdf")
+		assert.ErrorIs(t, err, ErrInvalidKey, key)
+	}
+
+	require.NoError(t, s.Put(ctx, "unsized", strings.NewReader(pdf), -1, "application/pdf"))
+	obj, err = s.Get(ctx, "unsized")
+	require.NoError(t, err)
+	content, err = io.ReadAll(obj.Body)
+	require.NoError(t, err)
+	require.NoError(t, obj.Body.Close())
+	assert.Equal(t, pdf, string(content))
+
+	for _, size := range []int64{int64(len(pdf)) - 1, int64(len(pdf)) + 1} {
+		err = s.Put(ctx, "mismatch", strings.NewReader(pdf), size, "application/pdf")
+		assert.ErrorIs(t, err, ErrSizeMismatch, size)
+		_, err = s.Get(ctx, "mismatch")
+		assert.ErrorIs(t, err, ErrNotFound, size)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	testStorage(t, NewMemory())
+}
+
+func TestFS(t *testing.T) {
+	s, err := NewFS(t.TempDir(), "http://localhost/files", []byte("secret"))
+	require.NoError(t, err)
+
+	testStorage(t, s)
+}
+
+func TestFSServeSignedURL(t *testing.T) {
+	s, err := NewFS(t.TempDir(), "http://localhost/files/", []byte("secret"))
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, s.Put(ctx, "ticket", strings.NewReader(pdf), int64(len(pdf)), "application/pdf"))
+
+	signed, err := s.SignedURL(ctx, "ticket", time.Minute)
+	require.NoError(t, err)
+	u, err := url.Parse(signed)
+	require.NoError(t, err)
+	assert.Equal(t, "/files/ticket", u.Path)
+
+	expired, err := s.SignedURL(ctx, "ticket", -time.Minute)
+	require.NoError(t, err)
+	expiredURL, err := url.Parse(expired)
+	require.NoError(t, err)
+
+	other, err := NewFS(t.TempDir(), "http://localhost/files", []byte("other"))
+	require.NoError(t, err)
+	forged, err := other.SignedURL(ctx, "ticket", time.Minute)
+	require.NoError(t, err)
+	forgedURL, err := url.Parse(forged)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		target string
+		code   int
+	}{
+		{name: "valid signature", target: "/ticket?" + u.RawQuery, code: http.StatusOK},
+		{name: "expired", target: "/ticket?" + expiredURL.RawQuery, code: http.StatusForbidden},
+		{name: "forged signature", target: "/ticket?" + forgedURL.RawQuery, code: http.StatusForbidden},
+		{name: "signature of another key", target: "/other?" + u.RawQuery, code: http.StatusForbidden},
+		{name: "no signature", target: "/ticket", code: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			assert.Equal(t, tt.code, rec.Code)
+			if tt.code == http.StatusOK {
+				assert.Equal(t, pdf, rec.Body.String())
+				assert.Equal(t, "application/pdf", rec.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package totp
+
+import (
+	"encoding/base32"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B test vectors for SHA1, truncated to 6 digits.
+func TestCode(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		code, err := Code(secret, Step(time.Unix(tt.unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, tt.code, code, "time %d", tt.unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+
+	now := time.Now()
+	code, err := Code(secret, Step(now))
+	require.NoError(t, err)
+
+	t.Run("current code", func(t *testing.T) {
+		step, ok := Validate(secret, code, now, 1)
+		assert.True(t, ok)
+		assert.Equal(t, Step(now), step)
+	})
+
+	t.Run("previous code within skew", func(t *testing.T) {
+		_, ok := Validate(secret, code, now.Add(Period*time.Second), 1)
+		assert.True(t, ok)
+	})
+
+	t.Run("code outside skew", func(t *testing.T) {
+		_, ok := Validate(secret, code, now.Add(2*Period*time.Second), 1)
+		assert.False(t, ok)
+	})
+
+	t.Run("wrong code", func(t *testing.T) {
+		_, ok := Validate(secret, "12345", now, 1)
+		assert.False(t, ok)
+	})
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Cinema", "john doe", "JBSWY3DPEHPK3PXP")
+	assert.Equal(t, "otpauth://totp/Cinema:john%20doe?algorithm=SHA1&digits=6&issuer=Cinema&period=30&secret=JBSWY3DPEHPK3PXP", uri)
+}